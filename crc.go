@@ -0,0 +1,152 @@
+package mp3
+
+import (
+	"errors"
+
+	"github.com/tcolgate/mp3/internal/bits"
+	"github.com/tcolgate/mp3/internal/layer2"
+)
+
+// CRCPolicy controls how a Decoder treats protected frames whose stored
+// CRC does not match the computed one
+type CRCPolicy int
+
+const (
+	// CRCIgnore does not check CRCs at all
+	CRCIgnore CRCPolicy = iota
+	// CRCFlag checks CRCs and marks failing frames as corrupt, see Frame.Corrupt
+	CRCFlag
+	// CRCReject checks CRCs and returns ErrCRCMismatch from Decode for
+	// failing frames. The frame is still consumed and populated.
+	CRCReject
+)
+
+// ErrCRCMismatch indicates that a protected frame failed its CRC check
+var ErrCRCMismatch = errors.New("frame CRC mismatch")
+
+const crc16Poly = 0x8005
+
+// crc16 updates crc with the first n bits of data, most significant bit first
+func crc16(crc uint16, data []byte, n int) uint16 {
+	for i := 0; i < n; i++ {
+		bit := uint16(data[i>>3]>>uint(7-i&7)) & 1
+		top := crc >> 15
+		crc <<= 1
+		if top^bit == 1 {
+			crc ^= crc16Poly
+		}
+	}
+	return crc
+}
+
+// WithCRCPolicy sets the CRC checking policy of the decoder. The default is
+// CRCIgnore.
+func WithCRCPolicy(p CRCPolicy) DecoderOption {
+	return func(d *Decoder) {
+		d.crcPolicy = p
+	}
+}
+
+// protectedBits returns the number of bits following the CRC word that are
+// covered by the CRC
+func (f *Frame) protectedBits() (int, error) {
+	h := f.Header()
+	data := f.buf[6:]
+	nch := 2
+	if h.ChannelMode() == SingleChannel {
+		nch = 1
+	}
+
+	switch h.Layer() {
+	case Layer3:
+		sil, err := f.SideInfoLength()
+		return sil * 8, err
+	case Layer1:
+		bound := 32
+		if h.ChannelMode() == JointStereo {
+			bound = int(h.ModeExtension()+1) * 4
+		}
+		return bound*nch*4 + (32-bound)*4, nil
+	case Layer2:
+		t := f.layer2Table()
+		bound := t.SBLimit
+		if h.ChannelMode() == JointStereo && int(h.ModeExtension()+1)*4 < bound {
+			bound = int(h.ModeExtension()+1) * 4
+		}
+		r := bits.NewReader(data)
+		var alloc [2][32]uint32
+		for sb := 0; sb < t.SBLimit; sb++ {
+			for ch := 0; ch < nch; ch++ {
+				if sb >= bound && ch > 0 {
+					alloc[ch][sb] = alloc[0][sb]
+					continue
+				}
+				alloc[ch][sb] = r.Read(t.NBal[sb])
+			}
+		}
+		for sb := 0; sb < t.SBLimit; sb++ {
+			for ch := 0; ch < nch; ch++ {
+				if alloc[ch][sb] != 0 {
+					r.Skip(2)
+				}
+			}
+		}
+		return r.Pos(), r.Err()
+	default:
+		return 0, errors.New("bad layer")
+	}
+}
+
+// layer2Table selects the Layer II allocation table for the frame
+func (f *Frame) layer2Table() *layer2.AllocTable {
+	h := f.Header()
+	nch := 2
+	if h.ChannelMode() == SingleChannel {
+		nch = 1
+	}
+	return layer2.Select(h.Version() != MPEG1, int(f.BitRate())/1000/nch, int(h.SampleRate()))
+}
+
+// ComputeCRC calculates the CRC-16 of the protected header and side info
+// (or bit allocation) bits of the frame. It returns 0 for unprotected
+// frames.
+func (f *Frame) ComputeCRC() (uint16, error) {
+	if !f.Header().Protection() {
+		return 0, nil
+	}
+	n, err := f.protectedBits()
+	if err != nil {
+		return 0, err
+	}
+	if 6*8+n > len(f.buf)*8 {
+		return 0, ErrPrematureEOF
+	}
+	crc := crc16(0xFFFF, f.buf[2:4], 16)
+	return crc16(crc, f.buf[6:], n), nil
+}
+
+// CheckCRC verifies the stored CRC of a protected frame. It returns nil for
+// unprotected frames and ErrCRCMismatch if the check fails.
+func (f *Frame) CheckCRC() error {
+	if !f.Header().Protection() {
+		return nil
+	}
+	want, err := f.CRC()
+	if err != nil {
+		return err
+	}
+	got, err := f.ComputeCRC()
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return ErrCRCMismatch
+	}
+	return nil
+}
+
+// Corrupt reports whether the decoder found this frame to have failed its
+// CRC check. It is only set when the decoder checks CRCs.
+func (f *Frame) Corrupt() bool {
+	return f.corrupt
+}
@@ -0,0 +1,52 @@
+package mp3
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCRC16(t *testing.T) {
+	// CRC-16/CMS check value
+	if crc := crc16(0xFFFF, []byte("123456789"), 72); crc != 0xAEE7 {
+		t.Fatalf("expected crc 0xaee7, got %#04x", crc)
+	}
+}
+
+// protectedSilence returns a copy of the silent frame with the protection bit
+// set and a correct CRC
+func protectedSilence(t *testing.T) []byte {
+	b := make([]byte, 0, len(SilentBytes))
+	b = append(b, SilentBytes[:4]...)
+	b[1] &^= 0x01
+	b = append(b, 0, 0)
+	b = append(b, SilentBytes[4:len(SilentBytes)-2]...)
+
+	f := Frame{buf: b}
+	crc, err := f.ComputeCRC()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	b[4], b[5] = byte(crc>>8), byte(crc)
+	return b
+}
+
+func TestDecoderCRC(t *testing.T) {
+	good := protectedSilence(t)
+	bad := append([]byte{}, good...)
+	bad[10] ^= 0x01
+
+	skipped := 0
+	f := Frame{}
+	d := NewDecoder(bytes.NewReader(append(append([]byte{}, good...), bad...)), WithCRCPolicy(CRCFlag))
+	if err := d.Decode(&f, &skipped); err != nil || f.Corrupt() {
+		t.Fatalf("expected good frame, got err %v, corrupt %v", err, f.Corrupt())
+	}
+	if err := d.Decode(&f, &skipped); err != nil || !f.Corrupt() {
+		t.Fatalf("expected corrupt frame, got err %v, corrupt %v", err, f.Corrupt())
+	}
+
+	d = NewDecoder(bytes.NewReader(bad), WithCRCPolicy(CRCReject))
+	if err := d.Decode(&f, &skipped); err != ErrCRCMismatch {
+		t.Fatalf("expected ErrCRCMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,336 @@
+package mp3
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// primeSamples is the audio that must be decoded ahead of a frame for the
+// overlap of the hybrid filterbank, which spans two Layer III granules, and
+// the history of the synthesis filterbank, to be in place
+const primeSamples = 1152
+
+// ErrCutRange indicates that a cut or split point lies beyond the end of
+// the stream, or that the points are not in increasing order
+var ErrCutRange = errors.New("cut point outside stream")
+
+type (
+	// segment is a range of samples to cut, to is negative for the end of
+	// the stream
+	segment struct {
+		from, to int64
+	}
+
+	// cutFrame is a frame held by a cutter, with the position of its first
+	// sample and the bit reservoir ahead of it
+	cutFrame struct {
+		f      *Frame
+		pos    int64
+		before []byte
+	}
+
+	// cutter copies ranges of samples of a stream to separate Writers
+	cutter struct {
+		segs   []segment
+		create func(i int) (io.WriteSeeker, error)
+
+		tag  LAMETag // the tag of the source, less its track values
+		skip int64   // samples before the audio of the source
+		tail int64   // samples after the audio of the source
+
+		seg int
+		ws  io.WriteSeeker
+		out *Writer
+
+		hist []cutFrame // the frames before the current one
+		res  Reservoir
+	}
+)
+
+// Cut copies the frames holding samples from, up to but not including to,
+// of the stream read from r, to w. No audio is decoded or re-encoded, frames
+// are copied whole, so the cut is lossless. Positions count samples of
+// audio, following any encoder delay recorded in a LAME tag of r, and a
+// negative to, or one past the end of the stream, cuts to its end.
+//
+// The copy starts with the frames before the first frame needed that prime
+// a decoder, preceded if need be by a silent frame carrying the part of the
+// bit reservoir that the frame uses. It is written with a LAME
+// tag giving the encoder delay and padding a decoder must drop to produce
+// exactly the samples requested. Layer I and II streams carry no LAME tag,
+// so their parts keep the extra frames.
+func Cut(w io.WriteSeeker, r io.Reader, from, to int64) error {
+	if from < 0 || (to >= 0 && to <= from) {
+		return ErrCutRange
+	}
+	return cut(r, func(int) []segment {
+		return []segment{{from, to}}
+	}, func(int) (io.WriteSeeker, error) {
+		return w, nil
+	})
+}
+
+// CutTime is as Cut, with positions given as times from the start of the
+// audio, rounded to the nearest sample
+func CutTime(w io.WriteSeeker, r io.Reader, from, to time.Duration) error {
+	if from < 0 || (to >= 0 && to <= from) {
+		return ErrCutRange
+	}
+	return cut(r, func(rate int) []segment {
+		s := segment{durationSamples(from, rate), -1}
+		if to >= 0 {
+			s.to = durationSamples(to, rate)
+		}
+		return []segment{s}
+	}, func(int) (io.WriteSeeker, error) {
+		return w, nil
+	})
+}
+
+// Split splits the stream read from r at each of the given sample
+// positions, which must be increasing, such as the track indexes of a CUE
+// sheet. Each part is cut as by Cut, to the io.WriteSeeker returned by
+// create, which is called with the index of each part in turn, starting at
+// 0 for the part before the first point. If the io.WriteSeeker is also an
+// io.Closer it is closed once its part is complete.
+func Split(r io.Reader, points []int64, create func(i int) (io.WriteSeeker, error)) error {
+	return cut(r, func(int) []segment {
+		return splitSegments(points)
+	}, create)
+}
+
+// SplitTime is as Split, with points given as times from the start of the
+// audio, rounded to the nearest sample
+func SplitTime(r io.Reader, points []time.Duration, create func(i int) (io.WriteSeeker, error)) error {
+	return cut(r, func(rate int) []segment {
+		ps := make([]int64, len(points))
+		for i, p := range points {
+			ps[i] = durationSamples(p, rate)
+		}
+		return splitSegments(ps)
+	}, create)
+}
+
+// splitSegments returns the segments between the points, or nil if they
+// are not increasing
+func splitSegments(points []int64) []segment {
+	segs := make([]segment, len(points)+1)
+	var last int64
+	for i, p := range points {
+		if p <= last {
+			return nil
+		}
+		segs[i].to = p
+		segs[i+1].from = p
+		last = p
+	}
+	segs[len(points)].to = -1
+	return segs
+}
+
+// cut copies the segments given by bounds, at the sample rate of the
+// stream, to the io.WriteSeekers returned by create
+func cut(r io.Reader, bounds func(rate int) []segment, create func(i int) (io.WriteSeeker, error)) error {
+	c := &cutter{create: create}
+	d := NewDecoder(r)
+	var f Frame
+	var pos int64
+	skipped := 0
+	for {
+		err := d.Decode(&f, &skipped)
+		if err == io.EOF || err == ErrNoSyncBits || err == ErrPrematureEOF {
+			break
+		}
+		if err != nil && err != ErrCRCMismatch {
+			return c.abort(err)
+		}
+		if f.IsStreamInfo() {
+			if c.segs == nil {
+				if l, err := f.LAME(); err == nil {
+					c.source(l)
+				}
+			}
+			continue
+		}
+		if c.segs == nil {
+			c.segs = bounds(int(f.Header().SampleRate()))
+			if len(c.segs) == 0 {
+				return ErrCutRange
+			}
+			for i := range c.segs {
+				c.segs[i].from += c.skip
+				if c.segs[i].to >= 0 {
+					c.segs[i].to += c.skip
+				}
+			}
+		}
+
+		cf := cutFrame{
+			f:      f.clone(),
+			pos:    pos,
+			before: append([]byte(nil), c.res.buf...),
+		}
+		if f.Header().Layer() == Layer3 {
+			c.res.Add(cf.f)
+		}
+		if err := c.frame(cf); err != nil {
+			return c.abort(err)
+		}
+		pos += int64(f.Samples())
+	}
+	if c.segs == nil {
+		return ErrNoFrames
+	}
+	return c.finish(pos)
+}
+
+// source takes the delay and padding of the source stream from its LAME
+// tag, and keeps the rest of the tag for the parts
+func (c *cutter) source(l *LAMETag) {
+	skip, tail := l.Trim()
+	c.skip, c.tail = int64(skip), int64(tail)
+	c.tag = *l
+	c.tag.Peak = 0
+	c.tag.RadioGain = ReplayGain{}
+	c.tag.AudiophileGain = ReplayGain{}
+}
+
+// frame copies cf to any segments it overlaps, opening and closing them as
+// needed
+func (c *cutter) frame(cf cutFrame) error {
+	end := cf.pos + int64(cf.f.Samples())
+	for c.seg < len(c.segs) {
+		s := c.segs[c.seg]
+		if c.out == nil {
+			if s.from >= end {
+				break
+			}
+			if err := c.open(cf, s.from); err != nil {
+				return err
+			}
+		}
+		if err := c.out.WriteFrame(cf.f); err != nil {
+			return err
+		}
+		if s.to < 0 || s.to > end {
+			break
+		}
+		if err := c.close(end - s.to); err != nil {
+			return err
+		}
+	}
+
+	// keep enough frames to prime the decoder ahead of the next frame
+	c.hist = append(c.hist, cf)
+	n := 0
+	for _, h := range c.hist[1:] {
+		n += h.f.Samples()
+	}
+	if n >= primeSamples {
+		c.hist = c.hist[1:]
+	}
+	return nil
+}
+
+// open starts the next segment, which begins at sample from within frame
+// cf, by writing the earlier frames a decoder needs before cf
+func (c *cutter) open(cf cutFrame, from int64) error {
+	// the frames held in hist prime the decoder. The main data of the first,
+	// or of those after it, may begin in the frames before it, whose audio
+	// is not needed, so a frame carrying just that data stands in for them.
+	var pre []*Frame
+	start := cf.pos
+	if len(c.hist) > 0 {
+		first := c.hist[0]
+		start = first.pos
+		var fs []*Frame
+		for _, h := range c.hist {
+			fs = append(fs, h.f)
+		}
+		need := reservoirNeed(append(fs, cf.f))
+		if need > len(first.before) {
+			need = len(first.before)
+		}
+		if need > 0 {
+			f, err := reservoirFrame(first.f.Header(), first.before[len(first.before)-need:])
+			if err != nil {
+				return err
+			}
+			pre = append(pre, f)
+			start -= int64(f.Samples())
+		}
+		for _, h := range c.hist {
+			pre = append(pre, h.f)
+		}
+	}
+
+	// at the very start of the stream there are no earlier frames to cover
+	// the decoder delay, so silence stands in for them
+	if delay := from - start - DecoderDelay; delay < 0 {
+		g, err := NewSilenceGenerator(cf.f.Header())
+		if err != nil {
+			return err
+		}
+		silence, _ := g.Samples(-delay)
+		pre = append(silence, pre...)
+		start -= int64(len(silence) * g.SamplesPerFrame())
+	}
+
+	ws, err := c.create(c.seg)
+	if err != nil {
+		return err
+	}
+	tag := c.tag
+	tag.EncoderDelay = int(from - start - DecoderDelay)
+	c.ws = ws
+	c.out = NewWriter(ws, WithLAMETag(tag))
+	for _, f := range pre {
+		if err := c.out.WriteFrame(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close completes the current segment, which ends pad samples before the
+// end of the last frame written
+func (c *cutter) close(pad int64) error {
+	c.out.lame.Padding = int(pad) + DecoderDelay
+	err := c.out.Close()
+	if cl, ok := c.ws.(io.Closer); ok {
+		if cerr := cl.Close(); err == nil {
+			err = cerr
+		}
+	}
+	c.out, c.ws = nil, nil
+	c.seg++
+	return err
+}
+
+// finish completes the segment left open at the end of the stream, whose
+// last frame ends at sample end
+func (c *cutter) finish(end int64) error {
+	if c.out != nil {
+		last := end - c.tail
+		if to := c.segs[c.seg].to; to >= 0 && to < last {
+			last = to
+		}
+		if err := c.close(end - last); err != nil {
+			return err
+		}
+	}
+	if c.seg < len(c.segs) {
+		return ErrCutRange
+	}
+	return nil
+}
+
+// abort closes any open segment, so that what has been written is left
+// valid, and returns err
+func (c *cutter) abort(err error) error {
+	if c.out != nil {
+		c.close(0)
+	}
+	return err
+}
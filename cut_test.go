@@ -0,0 +1,182 @@
+package mp3
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/tcolgate/mp3/internal/bits"
+)
+
+// markedFrames returns n silent MPEG-1 Layer III frames, each with its
+// index in its last byte. Frame 9 takes 500 bytes of main data from the
+// frames before it.
+func markedFrames(t *testing.T, n int) []*Frame {
+	g, err := NewSilenceGenerator(FrameHeader{0xFF, 0xFB, 0x90, 0x00})
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	fs := make([]*Frame, n)
+	for i := range fs {
+		fs[i] = g.Frame()
+		fs[i].buf[len(fs[i].buf)-1] = byte(i)
+	}
+	bits.Put(fs[9].buf, 4*8, 500, 9)
+	return fs
+}
+
+// readCut returns the LAME tag of a cut, and the marks of its frames
+func readCut(t *testing.T, b []byte) (*LAMETag, []int) {
+	d := NewDecoder(bytes.NewReader(b))
+	var f Frame
+	var skipped int
+	if err := d.Decode(&f, &skipped); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	l, err := f.LAME()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	var marks []int
+	for {
+		err := d.Decode(&f, &skipped)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		marks = append(marks, int(f.buf[len(f.buf)-1]))
+	}
+	return l, marks
+}
+
+func TestCut(t *testing.T) {
+	var src bytes.Buffer
+	for _, f := range markedFrames(t, 20) {
+		src.Write(f.Bytes())
+	}
+
+	// frame 10 is primed by frame 9, whose main data begins in frames 7 and
+	// 8, and is carried by a frame ending with the main data of frame 8
+	var sb seekBuffer
+	if err := Cut(&sb, bytes.NewReader(src.Bytes()), 10*1152+100, 12*1152+50); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	l, marks := readCut(t, sb.buf)
+	if want := []int{8, 9, 10, 11, 12}; !equalInts(marks, want) {
+		t.Errorf("expected frames %v, got %v", want, marks)
+	}
+	if l.EncoderDelay != 2*1152+100-529 || l.Padding != 1152-50+529 {
+		t.Errorf("unexpected delay %d and padding %d", l.EncoderDelay, l.Padding)
+	}
+
+	// nothing precedes the first frame, so silence is added
+	sb = seekBuffer{}
+	if err := Cut(&sb, bytes.NewReader(src.Bytes()), 0, 1000); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	l, marks = readCut(t, sb.buf)
+	if want := []int{0, 0}; !equalInts(marks, want) {
+		t.Errorf("expected frames %v, got %v", want, marks)
+	}
+	if l.EncoderDelay != 1152-529 || l.Padding != 1152-1000+529 {
+		t.Errorf("unexpected delay %d and padding %d", l.EncoderDelay, l.Padding)
+	}
+
+	if err := Cut(&sb, bytes.NewReader(src.Bytes()), 30*1152, -1); err != ErrCutRange {
+		t.Errorf("expected ErrCutRange, got %v", err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	var src seekBuffer
+	w := NewWriter(&src, WithLAMETag(LAMETag{EncoderDelay: 576, Padding: 1152}))
+	for _, f := range markedFrames(t, 20) {
+		w.WriteFrame(f)
+	}
+	w.Close()
+
+	var parts []*seekBuffer
+	err := Split(bytes.NewReader(src.buf), []int64{1000, 20000}, func(i int) (io.WriteSeeker, error) {
+		if i != len(parts) {
+			t.Fatalf("part %d created out of order", i)
+		}
+		parts = append(parts, &seekBuffer{})
+		return parts[i], nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(parts))
+	}
+
+	// the parts hold the audio of the source, less its delay and padding
+	audio := []int{1000, 19000, 20*1152 - 1105 - 623 - 20000}
+	for i, p := range parts {
+		l, marks := readCut(t, p.buf)
+		got := len(marks)*1152 - l.EncoderDelay - l.Padding
+		if got != audio[i] {
+			t.Errorf("part %d: expected %d samples, got %d from %v, %+v", i, audio[i], got, marks, l)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mainData returns the main data of the frames of a stream, by the mark of
+// each frame, failing on any that is missing
+func mainData(t *testing.T, b []byte) map[int][]byte {
+	d := NewDecoder(bytes.NewReader(b))
+	var res Reservoir
+	var f Frame
+	var skipped int
+	mains := map[int][]byte{}
+	for d.Decode(&f, &skipped) == nil {
+		if f.IsStreamInfo() {
+			continue
+		}
+		m, err := res.Add(&f)
+		if err != nil {
+			t.Fatalf("frame marked %d: %v", f.buf[len(f.buf)-1], err)
+		}
+		mains[int(f.buf[len(f.buf)-1])] = append([]byte(nil), m...)
+	}
+	return mains
+}
+
+func TestCutReservoirDepth(t *testing.T) {
+	// frame 10 reaches further back than frame 9, which primes it
+	fs := markedFrames(t, 20)
+	bits.Put(fs[9].buf, 4*8, 0, 9)
+	bits.Put(fs[10].buf, 4*8, 500, 9)
+	var src bytes.Buffer
+	for _, f := range fs {
+		src.Write(f.Bytes())
+	}
+
+	var sb seekBuffer
+	if err := Cut(&sb, bytes.NewReader(src.Bytes()), 10*1152+100, 12*1152+50); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	_, marks := readCut(t, sb.buf)
+	if want := []int{8, 9, 10, 11, 12}; !equalInts(marks, want) {
+		t.Errorf("expected frames %v, got %v", want, marks)
+	}
+	want := mainData(t, src.Bytes())
+	got := mainData(t, sb.buf)
+	if !bytes.Equal(got[10], want[10]) {
+		t.Errorf("main data of frame 10 not kept")
+	}
+}
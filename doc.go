@@ -27,5 +27,10 @@
 // has also drawn from Konrad Windszus' excellent article on mp3 frame parsing
 // http://www.codeproject.com/Articles/8295/MPEG-Audio-Frame-Header
 //
-// TODO CRC isn't currently checked.
+// CRCs of protected frames are only checked when requested, see
+// WithCRCPolicy and Frame.CheckCRC.
+//
+// Decoding of frames into PCM audio is provided by the pcm package, and
+// encoding of PCM audio into frames by the encoder package. The loudness
+// package measures streams for ReplayGain.
 package mp3
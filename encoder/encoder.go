@@ -0,0 +1,370 @@
+// Package encoder encodes PCM audio into Layer II or Layer III frames. It is
+// written in pure Go, and the frames it produces can be used with the rest
+// of the mp3 package, or written out directly to form a playable stream.
+//
+// Encoding favours simplicity over quality, in the manner of the Shine
+// encoder. Layer III encoding uses only long blocks, and bits are allocated
+// by a simple psychoacoustic model, with constant bit rate output.
+package encoder
+
+import (
+	"errors"
+
+	"github.com/tcolgate/mp3"
+)
+
+type (
+	// Encoder turns interleaved 16 bit PCM samples into mp3 frames
+	Encoder struct {
+		rate      int
+		channels  int
+		layer     mp3.FrameLayer
+		bitRate   int
+		mode      mp3.FrameChannelMode
+		modeSet   bool
+		crc       bool
+		emphasis  mp3.FrameEmphasis
+		copyright bool
+		original  bool
+
+		version mp3.FrameVersion
+		rateIdx byte
+		samples int // samples per frame
+		delay   int
+
+		in      [2][]float32
+		read    int64 // samples per channel passed to Encode
+		written int64 // samples per channel encoded, including padding
+		flushed bool
+		padRest int
+
+		enc frameEncoder
+	}
+
+	// Option configures optional Encoder behaviour
+	Option func(*Encoder)
+
+	// frameEncoder encodes the frames of one layer
+	frameEncoder interface {
+		// frame encodes one frame of input, returning any frames that
+		// are complete
+		frame(in [2][]float32) ([]*mp3.Frame, error)
+		// flush returns any frames still held by the encoder
+		flush() []*mp3.Frame
+	}
+)
+
+var (
+	// ErrSampleRate indicates that no MPEG version supports the requested
+	// sample rate
+	ErrSampleRate = errors.New("encoder: unsupported sample rate")
+
+	// ErrChannels indicates that the channel count is not 1 or 2, or does
+	// not match the requested channel mode
+	ErrChannels = errors.New("encoder: unsupported channel count or mode")
+
+	// ErrBitRate indicates that the requested bit rate is not legal for the
+	// MPEG version used at the requested sample rate, or for the layer and
+	// channel mode
+	ErrBitRate = errors.New("encoder: unsupported bit rate")
+
+	// ErrLayer indicates that the requested layer cannot be encoded
+	ErrLayer = errors.New("encoder: unsupported layer")
+
+	// ErrEmphasis indicates that the requested emphasis is reserved
+	ErrEmphasis = errors.New("encoder: invalid emphasis")
+
+	// ErrFlushed indicates that Encode or Flush was called after Flush
+	ErrFlushed = errors.New("encoder: already flushed")
+)
+
+// WithLayer sets the layer to encode, mp3.Layer2 or mp3.Layer3. The default
+// is mp3.Layer3.
+func WithLayer(l mp3.FrameLayer) Option {
+	return func(e *Encoder) {
+		e.layer = l
+	}
+}
+
+// WithBitRate sets the bit rate in kbit/s. The default is 128 for Layer III
+// and 192 for Layer II at MPEG-1 sample rates, and 64 for the lower sample
+// rates of MPEG-2 and MPEG-2.5.
+func WithBitRate(kbps int) Option {
+	return func(e *Encoder) {
+		e.bitRate = kbps
+	}
+}
+
+// WithChannelMode sets the channel mode of stereo input. The default is
+// mp3.JointStereo for Layer III, which uses mid/side stereo where it helps,
+// and mp3.Stereo for Layer II, where joint stereo codes the upper half of
+// the subbands as intensity stereo. Mono input is always encoded as
+// mp3.SingleChannel.
+func WithChannelMode(m mp3.FrameChannelMode) Option {
+	return func(e *Encoder) {
+		e.mode, e.modeSet = m, true
+	}
+}
+
+// WithCRC enables CRC protection of the frames
+func WithCRC() Option {
+	return func(e *Encoder) {
+		e.crc = true
+	}
+}
+
+// WithEmphasis sets the emphasis flag of the frame headers. The audio is
+// expected to have had the emphasis applied already.
+func WithEmphasis(em mp3.FrameEmphasis) Option {
+	return func(e *Encoder) {
+		e.emphasis = em
+	}
+}
+
+// WithCopyright sets the copyright flag of the frame headers
+func WithCopyright() Option {
+	return func(e *Encoder) {
+		e.copyright = true
+	}
+}
+
+// WithOriginal sets the original flag of the frame headers
+func WithOriginal() Option {
+	return func(e *Encoder) {
+		e.original = true
+	}
+}
+
+// New returns an Encoder for PCM at the given sample rate, in Hz, with 1 or
+// 2 channels. The MPEG version is chosen to suit the sample rate.
+func New(sampleRate, channels int, opts ...Option) (*Encoder, error) {
+	e := &Encoder{rate: sampleRate, channels: channels, layer: mp3.Layer3}
+	for _, o := range opts {
+		o(e)
+	}
+	if e.layer != mp3.Layer2 && e.layer != mp3.Layer3 {
+		return nil, ErrLayer
+	}
+	if e.emphasis >= mp3.EmphMax || e.emphasis == mp3.EmphReserved {
+		return nil, ErrEmphasis
+	}
+	if !e.modeSet {
+		switch {
+		case channels == 1:
+			e.mode = mp3.SingleChannel
+		case e.layer == mp3.Layer2:
+			e.mode = mp3.Stereo
+		default:
+			e.mode = mp3.JointStereo
+		}
+	}
+
+	if !e.findRate() {
+		return nil, ErrSampleRate
+	}
+	if channels < 1 || channels > 2 || (channels == 1) != (e.mode == mp3.SingleChannel) || e.mode >= mp3.ChannelModeMax {
+		return nil, ErrChannels
+	}
+	if e.bitRate == 0 {
+		switch {
+		case e.version != mp3.MPEG1:
+			e.bitRate = 64
+		case e.layer == mp3.Layer2:
+			e.bitRate = 192
+		default:
+			e.bitRate = 128
+		}
+	}
+	if _, ok := e.bitRateIndex(); !ok {
+		return nil, ErrBitRate
+	}
+
+	if e.layer == mp3.Layer2 {
+		if !layer2Allowed(e.version, e.bitRate, e.mode) {
+			return nil, ErrBitRate
+		}
+		e.samples = 1152
+		e.delay = layer2Delay
+		e.enc = newLayer2Encoder(e)
+		return e, nil
+	}
+	e.samples = 1152
+	if e.version != mp3.MPEG1 {
+		e.samples = 576
+	}
+	e.delay = layer3Delay
+	e.enc = newLayer3Encoder(e)
+	return e, nil
+}
+
+// findRate selects the MPEG version and sample rate index for the sample
+// rate of the encoder
+func (e *Encoder) findRate() bool {
+	for _, v := range []mp3.FrameVersion{mp3.MPEG1, mp3.MPEG2, mp3.MPEG25} {
+		for i := byte(0); i < 3; i++ {
+			h := mp3.FrameHeader{0xFF, 0xE0 | byte(v)<<3 | byte(e.layer)<<1, i << 2, 0}
+			if int(h.SampleRate()) == e.rate {
+				e.version, e.rateIdx = v, i
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bitRateIndex gives the header bit rate index of the bit rate of the
+// encoder
+func (e *Encoder) bitRateIndex() (byte, bool) {
+	for i := byte(1); i < 15; i++ {
+		h := e.header(i, false, 0)
+		if int(h.BitRate()) == e.bitRate*1000 {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// header builds a frame header with the given bit rate index, padding and
+// mode extension
+func (e *Encoder) header(brIdx byte, pad bool, modeExt byte) mp3.FrameHeader {
+	h := mp3.FrameHeader{0xFF, 0xE0, 0, 0}
+	h[1] |= byte(e.version)<<3 | byte(e.layer)<<1
+	if !e.crc {
+		h[1] |= 0x01
+	}
+	h[2] = brIdx<<4 | e.rateIdx<<2
+	if pad {
+		h[2] |= 0x02
+	}
+	h[3] = byte(e.mode)<<6 | modeExt<<4 | byte(e.emphasis)
+	if e.copyright {
+		h[3] |= 0x08
+	}
+	if e.original {
+		h[3] |= 0x04
+	}
+	return h
+}
+
+// nextHeader returns the header of the next frame, padding frames as needed
+// to hold the bit rate
+func (e *Encoder) nextHeader(modeExt byte) mp3.FrameHeader {
+	idx, _ := e.bitRateIndex()
+	e.padRest += (e.samples / 8 * e.bitRate * 1000) % e.rate
+	pad := e.padRest >= e.rate
+	if pad {
+		e.padRest -= e.rate
+	}
+	return e.header(idx, pad, modeExt)
+}
+
+// frameSize gives the size in bytes of a frame with header h
+func (e *Encoder) frameSize(h mp3.FrameHeader) int {
+	n := e.samples / 8 * int(h.BitRate()) / int(h.SampleRate())
+	if h.Pad() {
+		n++
+	}
+	return n
+}
+
+// setCRC stores the CRC of the protected frame in buf
+func setCRC(buf []byte) error {
+	f, err := mp3.NewFrame(buf)
+	if err != nil {
+		return err
+	}
+	crc, err := f.ComputeCRC()
+	if err != nil {
+		return err
+	}
+	buf[4], buf[5] = byte(crc>>8), byte(crc)
+	return nil
+}
+
+// SampleRate returns the sample rate of the input, in Hz
+func (e *Encoder) SampleRate() int {
+	return e.rate
+}
+
+// Channels returns the number of interleaved input channels
+func (e *Encoder) Channels() int {
+	return e.channels
+}
+
+// Delay returns the number of samples of silence that precede the encoded
+// audio once it has been decoded
+func (e *Encoder) Delay() int {
+	return e.delay
+}
+
+// Padding returns the number of samples of silence that follow the encoded
+// audio once it has been decoded. It is only valid after Flush.
+func (e *Encoder) Padding() int {
+	return int(e.written - e.read - int64(e.delay))
+}
+
+// Samples returns the number of samples per channel passed to Encode
+func (e *Encoder) Samples() int64 {
+	return e.read
+}
+
+// Encode adds interleaved samples to the encoder, returning any frames that
+// are complete. Frames are returned in stream order, but lag the input, as
+// later audio may be stored in the bit reservoir of earlier frames.
+func (e *Encoder) Encode(pcm []int16) ([]*mp3.Frame, error) {
+	if e.flushed {
+		return nil, ErrFlushed
+	}
+	n := len(pcm) / e.channels
+	for ch := 0; ch < e.channels; ch++ {
+		for i := 0; i < n; i++ {
+			e.in[ch] = append(e.in[ch], float32(pcm[i*e.channels+ch])/32768)
+		}
+	}
+	e.read += int64(n)
+	return e.encode()
+}
+
+// Flush encodes any remaining input, padded with silence, and returns the
+// final frames. The Encoder may not be used after Flush.
+func (e *Encoder) Flush() ([]*mp3.Frame, error) {
+	if e.flushed {
+		return nil, ErrFlushed
+	}
+	e.flushed = true
+
+	// whole frames of silence, enough to push the last sample through the
+	// filterbanks
+	for len(e.in[0])%e.samples != 0 || e.written+int64(len(e.in[0])) < e.read+int64(e.delay) {
+		n := e.samples - len(e.in[0])%e.samples
+		for ch := 0; ch < e.channels; ch++ {
+			e.in[ch] = append(e.in[ch], make([]float32, n)...)
+		}
+	}
+	fs, err := e.encode()
+	if err != nil {
+		return fs, err
+	}
+	return append(fs, e.enc.flush()...), nil
+}
+
+// encode encodes every whole frame of buffered input
+func (e *Encoder) encode() ([]*mp3.Frame, error) {
+	var fs []*mp3.Frame
+	for len(e.in[0]) >= e.samples {
+		var in [2][]float32
+		for ch := 0; ch < e.channels; ch++ {
+			in[ch] = e.in[ch][:e.samples]
+		}
+		out, err := e.enc.frame(in)
+		if err != nil {
+			return fs, err
+		}
+		fs = append(fs, out...)
+		for ch := 0; ch < e.channels; ch++ {
+			e.in[ch] = e.in[ch][e.samples:]
+		}
+		e.written += int64(e.samples)
+	}
+	return fs, nil
+}
@@ -0,0 +1,178 @@
+package encoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/tcolgate/mp3"
+	"github.com/tcolgate/mp3/pcm"
+)
+
+// tone returns n samples per channel of a sine at freq Hz, each channel
+// offset in phase
+func tone(n, channels, rate int, freq float64) []int16 {
+	s := make([]int16, n*channels)
+	for i := 0; i < n; i++ {
+		for ch := 0; ch < channels; ch++ {
+			s[i*channels+ch] = int16(16000 * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)+float64(ch)))
+		}
+	}
+	return s
+}
+
+func encodeAll(t *testing.T, e *Encoder, in []int16) []*mp3.Frame {
+	fs, err := e.Encode(in)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	rest, err := e.Flush()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	return append(fs, rest...)
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, c := range []struct{ rate, channels int }{{44100, 1}, {48000, 2}, {22050, 2}} {
+		e, err := New(c.rate, c.channels)
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		n := c.rate
+		in := tone(n, c.channels, c.rate, 1000)
+		var buf bytes.Buffer
+		for _, f := range encodeAll(t, e, in) {
+			buf.Write(f.Bytes())
+		}
+
+		b, err := ioutil.ReadAll(pcm.NewReader(mp3.NewDecoder(&buf), pcm.Int16))
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		out := make([]int16, len(b)/2)
+		binary.Read(bytes.NewReader(b), binary.LittleEndian, out)
+		if want := (e.Delay() + n + e.Padding()) * c.channels; len(out) != want {
+			t.Fatalf("%d Hz: expected %d samples, got %d", c.rate, want, len(out))
+		}
+
+		var sig, noise float64
+		for i := 0; i < n*c.channels; i++ {
+			x, y := float64(in[i]), float64(out[i+e.Delay()*c.channels])
+			sig += x * x
+			noise += (x - y) * (x - y)
+		}
+		if snr := 10 * math.Log10(sig/noise); snr < 30 {
+			t.Errorf("%d Hz: expected SNR above 30dB, got %.1fdB", c.rate, snr)
+		}
+	}
+}
+
+func TestEncodeBitRates(t *testing.T) {
+	rates := map[int][]int{
+		44100: {32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		24000: {8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		11025: {8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	for rate, brs := range rates {
+		for _, br := range brs {
+			e, err := New(rate, 2, WithBitRate(br), WithCRC())
+			if err != nil {
+				t.Fatalf("%d Hz %d kbit/s: unexpected error, %v", rate, br, err)
+			}
+			var d pcm.FrameDecoder
+			for i, f := range encodeAll(t, e, tone(4608, 2, rate, 440)) {
+				if got := int(f.Header().BitRate()); got != br*1000 {
+					t.Fatalf("%d Hz %d kbit/s: frame %d has bit rate %d", rate, br, i, got)
+				}
+				if err := f.CheckCRC(); err != nil {
+					t.Fatalf("%d Hz %d kbit/s: frame %d, %v", rate, br, i, err)
+				}
+				if _, err := d.Decode(f); err != nil {
+					t.Fatalf("%d Hz %d kbit/s: frame %d, %v", rate, br, i, err)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeLayer2(t *testing.T) {
+	for _, c := range []struct {
+		rate, channels, kbps int
+		mode                 mp3.FrameChannelMode
+	}{
+		{48000, 1, 192, mp3.SingleChannel},
+		{44100, 2, 256, mp3.Stereo},
+		{44100, 2, 192, mp3.JointStereo},
+		{24000, 2, 96, mp3.DualChannel},
+	} {
+		e, err := New(c.rate, c.channels, WithLayer(mp3.Layer2), WithBitRate(c.kbps), WithChannelMode(c.mode),
+			WithCRC(), WithEmphasis(mp3.Emph5015), WithCopyright(), WithOriginal())
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		in := tone(c.rate, c.channels, c.rate, 1000)
+		var d pcm.FrameDecoder
+		var out [2][]float32
+		for i, f := range encodeAll(t, e, in) {
+			h := f.Header()
+			if h.Layer() != mp3.Layer2 || h.ChannelMode() != c.mode || int(h.BitRate()) != c.kbps*1000 {
+				t.Fatalf("frame %d has unexpected header\n%v", i, h)
+			}
+			if h.Emphasis() != mp3.Emph5015 || !h.CopyRight() || !h.Original() {
+				t.Fatalf("frame %d has unexpected flags\n%v", i, h)
+			}
+			if err := f.CheckCRC(); err != nil {
+				t.Fatalf("frame %d, %v", i, err)
+			}
+			pcm, err := d.Decode(f)
+			if err != nil {
+				t.Fatalf("frame %d, %v", i, err)
+			}
+			for ch := range pcm {
+				out[ch] = append(out[ch], pcm[ch]...)
+			}
+		}
+
+		// skip the abrupt start and end of the tone, which are hard to code
+		var sig, noise float64
+		for i := 2304; i < c.rate-2304; i++ {
+			for ch := 0; ch < c.channels; ch++ {
+				x := float64(in[i*c.channels+ch]) / 32768
+				y := float64(out[ch][i+e.Delay()])
+				sig += x * x
+				noise += (x - y) * (x - y)
+			}
+		}
+		if snr := 10 * math.Log10(sig/noise); snr < 30 {
+			t.Errorf("%+v: expected SNR above 30dB, got %.1fdB", c, snr)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, err := New(44000, 2); err != ErrSampleRate {
+		t.Errorf("expected ErrSampleRate, got %v", err)
+	}
+	if _, err := New(44100, 3); err != ErrChannels {
+		t.Errorf("expected ErrChannels, got %v", err)
+	}
+	if _, err := New(44100, 1, WithChannelMode(mp3.Stereo)); err != ErrChannels {
+		t.Errorf("expected ErrChannels, got %v", err)
+	}
+	if _, err := New(44100, 2, WithBitRate(8)); err != ErrBitRate {
+		t.Errorf("expected ErrBitRate, got %v", err)
+	}
+	// MPEG-1 Layer II does not allow 56kbit/s stereo, or 256kbit/s mono
+	if _, err := New(44100, 2, WithLayer(mp3.Layer2), WithBitRate(56)); err != ErrBitRate {
+		t.Errorf("expected ErrBitRate, got %v", err)
+	}
+	if _, err := New(44100, 1, WithLayer(mp3.Layer2), WithBitRate(256)); err != ErrBitRate {
+		t.Errorf("expected ErrBitRate, got %v", err)
+	}
+	if _, err := New(44100, 2, WithLayer(mp3.Layer1)); err != ErrLayer {
+		t.Errorf("expected ErrLayer, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package encoder
+
+import (
+	"github.com/tcolgate/mp3/internal/bits"
+	"github.com/tcolgate/mp3/internal/layer3"
+)
+
+// pairBits counts the bits table t needs to code the pairs of values in ix,
+// including linbits and signs
+func pairBits(t *layer3.HuffTable, ix []int) int {
+	n := 0
+	for i := 0; i < len(ix); i += 2 {
+		x, y := abs(ix[i]), abs(ix[i+1])
+		if x > 14 && t.Linbits > 0 {
+			x = 15
+			n += t.Linbits
+		}
+		if y > 14 && t.Linbits > 0 {
+			y = 15
+			n += t.Linbits
+		}
+		n += int(t.Lens[x*t.Dim+y])
+		if x != 0 {
+			n++
+		}
+		if y != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// quadBits counts the bits table t needs to code the quadruple of count1
+// values in q, including signs
+func quadBits(t *layer3.HuffTable, q []int) int {
+	v, n := 0, 0
+	for _, x := range q {
+		v <<= 1
+		if x != 0 {
+			v |= 1
+			n++
+		}
+	}
+	return n + int(t.Lens[v])
+}
+
+// chooseTable picks the big values table that codes ix in the fewest bits,
+// returning the table and the bits it needs
+func chooseTable(ix []int) (int, int) {
+	max := 0
+	for _, v := range ix {
+		if v = abs(v); v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		return 0, 0
+	}
+
+	best, bits := 0, -1
+	try := func(i int) {
+		if n := pairBits(&layer3.BigValueTables[i], ix); bits < 0 || n < bits {
+			best, bits = i, n
+		}
+	}
+
+	if max < 16 {
+		for i := 1; i < 16; i++ {
+			t := &layer3.BigValueTables[i]
+			if t.Codes != nil && t.Dim > max {
+				try(i)
+			}
+		}
+		return best, bits
+	}
+
+	// of the tables with linbits, the smallest linbits that can code max
+	// are the cheapest in each of the two families
+	for _, first := range []int{16, 24} {
+		for i := first; i < first+8; i++ {
+			if 15+1<<uint(layer3.BigValueTables[i].Linbits)-1 >= max {
+				try(i)
+				break
+			}
+		}
+	}
+	return best, bits
+}
+
+// write writes the scalefactors and Huffman coded lines of the granule to w
+func (g *granule) write(w *bits.Writer) {
+	if g.mpeg1 {
+		for b := 0; b < 21; b++ {
+			if b < 11 {
+				w.Write(uint32(g.sf[b]), g.slen[0])
+			} else {
+				w.Write(uint32(g.sf[b]), g.slen[1])
+			}
+		}
+	} else {
+		sfb := 0
+		for p, n := range layer3.NrOfSfb[0][0] {
+			for i := 0; i < n; i++ {
+				w.Write(uint32(g.sf[sfb]), g.slen[p])
+				sfb++
+			}
+		}
+	}
+
+	big := g.info.BigValues * 2
+	l := &g.bt.Long
+	a1, a2 := l[g.info.Region0Count+1], l[g.info.Region0Count+g.info.Region1Count+2]
+	for i := 0; i < big; i += 2 {
+		t := g.info.TableSelect[0]
+		switch {
+		case i >= a2:
+			t = g.info.TableSelect[2]
+		case i >= a1:
+			t = g.info.TableSelect[1]
+		}
+		writePair(w, &layer3.BigValueTables[t], g.ix[i], g.ix[i+1])
+	}
+
+	end := 576
+	for end > big && g.ix[end-1] == 0 && g.ix[end-2] == 0 {
+		end -= 2
+	}
+	t := &layer3.Count1Tables[g.info.Count1TableSelect]
+	for i := big; i < end; i += 4 {
+		v := 0
+		for _, x := range g.ix[i : i+4] {
+			v <<= 1
+			if x != 0 {
+				v |= 1
+			}
+		}
+		w.Write(uint32(t.Codes[v]), int(t.Lens[v]))
+		for _, x := range g.ix[i : i+4] {
+			if x != 0 {
+				w.Bit(x < 0)
+			}
+		}
+	}
+}
+
+// writePair writes a pair of big values with table t
+func writePair(w *bits.Writer, t *layer3.HuffTable, x, y int) {
+	if t.Codes == nil {
+		return
+	}
+	ax, ay := abs(x), abs(y)
+	cx, cy := ax, ay
+	if t.Linbits > 0 {
+		if cx > 14 {
+			cx = 15
+		}
+		if cy > 14 {
+			cy = 15
+		}
+	}
+	v := cx*t.Dim + cy
+	w.Write(uint32(t.Codes[v]), int(t.Lens[v]))
+	for _, p := range [2][2]int{{x, cx}, {y, cy}} {
+		if p[1] == 15 && t.Linbits > 0 {
+			w.Write(uint32(abs(p[0])-15), t.Linbits)
+		}
+		if p[0] != 0 {
+			w.Bit(p[0] < 0)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package encoder
+
+import (
+	"math"
+
+	"github.com/tcolgate/mp3"
+	"github.com/tcolgate/mp3/internal/bits"
+	"github.com/tcolgate/mp3/internal/filterbank"
+	"github.com/tcolgate/mp3/internal/layer2"
+)
+
+// layer2Delay is the delay, in samples, of the analysis filterbank followed
+// by the decoder's synthesis filterbank
+const layer2Delay = 481
+
+// layer2Tonality is the tonality assumed for every subband, as the subband
+// samples are too coarse to measure it
+const layer2Tonality = 0.5
+
+type (
+	// layer2Encoder holds the Layer II encoder state carried between frames
+	layer2Encoder struct {
+		e     *Encoder
+		table *layer2.AllocTable
+		bound int // first intensity stereo subband
+		ext   byte
+
+		analysis [2]filterbank.Analysis
+
+		// per frame state, held here to avoid reallocation
+		smp   [3][36][32]float32 // the third channel holds the intensity samples
+		scale [3][32][3]int
+		scfsi [2][32]int
+		alloc [2][32]int
+		xmin  [2][32]float64
+		en    [2][32]float64
+	}
+)
+
+// scaleFactors holds the Layer I and II scalefactors
+var scaleFactors [63]float64
+
+func init() {
+	for i := range scaleFactors {
+		scaleFactors[i] = math.Exp2(1 - float64(i)/3)
+	}
+}
+
+// layer2Allowed reports whether an MPEG-1 Layer II stream may use the bit
+// rate, in kbit/s, with the channel mode. MPEG-2 allows every combination.
+func layer2Allowed(v mp3.FrameVersion, kbps int, m mp3.FrameChannelMode) bool {
+	if v != mp3.MPEG1 {
+		return true
+	}
+	if m == mp3.SingleChannel {
+		return kbps <= 192
+	}
+	switch kbps {
+	case 32, 48, 56, 80:
+		return false
+	}
+	return true
+}
+
+func newLayer2Encoder(e *Encoder) *layer2Encoder {
+	l := &layer2Encoder{e: e}
+	l.table = layer2.Select(e.version != mp3.MPEG1, e.bitRate/e.channels, e.rate)
+	l.bound = l.table.SBLimit
+	if e.mode == mp3.JointStereo {
+		// the upper subbands, from subband 16, are coded as intensity
+		// stereo
+		l.ext = 3
+		if l.bound > 16 {
+			l.bound = 16
+		}
+	}
+	return l
+}
+
+// frame encodes one frame of input
+func (l *layer2Encoder) frame(in [2][]float32) ([]*mp3.Frame, error) {
+	nch := l.e.channels
+	t := l.table
+	for ch := 0; ch < nch; ch++ {
+		for s := 0; s < 36; s++ {
+			l.analysis[ch].Filter(in[ch][s*32:s*32+32], &l.smp[ch][s])
+		}
+	}
+	if nch == 2 {
+		for s := 0; s < 36; s++ {
+			for sb := l.bound; sb < t.SBLimit; sb++ {
+				l.smp[2][s][sb] = (l.smp[0][s][sb] + l.smp[1][s][sb]) / 2
+			}
+		}
+	}
+
+	for ch := 0; ch < nch; ch++ {
+		l.scalefactors(ch)
+		l.model(ch)
+	}
+	if nch == 2 {
+		l.scalefactors(2)
+	}
+
+	h := l.e.nextHeader(l.ext)
+	size := l.e.frameSize(h)
+	off := 4
+	if l.e.crc {
+		off += 2
+	}
+	l.allocate(size*8 - off*8)
+
+	w := bits.NewWriter(nil)
+	l.write(w)
+	buf := make([]byte, size)
+	copy(buf, h)
+	copy(buf[off:], w.Bytes())
+
+	if l.e.crc {
+		if err := setCRC(buf); err != nil {
+			return nil, err
+		}
+	}
+	f, err := mp3.NewFrame(buf)
+	if err != nil {
+		return nil, err
+	}
+	return []*mp3.Frame{f}, nil
+}
+
+// flush returns nothing, as Layer II frames are complete as soon as they
+// are encoded
+func (l *layer2Encoder) flush() []*mp3.Frame {
+	return nil
+}
+
+// scalefactors chooses the scalefactors of each subband and part of the
+// frame for channel ch, and how they are shared between parts
+func (l *layer2Encoder) scalefactors(ch int) {
+	for sb := 0; sb < l.table.SBLimit; sb++ {
+		var sc [3]int
+		for p := 0; p < 3; p++ {
+			var max float64
+			for s := p * 12; s < p*12+12; s++ {
+				max = math.Max(max, math.Abs(float64(l.smp[ch][s][sb])))
+			}
+			sc[p] = scaleIndex(max)
+		}
+		if ch == 2 {
+			// the intensity samples are normalised but not transmitted
+			l.scale[ch][sb] = sc
+			continue
+		}
+
+		// share scalefactors between parts that differ by at most one step,
+		// using the larger of the two
+		near := func(a, b int) bool { return a-b <= 1 && b-a <= 1 }
+		switch {
+		case near(sc[0], sc[1]) && near(sc[1], sc[2]) && near(sc[0], sc[2]):
+			m := minInt(sc[0], minInt(sc[1], sc[2]))
+			sc = [3]int{m, m, m}
+			l.scfsi[ch][sb] = 2
+		case near(sc[0], sc[1]):
+			m := minInt(sc[0], sc[1])
+			sc = [3]int{m, m, sc[2]}
+			l.scfsi[ch][sb] = 1
+		case near(sc[1], sc[2]):
+			m := minInt(sc[1], sc[2])
+			sc = [3]int{sc[0], m, m}
+			l.scfsi[ch][sb] = 3
+		default:
+			l.scfsi[ch][sb] = 0
+		}
+		l.scale[ch][sb] = sc
+	}
+}
+
+// scaleIndex gives the index of the smallest scalefactor no smaller than v
+func scaleIndex(v float64) int {
+	if v <= 0 {
+		return 62
+	}
+	i := int(3 * (1 - math.Log2(v)))
+	if i > 62 {
+		i = 62
+	}
+	for i > 0 && scaleFactors[i] < v {
+		i--
+	}
+	for i < 62 && scaleFactors[i+1] >= v {
+		i++
+	}
+	return i
+}
+
+// model runs the psychoacoustic model over the subbands of channel ch
+func (l *layer2Encoder) model(ch int) {
+	rate := float64(l.e.rate)
+	var bark, tonality, ath [32]float64
+	for sb := 0; sb < 32; sb++ {
+		var e float64
+		for s := 0; s < 36; s++ {
+			v := float64(l.smp[ch][s][sb])
+			e += v * v
+		}
+		l.en[ch][sb] = 2 * e / 36
+		bark[sb] = barkScale((float64(sb) + 0.5) * rate / 64)
+		tonality[sb] = layer2Tonality
+		ath[sb] = athRange(float64(sb)*rate/64, float64(sb+1)*rate/64)
+	}
+	mask(l.en[ch][:], bark[:], tonality[:], ath[:], l.xmin[ch][:])
+}
+
+// noise estimates the quantisation noise of channel ch in subband sb with
+// allocation a
+func (l *layer2Encoder) noise(ch, sb, a int) float64 {
+	if a == 0 {
+		return l.en[ch][sb]
+	}
+	levels := float64(layer2.QuantClasses[l.table.Class[sb][a-1]].Levels)
+	var sf float64
+	for _, i := range l.scale[ch][sb] {
+		sf += scaleFactors[i] * scaleFactors[i] / 3
+	}
+	return 2 * sf * 4 / (levels * levels) / 12
+}
+
+// sampleBits gives the bits used by the 36 samples of a subband with
+// allocation a
+func (l *layer2Encoder) sampleBits(sb, a int) int {
+	if a == 0 {
+		return 0
+	}
+	q := layer2.QuantClasses[l.table.Class[sb][a-1]]
+	if q.Grouped {
+		return 12 * q.Bits
+	}
+	return 36 * q.Bits
+}
+
+// scaleBits gives the bits used by the scalefactor selection and
+// scalefactors of channel ch in subband sb
+func (l *layer2Encoder) scaleBits(ch, sb int) int {
+	switch l.scfsi[ch][sb] {
+	case 0:
+		return 2 + 18
+	case 2:
+		return 2 + 6
+	}
+	return 2 + 12
+}
+
+// allocate distributes the bits of the frame between the subbands, each
+// time raising the allocation of the subband with the worst noise to mask
+// ratio, until no more bits remain
+func (l *layer2Encoder) allocate(avail int) {
+	nch := l.e.channels
+	t := l.table
+	for sb := 0; sb < t.SBLimit; sb++ {
+		n := nch
+		if sb >= l.bound {
+			n = 1
+		}
+		avail -= n * t.NBal[sb]
+	}
+	l.alloc = [2][32]int{}
+
+	for {
+		best, bestCh, bestCost := -1, 0, 0
+		var worst float64
+		for sb := 0; sb < t.SBLimit; sb++ {
+			for ch := 0; ch < nch; ch++ {
+				if sb >= l.bound && ch > 0 {
+					break
+				}
+				a := l.alloc[ch][sb]
+				if a == 1<<uint(t.NBal[sb])-1 {
+					continue
+				}
+				chans := []int{ch}
+				if sb >= l.bound && nch == 2 {
+					chans = []int{0, 1}
+				}
+				cost := l.sampleBits(sb, a+1) - l.sampleBits(sb, a)
+				var nmr float64
+				for _, c := range chans {
+					if a == 0 {
+						cost += l.scaleBits(c, sb)
+					}
+					if l.en[c][sb] > 0 {
+						nmr = math.Max(nmr, l.noise(c, sb, a)/l.xmin[c][sb])
+					}
+				}
+				if nmr > 0 && cost <= avail && (best < 0 || nmr > worst) {
+					best, bestCh, bestCost, worst = sb, ch, cost, nmr
+				}
+			}
+		}
+		if best < 0 {
+			break
+		}
+		l.alloc[bestCh][best]++
+		if best >= l.bound && nch == 2 {
+			l.alloc[1][best] = l.alloc[0][best]
+		}
+		avail -= bestCost
+	}
+}
+
+// write writes the bit allocation, scalefactors and samples of the frame
+func (l *layer2Encoder) write(w *bits.Writer) {
+	nch := l.e.channels
+	t := l.table
+	for sb := 0; sb < t.SBLimit; sb++ {
+		for ch := 0; ch < nch; ch++ {
+			if sb >= l.bound && ch > 0 {
+				continue
+			}
+			w.Write(uint32(l.alloc[ch][sb]), t.NBal[sb])
+		}
+	}
+	for sb := 0; sb < t.SBLimit; sb++ {
+		for ch := 0; ch < nch; ch++ {
+			if l.alloc[ch][sb] != 0 {
+				w.Write(uint32(l.scfsi[ch][sb]), 2)
+			}
+		}
+	}
+	for sb := 0; sb < t.SBLimit; sb++ {
+		for ch := 0; ch < nch; ch++ {
+			if l.alloc[ch][sb] == 0 {
+				continue
+			}
+			sc := l.scale[ch][sb]
+			switch l.scfsi[ch][sb] {
+			case 0:
+				w.Write(uint32(sc[0]), 6)
+				w.Write(uint32(sc[1]), 6)
+				w.Write(uint32(sc[2]), 6)
+			case 1:
+				w.Write(uint32(sc[0]), 6)
+				w.Write(uint32(sc[2]), 6)
+			case 2:
+				w.Write(uint32(sc[0]), 6)
+			case 3:
+				w.Write(uint32(sc[0]), 6)
+				w.Write(uint32(sc[1]), 6)
+			}
+		}
+	}
+
+	for gr := 0; gr < 12; gr++ {
+		for sb := 0; sb < t.SBLimit; sb++ {
+			for ch := 0; ch < nch; ch++ {
+				a := l.alloc[ch][sb]
+				if a == 0 || (sb >= l.bound && ch > 0) {
+					continue
+				}
+				src := ch
+				if sb >= l.bound && nch == 2 {
+					src = 2
+				}
+				sf := scaleFactors[l.scale[src][sb][gr/4]]
+				q := layer2.QuantClasses[t.Class[sb][a-1]]
+				var c [3]int
+				for s := 0; s < 3; s++ {
+					c[s] = quantize12(float64(l.smp[src][gr*3+s][sb])/sf, q.Levels)
+				}
+				if q.Grouped {
+					w.Write(uint32(c[0]+q.Levels*(c[1]+q.Levels*c[2])), q.Bits)
+					continue
+				}
+				for s := 0; s < 3; s++ {
+					w.Write(uint32(c[s]), q.Bits)
+				}
+			}
+		}
+	}
+}
+
+// quantize12 maps a fraction in [-1, 1] to the code of a quantiser with the
+// given number of levels
+func quantize12(x float64, levels int) int {
+	c := int((x + 1) * float64(levels) / 2)
+	if c < 0 {
+		return 0
+	}
+	if c >= levels {
+		return levels - 1
+	}
+	return c
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,345 @@
+package encoder
+
+import (
+	"math"
+
+	"github.com/tcolgate/mp3"
+	"github.com/tcolgate/mp3/internal/bits"
+	"github.com/tcolgate/mp3/internal/filterbank"
+	"github.com/tcolgate/mp3/internal/layer3"
+)
+
+// layer3Delay is the delay, in samples, of the analysis filterbank and MDCT
+// followed by the decoder's IMDCT and synthesis filterbank
+const layer3Delay = 576 + layer2Delay
+
+type (
+	// layer3Encoder holds the Layer III encoder state carried between frames
+	layer3Encoder struct {
+		e        *Encoder
+		bands    *layer3.Bands
+		granules int
+		lowpass  int // first line removed by the lowpass filter
+
+		analysis [2]filterbank.Analysis
+		prev     [2][18][32]float32 // subband samples of the previous granule
+
+		xr  [2][2][576]float32
+		psy [2][2]threshold
+		gi  [2][2]granule
+
+		maxBegin int
+		// main holds main data not yet copied into a frame, starting at
+		// byte offset base of the main data stream. slots is the total size
+		// of the main data slots of every frame built so far.
+		main    []byte
+		base    int
+		slots   int
+		pending []pendingFrame
+	}
+
+	// pendingFrame is a frame whose main data slot may still receive the
+	// main data of later frames
+	pendingFrame struct {
+		buf   []byte
+		start int // offset of the slot within the main data stream
+		off   int // offset of the slot within buf
+	}
+)
+
+// lowpassTable gives the lowpass frequency used for each bit rate per
+// channel, in kbit/s
+var lowpassTable = []struct{ kbps, freq int }{
+	{8, 2000}, {16, 3700}, {24, 5500}, {32, 7000}, {40, 9000}, {48, 11000},
+	{56, 13000}, {64, 15000}, {80, 17000}, {96, 18500}, {112, 19500},
+	{128, 20000}, {160, 20500},
+}
+
+func newLayer3Encoder(e *Encoder) *layer3Encoder {
+	l := &layer3Encoder{
+		e:        e,
+		bands:    &layer3.SFBands[layer3.BandIndex(int(e.rateIdx), e.version == mp3.MPEG2, e.version == mp3.MPEG25)],
+		granules: 2,
+		maxBegin: 511,
+	}
+	if e.version != mp3.MPEG1 {
+		l.granules = 1
+		l.maxBegin = 255
+	}
+
+	kbps := e.bitRate / e.channels
+	freq := lowpassTable[len(lowpassTable)-1].freq
+	for _, lp := range lowpassTable {
+		if kbps <= lp.kbps {
+			freq = lp.freq
+			break
+		}
+	}
+	l.lowpass = freq * 1152 / e.rate
+	if l.lowpass > 576 {
+		l.lowpass = 576
+	}
+	return l
+}
+
+// frame encodes one frame of input, returning any frames whose main data
+// slots are now complete
+func (l *layer3Encoder) frame(in [2][]float32) ([]*mp3.Frame, error) {
+	nch := l.e.channels
+	for gr := 0; gr < l.granules; gr++ {
+		for ch := 0; ch < nch; ch++ {
+			l.transform(ch, in[ch][gr*576:], &l.xr[gr][ch])
+		}
+	}
+
+	var modeExt byte
+	if l.e.mode == mp3.JointStereo && l.useMidSide() {
+		modeExt = 2
+		for gr := 0; gr < l.granules; gr++ {
+			midSide(&l.xr[gr][0], &l.xr[gr][1])
+		}
+	}
+
+	h := l.e.nextHeader(modeExt)
+	size := l.e.frameSize(h)
+	sideLen := sideInfoLength(l.e.version, nch)
+	off := 4 + sideLen
+	if l.e.crc {
+		off += 2
+	}
+	slot := size - off
+
+	// main data starts as far back as the reservoir and main_data_begin
+	// allow, anything beyond that is stuffed
+	free := l.slots - (l.base + len(l.main))
+	if free > l.maxBegin {
+		l.main = append(l.main, make([]byte, free-l.maxBegin)...)
+		free = l.maxBegin
+	}
+	begin := free
+
+	for gr := 0; gr < l.granules; gr++ {
+		for ch := 0; ch < nch; ch++ {
+			l.psy[gr][ch].analyse(&l.xr[gr][ch], l.bands, l.e.rate)
+		}
+	}
+
+	w := bits.NewWriter(nil)
+	avail := (begin + slot) * 8
+	mean := slot * 8 / (l.granules * nch)
+	units := l.granules * nch
+	for gr := 0; gr < l.granules; gr++ {
+		for ch := 0; ch < nch; ch++ {
+			max := l.maxBits(avail, mean, units, l.psy[gr][ch].pe)
+			g := &l.gi[gr][ch]
+			g.encode(&l.xr[gr][ch], &l.psy[gr][ch], l.bands, max, l.e.version == mp3.MPEG1)
+			g.write(w)
+			avail -= g.info.Part2_3Length
+			units--
+		}
+	}
+	l.main = append(l.main, w.Bytes()...)
+
+	buf := make([]byte, size)
+	copy(buf, h)
+	l.writeSideInfo(buf[off-sideLen:off], begin)
+	if l.e.crc {
+		if err := setCRC(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	l.pending = append(l.pending, pendingFrame{buf: buf, start: l.slots, off: off})
+	l.slots += slot
+	return l.complete(false)
+}
+
+// complete returns the pending frames whose slots are filled. If all is set
+// every pending frame is returned, with any unused space zeroed.
+func (l *layer3Encoder) complete(all bool) ([]*mp3.Frame, error) {
+	var fs []*mp3.Frame
+	for len(l.pending) > 0 {
+		p := l.pending[0]
+		end := p.start + len(p.buf) - p.off
+		if l.base+len(l.main) < end {
+			if !all {
+				break
+			}
+			l.main = append(l.main, make([]byte, end-l.base-len(l.main))...)
+		}
+		copy(p.buf[p.off:], l.main[p.start-l.base:end-l.base])
+		f, err := mp3.NewFrame(p.buf)
+		if err != nil {
+			return fs, err
+		}
+		fs = append(fs, f)
+		l.main = l.main[end-l.base:]
+		l.base = end
+		l.pending = l.pending[1:]
+	}
+	return fs, nil
+}
+
+// flush returns every pending frame
+func (l *layer3Encoder) flush() []*mp3.Frame {
+	fs, _ := l.complete(true)
+	return fs
+}
+
+// maxBits gives the bits available to the next granule and channel, given
+// the bits left in the frame, including the reservoir, the mean bits per
+// granule and channel, the number of granules and channels left to code,
+// and the perceptual entropy of the granule
+func (l *layer3Encoder) maxBits(avail, mean, units int, pe float64) int {
+	resv := avail - mean*units
+	if resv < 0 {
+		resv = 0
+	}
+	extra := 0
+	if more := int(pe) - mean; more > 100 {
+		extra = resv * 6 / 10
+		if more < extra {
+			extra = more
+		}
+	}
+	// spend what would otherwise overflow the reservoir
+	if over := resv - l.maxBegin*8*8/10 - extra; over > 0 {
+		extra += over
+	}
+	max := mean + extra
+	if max > avail {
+		max = avail
+	}
+	if max > 4095 {
+		max = 4095
+	}
+	return max
+}
+
+// transform runs 576 samples of channel ch through the analysis filterbank
+// and MDCT, producing the frequency lines of a granule
+func (l *layer3Encoder) transform(ch int, in []float32, xr *[576]float32) {
+	var cur [18][32]float32
+	for t := 0; t < 18; t++ {
+		l.analysis[ch].Filter(in[t*32:t*32+32], &cur[t])
+		// frequency inversion, undone by the decoder after its IMDCT
+		if t&1 == 1 {
+			for sb := 1; sb < 32; sb += 2 {
+				cur[t][sb] = -cur[t][sb]
+			}
+		}
+	}
+
+	prev := &l.prev[ch]
+	for sb := 0; sb < 32; sb++ {
+		var z [36]float32
+		for t := 0; t < 18; t++ {
+			z[t] = prev[t][sb] * layer3.Windows[0][t]
+			z[t+18] = cur[t][sb] * layer3.Windows[0][t+18]
+		}
+		x := xr[sb*18 : sb*18+18]
+		for k := 0; k < 18; k++ {
+			var s float32
+			for n := 0; n < 36; n++ {
+				s += z[n] * mdct[n][k]
+			}
+			x[k] = s / 9
+		}
+	}
+	*prev = cur
+
+	// alias reduction, the inverse of the decoder's butterflies
+	for sb := 1; sb < 32; sb++ {
+		for i := 0; i < 8; i++ {
+			lo, hi := sb*18-1-i, sb*18+i
+			bu, bd := xr[lo], xr[hi]
+			xr[lo] = bu*layer3.AliasCs[i] + bd*layer3.AliasCa[i]
+			xr[hi] = bd*layer3.AliasCs[i] - bu*layer3.AliasCa[i]
+		}
+	}
+
+	for i := l.lowpass; i < 576; i++ {
+		xr[i] = 0
+	}
+}
+
+// useMidSide decides whether mid/side stereo should be used for the frame,
+// which pays off when the two channels are similar
+func (l *layer3Encoder) useMidSide() bool {
+	var m, s float64
+	for gr := 0; gr < l.granules; gr++ {
+		for i := 0; i < 576; i++ {
+			a, b := float64(l.xr[gr][0][i]), float64(l.xr[gr][1][i])
+			m += (a + b) * (a + b)
+			s += (a - b) * (a - b)
+		}
+	}
+	return s < 0.3*m
+}
+
+// midSide converts a left and right channel into mid and side channels
+func midSide(l, r *[576]float32) {
+	for i := range l {
+		a, b := l[i], r[i]
+		l[i] = (a + b) * math.Sqrt2 / 2
+		r[i] = (a - b) * math.Sqrt2 / 2
+	}
+}
+
+// writeSideInfo writes the side info of the frame just encoded into b
+func (l *layer3Encoder) writeSideInfo(b []byte, begin int) {
+	w := bits.NewWriter(nil)
+	nch := l.e.channels
+	if l.e.version == mp3.MPEG1 {
+		w.Write(uint32(begin), 9)
+		if nch == 1 {
+			w.Write(0, 5)
+		} else {
+			w.Write(0, 3)
+		}
+		// scalefactors are never shared between granules
+		w.Write(0, 4*nch)
+	} else {
+		w.Write(uint32(begin), 8)
+		w.Write(0, nch)
+	}
+
+	for gr := 0; gr < l.granules; gr++ {
+		for ch := 0; ch < nch; ch++ {
+			g := &l.gi[gr][ch].info
+			w.Write(uint32(g.Part2_3Length), 12)
+			w.Write(uint32(g.BigValues), 9)
+			w.Write(uint32(g.GlobalGain), 8)
+			if l.e.version == mp3.MPEG1 {
+				w.Write(uint32(g.ScalefacCompress), 4)
+			} else {
+				w.Write(uint32(g.ScalefacCompress), 9)
+			}
+			w.Bit(false) // window switching
+			for r := 0; r < 3; r++ {
+				w.Write(uint32(g.TableSelect[r]), 5)
+			}
+			w.Write(uint32(g.Region0Count), 4)
+			w.Write(uint32(g.Region1Count), 3)
+			if l.e.version == mp3.MPEG1 {
+				w.Bit(false) // preflag
+			}
+			w.Bit(false) // scalefac_scale
+			w.Write(uint32(g.Count1TableSelect), 1)
+		}
+	}
+	copy(b, w.Bytes())
+}
+
+// sideInfoLength gives the length in bytes of the Layer III side info
+func sideInfoLength(v mp3.FrameVersion, nch int) int {
+	switch {
+	case v == mp3.MPEG1 && nch == 1:
+		return 17
+	case v == mp3.MPEG1:
+		return 32
+	case nch == 1:
+		return 9
+	}
+	return 17
+}
@@ -0,0 +1,110 @@
+package encoder
+
+import (
+	"math"
+
+	"github.com/tcolgate/mp3/internal/layer3"
+)
+
+// fullScale is the energy of the lines of a granule holding a full scale
+// sine wave, which is taken to play at 96dB SPL
+const fullScale = 1
+
+// threshold is the output of the psychoacoustic model for one granule and
+// channel
+type threshold struct {
+	// xmin holds the noise energy each band can mask
+	xmin [22]float64
+	// pe is the perceptual entropy, an estimate of the bits needed to code
+	// the granule transparently
+	pe float64
+}
+
+// analyse runs the psychoacoustic model over the lines of a granule. The
+// tonality of each band is taken from its spectral flatness.
+func (t *threshold) analyse(xr *[576]float32, bt *layer3.Bands, rate int) {
+	var en, bark, tonality, ath [22]float64
+	for b := 0; b < 22; b++ {
+		lo, hi := bt.Long[b], bt.Long[b+1]
+		var sum, logSum float64
+		for i := lo; i < hi; i++ {
+			e := float64(xr[i]) * float64(xr[i])
+			sum += e
+			logSum += math.Log(e + 1e-20)
+		}
+		en[b] = sum
+		bark[b] = barkScale(lineFreq((lo+hi)/2, rate))
+		ath[b] = athRange(lineFreq(lo, rate), lineFreq(hi-1, rate))
+
+		// the spectral flatness of the band gives its tonality, between 0
+		// for noise and 1 for a pure tone
+		if w := float64(hi - lo); sum > 0 && w > 1 {
+			sfm := 10 * (logSum/w - math.Log(sum/w+1e-20)) / math.Ln10
+			tonality[b] = math.Min(sfm/-60, 1)
+		}
+	}
+
+	mask(en[:], bark[:], tonality[:], ath[:], t.xmin[:])
+	t.pe = 0
+	for b := 0; b < 22; b++ {
+		if en[b] > t.xmin[b] {
+			t.pe += float64(bt.Long[b+1]-bt.Long[b]) * 0.5 * math.Log2(en[b]/t.xmin[b])
+		}
+	}
+}
+
+// mask computes the noise energy each band can mask, given the energy,
+// position on the Bark scale and tonality of every band. Each band's energy
+// is spread over its neighbours, and lowered by an offset that depends on
+// how tonal it is, as in ISO psychoacoustic model 1. The result is limited
+// below by the absolute threshold of hearing, ath.
+func mask(en, bark, tonality, ath, xmin []float64) {
+	for b := range en {
+		var spread float64
+		for j := range en {
+			if en[j] > 0 {
+				spread += en[j] * spreading(bark[b]-bark[j])
+			}
+		}
+		offset := tonality[b]*(14.5+bark[b]) + (1-tonality[b])*5.5
+		xmin[b] = math.Max(spread*math.Pow(10, -offset/10), ath[b])
+	}
+}
+
+// spreading gives the fraction of a masker's energy that masks a band dz
+// Bark above it
+func spreading(dz float64) float64 {
+	if dz < -3 || dz > 8 {
+		return 0
+	}
+	x := dz + 0.474
+	return math.Pow(10, (15.81+7.5*x-17.5*math.Sqrt(1+x*x))/10)
+}
+
+// barkScale converts a frequency in Hz to the Bark scale
+func barkScale(f float64) float64 {
+	return 13*math.Atan(0.00076*f) + 3.5*math.Atan(f*f/(7500*7500))
+}
+
+// athEnergy gives the absolute threshold of hearing at frequency f, in Hz,
+// as line energy
+func athEnergy(f float64) float64 {
+	f = math.Max(f, 20) / 1000
+	db := 3.64*math.Pow(f, -0.8) - 6.5*math.Exp(-0.6*(f-3.3)*(f-3.3)) + 1e-3*math.Pow(f, 4)
+	return fullScale * math.Pow(10, (db-96)/10)
+}
+
+// athRange gives the lowest absolute threshold of hearing between the
+// frequencies lo and hi, in Hz
+func athRange(lo, hi float64) float64 {
+	a := athEnergy(lo)
+	for f := lo; f <= hi; f += 50 {
+		a = math.Min(a, athEnergy(f))
+	}
+	return math.Min(a, athEnergy(hi))
+}
+
+// lineFreq gives the centre frequency of line i
+func lineFreq(i, rate int) float64 {
+	return (float64(i) + 0.5) * float64(rate) / 1152
+}
@@ -0,0 +1,284 @@
+package encoder
+
+import (
+	"math"
+
+	"github.com/tcolgate/mp3"
+	"github.com/tcolgate/mp3/internal/layer3"
+)
+
+// maxQuant is the largest value the Huffman tables can code
+const maxQuant = 15 + 1<<13 - 1
+
+// maxOuterLoops limits the number of times the scalefactors are adjusted
+const maxOuterLoops = 12
+
+// granule holds the quantised lines and side info of one granule and
+// channel. The lines in ix carry the sign of the matching xr line.
+type granule struct {
+	info  mp3.GranuleInfo
+	sf    [22]int
+	slen  [4]int
+	ix    [576]int
+	noise [22]float64
+
+	bt    *layer3.Bands
+	mpeg1 bool
+	xr34  [576]float64
+}
+
+var (
+	// mdct holds the MDCT cosine terms
+	mdct [36][18]float32
+	// pow43 holds i^(4/3) for every legal quantised value
+	pow43 [maxQuant + 1]float64
+
+	// subdivision gives the region0 and region1 counts used for a big
+	// values region ending in each scalefactor band
+	subdivision = [23][2]int{
+		{0, 0}, {0, 0}, {0, 0}, {0, 0}, {0, 0}, {0, 1}, {1, 1}, {1, 1},
+		{1, 2}, {2, 2}, {2, 3}, {2, 3}, {3, 4}, {3, 4}, {3, 4}, {4, 5},
+		{4, 5}, {4, 6}, {5, 6}, {5, 6}, {5, 7}, {6, 7}, {6, 7},
+	}
+)
+
+func init() {
+	for n := 0; n < 36; n++ {
+		for k := 0; k < 18; k++ {
+			mdct[n][k] = float32(math.Cos(math.Pi / 72 * float64((2*n+1+18)*(2*k+1))))
+		}
+	}
+	for i := range pow43 {
+		pow43[i] = math.Pow(float64(i), 4.0/3.0)
+	}
+}
+
+// sfLimit gives the largest scalefactor that can be coded in band sfb. The
+// final band has no scalefactor.
+func sfLimit(sfb int) int {
+	switch {
+	case sfb >= 21:
+		return 0
+	case sfb >= 11:
+		return 7
+	}
+	return 15
+}
+
+// encode quantises xr within max bits, adjusting the scalefactors to keep
+// the quantisation noise below the masking threshold where bits allow
+func (g *granule) encode(xr *[576]float32, t *threshold, bt *layer3.Bands, max int, mpeg1 bool) {
+	g.bt, g.mpeg1 = bt, mpeg1
+	for i, v := range xr {
+		g.xr34[i] = math.Pow(math.Abs(float64(v)), 0.75)
+	}
+	g.sf = [22]int{}
+
+	var best granule
+	bestOver, bestNoise := -1, 0.0
+	for loop := 0; loop < maxOuterLoops; loop++ {
+		part2 := g.scalefactorBits()
+		if part2 > max || !g.quantize(max-part2) {
+			break
+		}
+		g.info.Part2_3Length += part2
+
+		over, noise := g.distortion(xr, t)
+		if bestOver < 0 || over < bestOver || (over == bestOver && noise < bestNoise) {
+			best.info, best.sf, best.slen, best.ix = g.info, g.sf, g.slen, g.ix
+			bestOver, bestNoise = over, noise
+		}
+		if over == 0 || !g.amplify(t) {
+			break
+		}
+	}
+	g.info, g.sf, g.slen, g.ix = best.info, best.sf, best.slen, best.ix
+
+	for i, v := range xr {
+		if v < 0 {
+			g.ix[i] = -g.ix[i]
+		}
+	}
+}
+
+// quantize finds the smallest global gain that codes the lines in at most
+// max bits, returning false if there is none
+func (g *granule) quantize(max int) bool {
+	lo, hi := 0, 255
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if g.quantizeGain(mid) && g.countBits() <= max {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return g.quantizeGain(lo) && g.countBits() <= max
+}
+
+// quantizeGain quantises the lines with the given global gain, returning
+// false if any value is too large to code
+func (g *granule) quantizeGain(gain int) bool {
+	g.info.GlobalGain = gain
+	for b := 0; b < 22; b++ {
+		step := math.Exp2(-0.1875*float64(gain-210) + 0.375*float64(g.sf[b]))
+		for i := g.bt.Long[b]; i < g.bt.Long[b+1]; i++ {
+			v := g.xr34[i]*step + 0.4054
+			if v > maxQuant {
+				return false
+			}
+			g.ix[i] = int(v)
+		}
+	}
+	return true
+}
+
+// distortion measures the quantisation noise in each band, returning the
+// number of bands whose noise exceeds the masking threshold, and the total
+// excess in dB
+func (g *granule) distortion(xr *[576]float32, t *threshold) (int, float64) {
+	over, excess := 0, 0.0
+	for b := 0; b < 22; b++ {
+		step := math.Exp2(0.25*float64(g.info.GlobalGain-210) - 0.5*float64(g.sf[b]))
+		var n float64
+		for i := g.bt.Long[b]; i < g.bt.Long[b+1]; i++ {
+			d := math.Abs(float64(xr[i])) - pow43[g.ix[i]]*step
+			n += d * d
+		}
+		g.noise[b] = n
+		if n > t.xmin[b] {
+			over++
+			excess += 10 * math.Log10(n/t.xmin[b])
+		}
+	}
+	return over, excess
+}
+
+// amplify raises the scalefactors of the bands whose noise is above the
+// masking threshold, returning false if none could be raised
+func (g *granule) amplify(t *threshold) bool {
+	ok := false
+	for b := 0; b < 22; b++ {
+		if g.noise[b] > t.xmin[b] && g.sf[b] < sfLimit(b) {
+			g.sf[b]++
+			ok = true
+		}
+	}
+	return ok
+}
+
+// scalefactorBits chooses the scalefactor lengths, and scalefac_compress,
+// for the current scalefactors, returning the bits needed to code them
+func (g *granule) scalefactorBits() int {
+	if g.mpeg1 {
+		max1, max2 := maxOf(g.sf[:11]), maxOf(g.sf[11:21])
+		best, bits := 0, -1
+		for c := 0; c < 16; c++ {
+			s1, s2 := layer3.Slen[0][c], layer3.Slen[1][c]
+			if 1<<uint(s1) <= max1 || 1<<uint(s2) <= max2 {
+				continue
+			}
+			if n := 11*s1 + 10*s2; bits < 0 || n < bits {
+				best, bits = c, n
+			}
+		}
+		g.info.ScalefacCompress = best
+		g.slen = [4]int{layer3.Slen[0][best], layer3.Slen[1][best]}
+		return bits
+	}
+
+	// MPEG-2 uses the first layout, four partitions of 6, 5, 5 and 5 bands
+	bits, sfb := 0, 0
+	for p, n := range layer3.NrOfSfb[0][0] {
+		s := 0
+		for m := maxOf(g.sf[sfb : sfb+n]); 1<<uint(s) <= m; s++ {
+		}
+		g.slen[p] = s
+		bits += s * n
+		sfb += n
+	}
+	g.info.ScalefacCompress = (g.slen[0]*5+g.slen[1])*16 + g.slen[2]*4 + g.slen[3]
+	return bits
+}
+
+// countBits chooses the region boundaries and Huffman tables for the
+// quantised lines, setting part2_3_length to the bits they need
+func (g *granule) countBits() int {
+	ix := &g.ix
+	i := 576
+	for i > 1 && ix[i-1] == 0 && ix[i-2] == 0 {
+		i -= 2
+	}
+	end := i
+	for i > 3 && abs(ix[i-1]) <= 1 && abs(ix[i-2]) <= 1 && abs(ix[i-3]) <= 1 && abs(ix[i-4]) <= 1 {
+		i -= 4
+	}
+	big := i
+	g.info.BigValues = big / 2
+
+	bits := 0
+	var c1 [2]int
+	for j := big; j < end; j += 4 {
+		for t := range c1 {
+			c1[t] += quadBits(&layer3.Count1Tables[t], ix[j:j+4])
+		}
+	}
+	g.info.Count1TableSelect = 0
+	if c1[1] < c1[0] {
+		g.info.Count1TableSelect = 1
+	}
+	bits += c1[g.info.Count1TableSelect]
+
+	l := &g.bt.Long
+	g.info.Region0Count, g.info.Region1Count = 0, 0
+	g.info.TableSelect = [3]int{}
+	if big == 0 {
+		g.info.Part2_3Length = bits
+		return bits
+	}
+	sfb := 1
+	for sfb < 22 && l[sfb] < big {
+		sfb++
+	}
+	r0 := subdivision[sfb][0]
+	for r0 > 0 && l[r0+1] > big {
+		r0--
+	}
+	r1 := subdivision[sfb][1]
+	for r1 > 0 && l[r0+r1+2] > big {
+		r1--
+	}
+	g.info.Region0Count, g.info.Region1Count = r0, r1
+
+	a1, a2 := l[r0+1], l[r0+r1+2]
+	if a1 > big {
+		a1 = big
+	}
+	if a2 > big {
+		a2 = big
+	}
+	for r, lim := range [3][2]int{{0, a1}, {a1, a2}, {a2, big}} {
+		t, n := chooseTable(ix[lim[0]:lim[1]])
+		g.info.TableSelect[r] = t
+		bits += n
+	}
+	g.info.Part2_3Length = bits
+	return bits
+}
+
+func maxOf(v []int) int {
+	m := 0
+	for _, x := range v {
+		if x > m {
+			m = x
+		}
+	}
+	return m
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
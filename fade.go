@@ -0,0 +1,170 @@
+package mp3
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// fader applies fades to the frames of a stream
+type fader struct {
+	in, out    int64 // fade lengths, in samples
+	skip, tail int64 // samples before and after the audio of the stream
+}
+
+// Fade copies the Layer III stream read from r to w, fading its audio in
+// over the duration in from the start, and out over the duration out to the
+// end. The fades are made without decoding, by lowering the global gain of
+// each granule in steps of about 1.5dB, so they are coarse but lossless in
+// the rest of the stream. Positions are taken from the start and end of
+// the audio given by any LAME tag.
+//
+// ID3 and APE tags are kept. The stream is written with a header as by
+// Writer, keeping the LAME tag of the stream if there is one. Its peak and
+// ReplayGain fields are cleared if a fade is made, as they are then no
+// longer known.
+//
+// The end of the stream is not known until it is reached, so the frames
+// that may fall within the fade out are held back until then.
+func Fade(w io.WriteSeeker, r io.Reader, in, out time.Duration) error {
+	var werr error
+	var ape *APETag
+	var id3v1 *ID3v1Tag
+	d := NewDecoder(r,
+		WithID3v2Handler(func(tag []byte) {
+			if werr == nil {
+				_, werr = w.Write(tag)
+			}
+		}),
+		WithAPEHandler(func(t *APETag) { ape = t }),
+		WithID3v1Handler(func(t *ID3v1Tag) { id3v1 = t }))
+
+	fd := &fader{in: -1}
+	var wr *Writer
+	var tag *LAMETag
+	var queue []cutFrame
+	var f Frame
+	var pos int64
+	skipped := 0
+	for {
+		err := d.Decode(&f, &skipped)
+		if werr != nil {
+			return werr
+		}
+		if err == io.EOF || err == ErrNoSyncBits || err == ErrPrematureEOF {
+			break
+		}
+		if err != nil && err != ErrCRCMismatch {
+			return err
+		}
+
+		if f.IsStreamInfo() {
+			if l, err := f.LAME(); err == nil && wr == nil && tag == nil {
+				tag = l
+				skip, tail := l.Trim()
+				fd.skip, fd.tail = int64(skip), int64(tail)
+			}
+			continue
+		}
+		if wr == nil {
+			rate := int(f.Header().SampleRate())
+			fd.in, fd.out = durationSamples(in, rate), durationSamples(out, rate)
+			var opts []WriterOption
+			if tag != nil {
+				l := *tag
+				if fd.in > 0 || fd.out > 0 {
+					l.Peak = 0
+					l.RadioGain, l.AudiophileGain = ReplayGain{}, ReplayGain{}
+				}
+				opts = append(opts, WithLAMETag(l))
+			}
+			wr = NewWriter(w, opts...)
+		}
+
+		// frames ending before the fade out can be written
+		queue = append(queue, cutFrame{f: f.clone(), pos: pos})
+		pos += int64(f.Samples())
+		for len(queue) > 1 && pos-(queue[1].pos) >= fd.out+fd.tail {
+			if err := fd.apply(queue[0], -1); err != nil {
+				return err
+			}
+			if err := wr.WriteFrame(queue[0].f); err != nil {
+				return err
+			}
+			queue = queue[1:]
+		}
+	}
+	if wr == nil {
+		return ErrNoFrames
+	}
+
+	end := pos - fd.skip - fd.tail
+	for _, cf := range queue {
+		if err := fd.apply(cf, end); err != nil {
+			return err
+		}
+		if err := wr.WriteFrame(cf.f); err != nil {
+			return err
+		}
+	}
+	if err := wr.Close(); err != nil {
+		return err
+	}
+	if ape != nil {
+		if _, err := w.Write(ape.Bytes()); err != nil {
+			return err
+		}
+	}
+	if id3v1 != nil {
+		if _, err := w.Write(id3v1.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply fades the granules of the frame, in a stream whose audio ends at
+// sample end, or whose end is not yet known if end is negative
+func (fd *fader) apply(cf cutFrame, end int64) error {
+	si, err := cf.f.ParseSideInfo()
+	if err != nil {
+		return err
+	}
+	n := int64(cf.f.Samples() / si.Granules)
+	for gr := 0; gr < si.Granules; gr++ {
+		// the level of the granule is that of the fades at its centre
+		c := cf.pos + int64(gr)*n + n/2 - fd.skip
+		a := 1.0
+		if fd.in > 0 && c < fd.in {
+			a = float64(c) / float64(fd.in)
+		}
+		if end >= 0 && fd.out > 0 && end-c < fd.out {
+			a = math.Min(a, float64(end-c)/float64(fd.out))
+		}
+
+		if a <= 0 {
+			// silence every channel of the granule
+			if err := cf.f.setGranuleGain(si, gr, func(int) int { return 0 }); err != nil {
+				return err
+			}
+			continue
+		}
+		steps := 0
+		if a < 1 {
+			steps = int(math.Floor(4*math.Log2(a) + 0.5))
+		}
+		// the gain can not be lowered past 0
+		for ch := 0; ch < si.Channels; ch++ {
+			if v := si.Granule[gr][ch].GlobalGain; steps < -v {
+				steps = -v
+			}
+		}
+		if steps == 0 {
+			continue
+		}
+		if err := cf.f.AdjustGranuleGain(gr, steps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
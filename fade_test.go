@@ -0,0 +1,110 @@
+package mp3
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFade(t *testing.T) {
+	fs := markedFrames(t, 20)
+	setGains(t, fs, 150)
+	var src bytes.Buffer
+	for _, f := range fs {
+		src.Write(f.Bytes())
+	}
+
+	// the stream is written after a header frame
+	var out seekBuffer
+	if err := Fade(&out, bytes.NewReader(src.Bytes()), 0, 0); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	dec := NewDecoder(bytes.NewReader(out.buf))
+	var f Frame
+	var skipped int
+	if err := dec.Decode(&f, &skipped); err != nil || !f.IsStreamInfo() {
+		t.Fatalf("expected header frame, got %v", err)
+	}
+	if !bytes.Equal(out.buf[len(f.buf):], src.Bytes()) {
+		t.Errorf("stream changed without fades")
+	}
+
+	// fades of five frames, ten granules, at each end
+	d := 5 * 1152 * time.Second / 44100
+	out = seekBuffer{}
+	if err := Fade(&out, bytes.NewReader(src.Bytes()), d, d); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if len(out.buf) != len(f.buf)+src.Len() {
+		t.Fatalf("expected %d bytes, got %d", len(f.buf)+src.Len(), len(out.buf))
+	}
+
+	var gains []int
+	dec = NewDecoder(bytes.NewReader(out.buf[len(f.buf):]))
+	for i := 0; i < len(fs); i++ {
+		if err := dec.Decode(&f, &skipped); err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		if m := int(f.buf[len(f.buf)-1]); m != i {
+			t.Errorf("expected frame %d, got %d", i, m)
+		}
+		si, _ := f.ParseSideInfo()
+		for gr := 0; gr < si.Granules; gr++ {
+			if si.Granule[gr][0].GlobalGain != si.Granule[gr][1].GlobalGain {
+				t.Errorf("granule %d of frame %d: channel gains differ", gr, i)
+			}
+			gains = append(gains, si.Granule[gr][0].GlobalGain)
+		}
+	}
+
+	// the centre of the first granule is at 1/20 of the fade, about -17
+	// steps
+	if gains[0] != 133 || gains[len(gains)-1] != 133 {
+		t.Errorf("expected end granules at 133, got %v", gains)
+	}
+	for i := 1; i < len(gains); i++ {
+		switch {
+		case i < 10 && gains[i] < gains[i-1],
+			i >= 30 && gains[i] > gains[i-1],
+			i >= 10 && i < 30 && gains[i] != 150:
+			t.Errorf("unexpected gain %d of granule %d, in %v", gains[i], i, gains)
+		}
+	}
+}
+
+func TestFadeLAME(t *testing.T) {
+	fs := markedFrames(t, 20)
+	setGains(t, fs, 150)
+	var src seekBuffer
+	w := NewWriter(&src, WithLAMETag(LAMETag{EncoderDelay: 576, Padding: 1000, Peak: 0.5,
+		RadioGain: ReplayGain{Name: 1, Originator: 3, Gain: -3}}))
+	for _, f := range fs {
+		w.WriteFrame(f)
+	}
+	w.Close()
+
+	var out seekBuffer
+	if err := Fade(&out, bytes.NewReader(src.buf), time.Second/10, 0); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	dec := NewDecoder(bytes.NewReader(out.buf))
+	var f Frame
+	var skipped int
+	if err := dec.Decode(&f, &skipped); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	l, err := f.LAME()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if l.EncoderDelay != 576 || l.Padding != 1000 || l.Peak != 0 || l.RadioGain.Name != 0 {
+		t.Errorf("unexpected tag %+v", l)
+	}
+	audio := out.buf[len(f.buf):]
+	if bytes.Equal(audio, src.buf[len(f.buf):]) {
+		t.Errorf("stream not faded")
+	}
+	if !l.TagCRCValid || l.MusicCRC != lameCRC16(0, audio) || l.MusicLength != len(out.buf) {
+		t.Errorf("tag does not match the faded stream, %+v", l)
+	}
+}
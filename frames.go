@@ -12,13 +12,27 @@ import (
 type (
 	// Decoder translates a io.Reader into a series of frames
 	Decoder struct {
-		src io.Reader
+		src *posReader
 		err error
+
+		crcPolicy CRCPolicy
+		id3v2     func([]byte)
+		id3v1     func(*ID3v1Tag)
+		ape       func(*APETag)
+		junk      []byte // recently skipped bytes, kept to recover APE tag items
+
+		free       int         // unpadded length of free format frames
+		freeHeader FrameHeader // header of the frames free was found for
 	}
 
+	// DecoderOption configures optional Decoder behaviour
+	DecoderOption func(*Decoder)
+
 	// Frame represents one individual mp3 frame
 	Frame struct {
-		buf []byte
+		buf     []byte
+		corrupt bool
+		free    int // unpadded length of a free format frame
 	}
 
 	// FrameHeader represents the entire header of a frame
@@ -82,6 +96,11 @@ const (
 	ErrInvalidBitrate FrameBitRate = -1
 )
 
+// maxFreeBitRate is the highest bit rate of free format streams, that
+// allowed for Layer III, which bounds the search for the header following
+// a free format frame
+const maxFreeBitRate = 640000
+
 var (
 	bitrates = [VERSIONMAX][LayerMax][15]int{
 		{ // MPEG 2.5
@@ -157,6 +176,14 @@ var (
 
 	// ErrPrematureEOF indicates that the filed ended before a complete frame could be read
 	ErrPrematureEOF = errors.New("EOF mid stream")
+
+	// ErrBadHeader indicates that the bytes passed to NewFrame do not start
+	// with a valid frame header
+	ErrBadHeader = errors.New("invalid frame header")
+
+	// ErrFrameSize indicates that the bytes passed to NewFrame are not the
+	// length given by the frame header
+	ErrFrameSize = errors.New("frame length does not match header")
 )
 
 func init() {
@@ -165,8 +192,43 @@ func init() {
 }
 
 // NewDecoder returns a decoder that will process the provided reader.
-func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{r, nil}
+func NewDecoder(r io.Reader, opts ...DecoderOption) *Decoder {
+	d := &Decoder{src: &posReader{r: r}}
+	for _, o := range opts {
+		o(d)
+	}
+	return d
+}
+
+// posReader counts the bytes read from the underlying reader
+type posReader struct {
+	r    io.Reader
+	pos  int64
+	back []byte // bytes pushed back, to be read again first
+}
+
+func (p *posReader) Read(b []byte) (int, error) {
+	if len(p.back) > 0 {
+		n := copy(b, p.back)
+		p.back = p.back[n:]
+		p.pos += int64(n)
+		return n, nil
+	}
+	n, err := p.r.Read(b)
+	p.pos += int64(n)
+	return n, err
+}
+
+// unread pushes b back, to be read again ahead of the rest of the source
+func (p *posReader) unread(b []byte) {
+	p.back = append(append([]byte(nil), b...), p.back...)
+	p.pos -= int64(len(b))
+}
+
+// Pos returns the number of bytes the decoder has consumed from its source.
+// After a successful Decode the frame started at Pos() less its length.
+func (d *Decoder) Pos() int64 {
+	return d.src.pos
 }
 
 // fill slice d until it is of len l, using bytes from reader r
@@ -192,41 +254,87 @@ func fillbuf(d []byte, r io.Reader, l int) (res []byte, err error) {
 	}
 
 	d = d[:l]
-	_, err = io.ReadFull(r, d[len(d)-missing:])
+	n, err := io.ReadFull(r, d[len(d)-missing:])
 
-	return d, err
+	return d[:l-missing+n], err
 }
 
 // Decode reads the next complete discovered frame into the provided
 // Frame struct. A count of skipped bytes will be written to skipped.
+// Tags found between frames are consumed, and passed to any registered
+// handlers, without counting as skipped. At the end of a clean stream
+// io.EOF is returned, ErrNoSyncBits is returned if the stream ended with
+// unrecognised bytes, and ErrPrematureEOF if it ended mid frame.
+//
+// The length of free format frames is found from the position of the header
+// that follows the first of them, and is kept for the rest of the stream.
 func (d *Decoder) Decode(v *Frame, skipped *int) (err error) {
 	// Truncate the array
 	v.buf = v.buf[:0]
+	v.corrupt = false
+	v.free = 0
 
 	hLen := 4
 	// locate a sync frame
 	*skipped = 0
+	d.junk = d.junk[:0]
 	for {
 		v.buf, err = fillbuf(v.buf, d.src, hLen)
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			*skipped += len(v.buf)
+			if *skipped == 0 {
+				return io.EOF
+			}
+			return ErrNoSyncBits
+		}
+
+		var ok bool
+		v.buf, ok, err = d.skipTag(v.buf, skipped)
 		if err != nil {
 			return err
 		}
-		if v.buf[0] == 0xFF && (v.buf[1]&0xE0 == 0xE0) &&
+		if ok {
+			continue
+		}
+
+		sync := v.buf[0] == 0xFF && (v.buf[1]&0xE0 == 0xE0) &&
 			v.Header().Emphasis() != EmphReserved &&
 			v.Header().Layer() != LayerReserved &&
 			v.Header().Version() != MPEGReserved &&
-			v.Header().SampleRate() != -1 &&
-			v.Header().BitRate() != -1 {
+			v.Header().SampleRate() != -1
+		if sync && v.Header().BitRate() != -1 {
 			break
 		}
+		if sync && v.Header().FreeFormat() {
+			// a known length is only trusted while frames follow on
+			// from each other
+			if d.free > 0 && *skipped == 0 && sameFreeFormat(d.freeHeader, v.Header()) {
+				v.free = d.free
+				break
+			}
+			if v.free = d.freeSize(v.buf); v.free > 0 {
+				d.free = v.free
+				d.freeHeader = append(d.freeHeader[:0], v.buf[:hLen]...)
+				break
+			}
+		}
+		n := 2
 		switch {
-		case v.buf[1] == 0xFF:
-			v.buf = v.buf[1:]
-			*skipped++
-		default:
-			v.buf = v.buf[2:]
-			*skipped += 2
+		case bytes.HasPrefix(v.buf, apePreamble):
+			// an APE preamble that did not lead to a tag, it holds a TAG
+			// that must not be taken for an ID3v1 tag
+			n = len(apePreamble)
+		case v.buf[1] == 0xFF, v.buf[1] == 'I', v.buf[1] == 'T', v.buf[1] == 'A':
+			n = 1
 		}
+		if d.ape != nil {
+			d.addJunk(v.buf[:n])
+		}
+		v.buf = v.buf[n:]
+		*skipped += n
 	}
 
 	crcLen := 0
@@ -234,29 +342,138 @@ func (d *Decoder) Decode(v *Frame, skipped *int) (err error) {
 		crcLen = 2
 		v.buf, err = fillbuf(v.buf, d.src, hLen+crcLen)
 		if err != nil {
-			return err
+			return premature(err)
 		}
 	}
 
-	sideLen, err := v.SideInfoLength()
-	if err != nil {
-		return err
-	}
+	// only Layer III frames carry side info, the smallest Layer I frames
+	// are shorter than it
+	if v.Header().Layer() == Layer3 {
+		sideLen, err := v.SideInfoLength()
+		if err != nil {
+			return err
+		}
 
-	v.buf, err = fillbuf(v.buf, d.src, hLen+crcLen+sideLen)
-	if err != nil {
-		return err
+		v.buf, err = fillbuf(v.buf, d.src, hLen+crcLen+sideLen)
+		if err != nil {
+			return premature(err)
+		}
 	}
 
 	dataLen := v.Size()
 	v.buf, err = fillbuf(v.buf, d.src, dataLen)
 	if err != nil {
-		return err
+		return premature(err)
+	}
+
+	if d.crcPolicy != CRCIgnore && v.CheckCRC() != nil {
+		v.corrupt = true
+		if d.crcPolicy == CRCReject {
+			return ErrCRCMismatch
+		}
 	}
 
 	return nil
 }
 
+// freeSize returns the length, less any padding, of the free format frame
+// whose header starts buf, found by searching for the header of the next
+// frame of the stream. The length is only accepted if the frame after that
+// also starts where it should, or the stream ends first. The bytes read
+// ahead are pushed back into the source. 0 is returned if no following
+// header is found.
+func (d *Decoder) freeSize(buf []byte) int {
+	h := FrameHeader(buf[:4])
+	slot := slotSize[h.Layer()]
+	max := samplesPerFrame[h.Version()][h.Layer()]/8/slot*maxFreeBitRate/int(h.SampleRate())*slot + slot
+	// the next header can not fall within the side info
+	min := 4
+	if h.Protection() {
+		min += 2
+	}
+	if h.Layer() == Layer3 {
+		sil, _ := (&Frame{buf: buf}).SideInfoLength()
+		min += sil
+	}
+
+	n := len(buf)
+	buf, _ = fillbuf(buf, d.src, 2*max+slot+4)
+	defer d.src.unread(buf[n:])
+
+	// isHeader reports whether a header of the stream starts at i
+	isHeader := func(i int) bool {
+		return buf[i] == 0xFF && sameFreeFormat(h, FrameHeader(buf[i:i+4])) &&
+			FrameHeader(buf[i:i+4]).Emphasis() != EmphReserved
+	}
+	for i := (min + slot - 1) / slot * slot; i <= max && i+4 <= len(buf); i += slot {
+		if !isHeader(i) {
+			continue
+		}
+		size := i
+		if h.Pad() {
+			size -= slot
+		}
+		j := i + size
+		if FrameHeader(buf[i : i+4]).Pad() {
+			j += slot
+		}
+		if j+4 > len(buf) || isHeader(j) {
+			return size
+		}
+	}
+	return 0
+}
+
+// sameFreeFormat reports whether the free format frames with headers a and
+// b can belong to the same stream, and so have the same length
+func sameFreeFormat(a, b FrameHeader) bool {
+	return a[1]&0xFE == b[1]&0xFE && a[2]&0xFC == b[2]&0xFC && a[3]&0xC0 == b[3]&0xC0
+}
+
+// clone returns a copy of the frame that does not share its buffer
+func (f *Frame) clone() *Frame {
+	return &Frame{buf: append([]byte(nil), f.buf...), corrupt: f.corrupt, free: f.free}
+}
+
+// NewFrame returns a Frame holding a copy of b, which must contain exactly one
+// complete frame, starting with its header. It allows frames built outside of
+// a Decoder, such as by an encoder, to be used with the rest of the package.
+// The length of a free format frame is taken to be that of b.
+func NewFrame(b []byte) (*Frame, error) {
+	if len(b) < 4 {
+		return nil, ErrBadHeader
+	}
+	f := &Frame{buf: append([]byte(nil), b...)}
+	h := f.Header()
+	if b[0] != 0xFF || b[1]&0xE0 != 0xE0 ||
+		h.Emphasis() == EmphReserved ||
+		h.Layer() == LayerReserved ||
+		h.Version() == MPEGReserved ||
+		h.SampleRate() == -1 ||
+		(h.BitRate() == -1 && !h.FreeFormat()) {
+		return nil, ErrBadHeader
+	}
+	if h.FreeFormat() {
+		f.free = len(b)
+		if h.Pad() {
+			f.free -= slotSize[h.Layer()]
+		}
+	}
+	if f.Size() != len(b) {
+		return nil, ErrFrameSize
+	}
+	return f, nil
+}
+
+// premature converts the EOF errors seen while reading the body of a
+// frame to ErrPrematureEOF
+func premature(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrPrematureEOF
+	}
+	return err
+}
+
 // SideInfoLength retursn the expected side info length for this
 // mp3 frame
 func (f *Frame) SideInfoLength() (int, error) {
@@ -308,6 +525,15 @@ func (f *Frame) SideInfo() FrameSideInfo {
 	return FrameSideInfo(f.buf[4:])
 }
 
+// Body returns the bytes following the header and any CRC word. For Layer I
+// and II frames this holds the bit allocation, scalefactors and samples.
+func (f *Frame) Body() []byte {
+	if f.Header().Protection() {
+		return f.buf[6:]
+	}
+	return f.buf[4:]
+}
+
 // Frame returns a string describing this frame, header and side info
 func (f *Frame) String() string {
 	str := ""
@@ -349,6 +575,13 @@ func (h FrameHeader) BitRate() FrameBitRate {
 	return FrameBitRate(br)
 }
 
+// FreeFormat reports whether the header gives the free format bit rate
+// index, used by streams whose bit rate is not one of those listed. The
+// header then gives no bit rate, see Frame.BitRate.
+func (h FrameHeader) FreeFormat() bool {
+	return (h[2]>>4)&0x0F == 0
+}
+
 // SampleRate returns the samplerate from the header
 func (h FrameHeader) SampleRate() FrameSampleRate {
 	sri := (h[2] >> 2) & 0x03
@@ -374,6 +607,13 @@ func (h FrameHeader) ChannelMode() FrameChannelMode {
 	return FrameChannelMode((h[3] >> 6) & 0x03)
 }
 
+// ModeExtension returns the mode extension bits from the header. For Layer I
+// and II joint stereo these select the intensity stereo bound, for Layer III
+// bit 1 enables mid/side stereo and bit 0 intensity stereo.
+func (h FrameHeader) ModeExtension() byte {
+	return (h[3] >> 4) & 0x03
+}
+
 // CopyRight returns the CopyRight bit from the header
 func (h FrameHeader) CopyRight() bool {
 	return (h[3]>>3)&0x01 == 0x01
@@ -408,9 +648,10 @@ func (h FrameHeader) String() string {
 
 // NDataBegin is the number of bytes before the frame header at which the sample data begins
 // 0 indicates that the data begins after the side channel information. This data is the
-// data from the "bit reservoir" and can be up to 511 bytes
+// data from the "bit reservoir" and can be up to 511 bytes. This assumes the MPEG-1
+// 9 bit layout, use Parse for a version aware result.
 func (i FrameSideInfo) NDataBegin() uint16 {
-	return (uint16(i[0]) << 1 & (uint16(i[1]) >> 7))
+	return (uint16(i[0]) << 1) | (uint16(i[1]) >> 7)
 }
 
 // Samples determines the number of samples based on the MPEG version and Layer from the header
@@ -419,14 +660,38 @@ func (f *Frame) Samples() int {
 }
 
 // Size clculates the expected size of this frame in bytes based on the header
-// information
+// information. That of a free format frame is found by the Decoder.
 func (f *Frame) Size() int {
-	bps := float64(f.Samples()) / 8
-	fsize := (bps * float64(f.Header().BitRate())) / float64(f.Header().SampleRate())
-	if f.Header().Pad() {
-		fsize += float64(slotSize[f.Header().Layer()])
+	h := f.Header()
+	slot := slotSize[h.Layer()]
+	sr := int(h.SampleRate())
+	if slot == 0 || sr <= 0 {
+		return 0
+	}
+	if h.FreeFormat() {
+		if h.Pad() && f.free > 0 {
+			return f.free + slot
+		}
+		return f.free
 	}
-	return int(fsize)
+	// frames are a whole number of slots, which are 4 bytes for Layer I
+	slots := f.Samples() / 8 / slot * int(h.BitRate()) / sr
+	if h.Pad() {
+		slots++
+	}
+	return slots * slot
+}
+
+// BitRate returns the bit rate of the frame. That of a free format frame,
+// which the header does not give, is found from the length of the frame, to
+// the nearest kbit/s.
+func (f *Frame) BitRate() FrameBitRate {
+	h := f.Header()
+	if !h.FreeFormat() || f.free == 0 {
+		return h.BitRate()
+	}
+	br := f.free * 8 * int(h.SampleRate()) / f.Samples()
+	return FrameBitRate((br + 500) / 1000 * 1000)
 }
 
 // Duration calculates the time duration of this frame based on the samplerate and number of samples
@@ -442,6 +707,12 @@ func (i FrameSideInfo) String() string {
 	return str
 }
 
+// Bytes returns the raw bytes of the frame, including its header. The slice
+// is shared with the frame, and is reused by the next call to Decode.
+func (f *Frame) Bytes() []byte {
+	return f.buf
+}
+
 // Reader returns an io.Reader that reads the individual bytes from the frame
 func (f *Frame) Reader() io.Reader {
 	return bytes.NewReader(f.buf)
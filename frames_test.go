@@ -1,7 +1,9 @@
 package mp3
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"testing"
 )
@@ -40,3 +42,165 @@ func ExampleDecoder_Decode() {
 		fmt.Println(&f)
 	}
 }
+
+func TestParseSideInfo(t *testing.T) {
+	si, err := SilentFrame.ParseSideInfo()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if si.Granules != 2 || si.Channels != 2 {
+		t.Fatalf("expected 2 granules and 2 channels, got %d and %d", si.Granules, si.Channels)
+	}
+	if int(SilentFrame.SideInfo().NDataBegin()) != si.MainDataBegin {
+		t.Errorf("NDataBegin %d does not match MainDataBegin %d", SilentFrame.SideInfo().NDataBegin(), si.MainDataBegin)
+	}
+	g := si.Granule[0][0]
+	if g.GlobalGain == 0 || g.Part2_3Length > 4095 || g.BigValues > 288 {
+		t.Errorf("implausible granule info %+v", g)
+	}
+}
+
+func TestParseSideInfoMPEG2(t *testing.T) {
+	// MPEG-2 mono: 8 bit main_data_begin and 1 private bit
+	h := FrameHeader{0xFF, 0xF3, 0x44, 0xC0}
+	si := FrameSideInfo{0x81, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	p, err := si.Parse(h)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if p.MainDataBegin != 0x81 || p.Granules != 1 || p.Channels != 1 {
+		t.Errorf("unexpected side info %+v", p)
+	}
+}
+
+func TestDecodeSkipsID3v2(t *testing.T) {
+	// a tag whose body looks like frame sync
+	body := bytes.Repeat([]byte{0xFF, 0xFB, 0xB0, 0x64}, 8)
+	tag := append([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, byte(len(body))}, body...)
+
+	var got []byte
+	d := NewDecoder(bytes.NewReader(append(tag, SilentBytes...)), WithID3v2Handler(func(b []byte) { got = b }))
+	skipped := 0
+	f := Frame{}
+	if err := d.Decode(&f, &skipped); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if skipped != 0 {
+		t.Errorf("expected 0 skipped bytes, got %d", skipped)
+	}
+	if !bytes.Equal(got, tag) {
+		t.Errorf("tag not passed to handler")
+	}
+	if f.Size() != len(SilentBytes) {
+		t.Errorf("expected silent frame, got size %d", f.Size())
+	}
+}
+
+func TestDecodeID3v23FooterFlag(t *testing.T) {
+	// the footer flag bit has no meaning before ID3v2.4, so no footer is
+	// skipped
+	body := make([]byte, 20)
+	tag := append([]byte{'I', 'D', '3', 3, 0, 0x10, 0, 0, 0, byte(len(body))}, body...)
+
+	var got []byte
+	d := NewDecoder(bytes.NewReader(append(tag, SilentBytes...)), WithID3v2Handler(func(b []byte) { got = b }))
+	skipped := 0
+	f := Frame{}
+	if err := d.Decode(&f, &skipped); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if skipped != 0 || !bytes.Equal(got, tag) {
+		t.Errorf("expected a %d byte tag and 0 skipped bytes, got %d and %d", len(tag), len(got), skipped)
+	}
+	if f.Size() != len(SilentBytes) {
+		t.Errorf("expected silent frame, got size %d", f.Size())
+	}
+}
+
+func TestNewFrame(t *testing.T) {
+	f, err := NewFrame(SilentBytes)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if !bytes.Equal(f.Bytes(), SilentBytes) {
+		t.Errorf("frame bytes differ from input")
+	}
+	if _, err := NewFrame(SilentBytes[:len(SilentBytes)-1]); err != ErrFrameSize {
+		t.Errorf("expected ErrFrameSize, got %v", err)
+	}
+	if _, err := NewFrame([]byte{0xFF, 0xFB, 0xF0, 0x00}); err != ErrBadHeader {
+		t.Errorf("expected ErrBadHeader, got %v", err)
+	}
+}
+
+// freeFrame returns a silent MPEG-1 Layer III free format frame, at 44.1kHz,
+// of the given length before padding, marked in its last byte
+func freeFrame(size int, pad bool, mark byte) []byte {
+	b := make([]byte, size)
+	b[0], b[1] = 0xFF, 0xFB
+	if pad {
+		b = append(b, 0)
+		b[2] |= 0x02
+	}
+	b[len(b)-1] = mark
+	return b
+}
+
+func TestDecodeFreeFormat(t *testing.T) {
+	// 640kbit/s, the first frame padded, with junk ahead of the fifth
+	var src []byte
+	for i := 0; i < 8; i++ {
+		if i == 4 {
+			src = append(src, "junk"...)
+		}
+		src = append(src, freeFrame(2089, i%3 == 0, byte(i))...)
+	}
+
+	d := NewDecoder(bytes.NewReader(src))
+	var f Frame
+	skipped := 0
+	for i := 0; i < 8; i++ {
+		if err := d.Decode(&f, &skipped); err != nil {
+			t.Fatalf("frame %d: unexpected error, %v", i, err)
+		}
+		if !f.Header().FreeFormat() || f.Header().BitRate() != ErrInvalidBitrate {
+			t.Errorf("frame %d: expected free format header", i)
+		}
+		if m := f.buf[len(f.buf)-1]; m != byte(i) {
+			t.Errorf("frame %d: got frame marked %d", i, m)
+		}
+		if f.Size() != len(f.buf) || f.Size() != 2089+len(f.buf)%2089 {
+			t.Errorf("frame %d: unexpected size %d for %d bytes", i, f.Size(), len(f.buf))
+		}
+		if br := f.BitRate(); br != 640000 {
+			t.Errorf("frame %d: expected 640kbit/s, got %d", i, br)
+		}
+		if want := 4 * (i / 4); i%4 == 0 && skipped != want {
+			t.Errorf("frame %d: expected %d skipped bytes, got %d", i, want, skipped)
+		}
+	}
+	if err := d.Decode(&f, &skipped); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+
+	// a header within the first frame is not followed by a third
+	src = nil
+	for i := 0; i < 4; i++ {
+		src = append(src, freeFrame(2089, false, byte(i))...)
+	}
+	copy(src[1000:], []byte{0xFF, 0xFB, 0x00, 0x00})
+	d = NewDecoder(bytes.NewReader(src))
+	for i := 0; i < 4; i++ {
+		if err := d.Decode(&f, &skipped); err != nil || len(f.buf) != 2089 {
+			t.Fatalf("frame %d: expected 2089 bytes, got %d, %v", i, len(f.buf), err)
+		}
+	}
+
+	f2, err := NewFrame(freeFrame(417, true, 0))
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if f2.Size() != 418 || f2.BitRate() != 128000 {
+		t.Errorf("expected 418 bytes at 128kbit/s, got %d at %d", f2.Size(), f2.BitRate())
+	}
+}
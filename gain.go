@@ -0,0 +1,301 @@
+package mp3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/tcolgate/mp3/internal/bits"
+)
+
+type (
+	// GainOption configures optional Gain behaviour
+	GainOption func(*gainer)
+
+	// gainer holds the state of a Gain
+	gainer struct {
+		peak     float64
+		clipping bool
+
+		min, max int // the range of the global gains seen
+		ape      *APETag
+		id3v1    *ID3v1Tag
+		err      error
+	}
+)
+
+var (
+	// gainStep is the change in level, in dB, of one step of global gain
+	gainStep = 20 * math.Log10(math.Pow(2, 0.25))
+
+	// ErrGainRange indicates a change of gain that would take the global
+	// gain of a granule outside the range of the field, 0 to 255
+	ErrGainRange = errors.New("global gain out of range")
+)
+
+// WithPeak gives the peak sample amplitude of the stream, 1.0 being full
+// scale, which Gain uses to avoid clipping. The peak recorded in a LAME tag
+// of the stream is used otherwise.
+func WithPeak(peak float64) GainOption {
+	return func(g *gainer) {
+		g.peak = peak
+	}
+}
+
+// WithClipping allows Gain to raise the level of the stream past the point
+// at which its peak would clip
+func WithClipping() GainOption {
+	return func(g *gainer) {
+		g.clipping = true
+	}
+}
+
+// AdjustGain changes the global gain of every granule and channel of the
+// Layer III frame by steps of about 1.5dB. The CRC of a protected frame is
+// updated to match. ErrGainRange is returned, and the frame left unchanged,
+// if any global gain would leave the range of the field. Channels with no
+// Huffman data are silent at any gain, and are only kept within the range.
+func (f *Frame) AdjustGain(steps int) error {
+	si, err := f.ParseSideInfo()
+	if err != nil {
+		return err
+	}
+	for gr := 0; gr < si.Granules; gr++ {
+		if !si.gainInRange(gr, steps) {
+			return ErrGainRange
+		}
+	}
+	for gr := 0; gr < si.Granules; gr++ {
+		if err := f.setGranuleGain(si, gr, func(v int) int { return limitGain(v + steps) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AdjustGranuleGain changes the global gain of every channel of granule gr
+// of the Layer III frame, as AdjustGain
+func (f *Frame) AdjustGranuleGain(gr, steps int) error {
+	si, err := f.ParseSideInfo()
+	if err != nil {
+		return err
+	}
+	if gr < 0 || gr >= si.Granules {
+		return fmt.Errorf("no granule %d", gr)
+	}
+	if !si.gainInRange(gr, steps) {
+		return ErrGainRange
+	}
+	return f.setGranuleGain(si, gr, func(v int) int { return limitGain(v + steps) })
+}
+
+// setGranuleGain sets the global gain of each channel of granule gr to that
+// returned by gain for its current value, which must be in range, and
+// updates the CRC of a protected frame
+func (f *Frame) setGranuleGain(si *Layer3SideInfo, gr int, gain func(v int) int) error {
+	off := 4
+	if f.Header().Protection() {
+		off += 2
+	}
+	for ch := 0; ch < si.Channels; ch++ {
+		v := gain(si.Granule[gr][ch].GlobalGain)
+		bits.Put(f.buf, off*8+si.GlobalGainPos(gr, ch), uint32(v), 8)
+	}
+	if !f.Header().Protection() {
+		return nil
+	}
+	crc, err := f.ComputeCRC()
+	if err != nil {
+		return err
+	}
+	f.buf[4], f.buf[5] = byte(crc>>8), byte(crc)
+	return nil
+}
+
+// gainInRange reports whether a change of steps keeps the global gain of
+// every channel of granule gr that is not silent within the range of the
+// field
+func (si *Layer3SideInfo) gainInRange(gr, steps int) bool {
+	for ch := 0; ch < si.Channels; ch++ {
+		g := si.Granule[gr][ch]
+		if v := g.GlobalGain + steps; g.Part2_3Length != 0 && (v < 0 || v > 255) {
+			return false
+		}
+	}
+	return true
+}
+
+// limitGain limits v to the range of the global gain field
+func limitGain(v int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return v
+}
+
+// Gain copies the Layer III stream read from r to w, changing the global
+// gain of every granule by steps of about 1.5dB, in the manner of MP3Gain.
+// Unless WithClipping is given, a rise in level is limited so that the peak
+// of the stream, if known, does not clip. The steps applied are returned.
+// ErrGainRange is returned if the steps would take the global gain of a
+// granule that is not silent outside the range of the field, as the change
+// could then not be undone. The stream is written as it is read, so on any
+// error w is left holding part of a stream, and should be discarded.
+//
+// ID3 and APE tags are kept. The change is recorded, so that it can be
+// undone, in the MP3GAIN_UNDO and MP3GAIN_MINMAX items of an APE tag, and
+// in the MP3Gain field of the LAME tag if there is one, whose peak and
+// ReplayGain fields are also updated. The stream is written with a header
+// as by Writer.
+func Gain(w io.WriteSeeker, r io.Reader, steps int, opts ...GainOption) (int, error) {
+	g := &gainer{min: 255}
+	for _, o := range opts {
+		o(g)
+	}
+
+	d := NewDecoder(r,
+		WithID3v2Handler(func(tag []byte) {
+			if _, err := w.Write(tag); err != nil && g.err == nil {
+				g.err = err
+			}
+		}),
+		WithAPEHandler(func(t *APETag) { g.ape = t }),
+		WithID3v1Handler(func(t *ID3v1Tag) { g.id3v1 = t }))
+
+	var out *Writer
+	var tag *LAMETag
+	var f Frame
+	skipped := 0
+	for {
+		err := d.Decode(&f, &skipped)
+		if g.err != nil {
+			return 0, g.err
+		}
+		if err == io.EOF || err == ErrNoSyncBits || err == ErrPrematureEOF {
+			break
+		}
+		if err != nil && err != ErrCRCMismatch {
+			return 0, err
+		}
+		if f.IsStreamInfo() {
+			if out == nil && tag == nil {
+				tag, _ = f.LAME()
+			}
+			continue
+		}
+
+		if out == nil {
+			steps = g.limit(steps, tag)
+			var opts []WriterOption
+			if tag != nil {
+				l := *tag
+				l.MP3Gain += steps
+				l.Peak *= math.Pow(2, float64(steps)/4)
+				for _, rg := range []*ReplayGain{&l.RadioGain, &l.AudiophileGain} {
+					if rg.Name != 0 {
+						rg.Gain -= float64(steps) * gainStep
+					}
+				}
+				opts = append(opts, WithLAMETag(l))
+			}
+			out = NewWriter(w, opts...)
+		}
+
+		si, err := f.ParseSideInfo()
+		if err != nil {
+			return 0, err
+		}
+		for gr := 0; gr < si.Granules; gr++ {
+			for ch := 0; ch < si.Channels; ch++ {
+				if si.Granule[gr][ch].Part2_3Length == 0 {
+					continue
+				}
+				v := si.Granule[gr][ch].GlobalGain
+				if v < g.min {
+					g.min = v
+				}
+				if v > g.max {
+					g.max = v
+				}
+			}
+		}
+		if err := f.AdjustGain(steps); err != nil {
+			return 0, err
+		}
+		if err := out.WriteFrame(&f); err != nil {
+			return 0, err
+		}
+	}
+	if out == nil {
+		return 0, ErrNoFrames
+	}
+	if err := out.Close(); err != nil {
+		return steps, err
+	}
+
+	if _, err := w.Write(g.undo(steps).Bytes()); err != nil {
+		return steps, err
+	}
+	if g.id3v1 != nil {
+		if _, err := w.Write(g.id3v1.Bytes()); err != nil {
+			return steps, err
+		}
+	}
+	return steps, nil
+}
+
+// limit lowers a rise of steps so that the peak of the stream, given by
+// WithPeak or the LAME tag, does not clip
+func (g *gainer) limit(steps int, tag *LAMETag) int {
+	peak := g.peak
+	if peak == 0 && tag != nil {
+		peak = tag.Peak
+	}
+	if g.clipping || steps <= 0 || peak <= 0 {
+		return steps
+	}
+	max := int(math.Floor(4 * math.Log2(1/peak)))
+	if max < 0 {
+		max = 0
+	}
+	if steps > max {
+		steps = max
+	}
+	return steps
+}
+
+// undo returns the APE tag of the stream, holding the MP3Gain undo
+// information for a change of steps on top of any recorded before
+func (g *gainer) undo(steps int) *APETag {
+	t := g.ape
+	if t == nil {
+		t = &APETag{}
+	}
+	t.Version = 2000
+
+	var left, right int
+	if v := t.Item("MP3GAIN_UNDO"); v != nil {
+		fmt.Sscanf(string(v), "%d,%d", &left, &right)
+	}
+	t.set("MP3GAIN_UNDO", fmt.Sprintf("%+04d,%+04d,N", left+steps, right+steps))
+	if t.Item("MP3GAIN_MINMAX") == nil && g.min <= g.max {
+		t.set("MP3GAIN_MINMAX", fmt.Sprintf("%03d,%03d", g.min, g.max))
+	}
+	return t
+}
+
+// set sets the value of the item with the given key, adding it if need be
+func (t *APETag) set(key, value string) {
+	for i, it := range t.Items {
+		if strings.EqualFold(it.Key, key) {
+			t.Items[i].Value = []byte(value)
+			return
+		}
+	}
+	t.Items = append(t.Items, APEItem{Key: key, Value: []byte(value)})
+}
@@ -0,0 +1,193 @@
+package mp3
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/tcolgate/mp3/internal/bits"
+)
+
+// setGains sets the global gain of every granule of the frames
+func setGains(t *testing.T, fs []*Frame, v int) {
+	for _, f := range fs {
+		si, err := f.ParseSideInfo()
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		if err := f.AdjustGain(v - si.Granule[0][0].GlobalGain); err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+	}
+}
+
+// audible gives every granule of the frames a Huffman data length, so that
+// they are not taken to be silent
+func audible(t *testing.T, fs []*Frame) {
+	for _, f := range fs {
+		si, err := f.ParseSideInfo()
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		for gr := 0; gr < si.Granules; gr++ {
+			for ch := 0; ch < si.Channels; ch++ {
+				// part2_3_length and big_values precede the global gain
+				bits.Put(f.buf, 4*8+si.GlobalGainPos(gr, ch)-21, 8, 12)
+			}
+		}
+	}
+}
+
+func TestGlobalGainPos(t *testing.T) {
+	for _, h := range []FrameHeader{
+		{0xFF, 0xFB, 0x90, 0x00}, // MPEG-1 stereo
+		{0xFF, 0xFB, 0x90, 0xC0}, // MPEG-1 mono
+		{0xFF, 0xF2, 0x80, 0x00}, // MPEG-2 stereo, with CRC
+		{0xFF, 0xF3, 0x80, 0xC0}, // MPEG-2 mono
+	} {
+		g, err := NewSilenceGenerator(h)
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		f := g.Frame()
+		si, _ := f.ParseSideInfo()
+		want := 0
+		for gr := 0; gr < si.Granules; gr++ {
+			for ch := 0; ch < si.Channels; ch++ {
+				want++
+				f.AdjustGain(1)
+			}
+		}
+		si, _ = f.ParseSideInfo()
+		for gr := 0; gr < si.Granules; gr++ {
+			for ch := 0; ch < si.Channels; ch++ {
+				if v := si.Granule[gr][ch].GlobalGain; v != want {
+					t.Errorf("%x: granule %d channel %d has gain %d, expected %d", []byte(h), gr, ch, v, want)
+				}
+				if si.Granule[gr][ch].Part2_3Length != 0 || si.Granule[gr][ch].BigValues != 0 {
+					t.Errorf("%x: granule %d channel %d changed beyond global gain", []byte(h), gr, ch)
+				}
+			}
+		}
+		if err := f.CheckCRC(); err != nil {
+			t.Errorf("%x: %v", []byte(h), err)
+		}
+	}
+}
+
+func TestGain(t *testing.T) {
+	fs := markedFrames(t, 10)
+	audible(t, fs)
+	setGains(t, fs, 150)
+	if err := fs[5].AdjustGain(106); err != ErrGainRange {
+		t.Errorf("expected ErrGainRange, got %v", err)
+	}
+	fs[5].AdjustGain(101) // 251, which is raised to the limit
+
+	var src seekBuffer
+	src.Write([]byte("ID3\x03\x00\x00\x00\x00\x00\x00"))
+	w := NewWriter(&src, WithLAMETag(LAMETag{Peak: 0.5, RadioGain: ReplayGain{Name: 1, Gain: -3}}))
+	for _, f := range fs {
+		w.WriteFrame(f)
+	}
+	w.Close()
+	undo := &APETag{Items: []APEItem{{Key: "MP3GAIN_UNDO", Value: []byte("-002,-002,N")}}}
+	src.Write(undo.Bytes())
+	src.Write((&ID3v1Tag{Title: "Title"}).Bytes())
+
+	// a peak of 0.5 allows a rise of 6dB, 4 steps
+	var out seekBuffer
+	steps, err := Gain(&out, bytes.NewReader(src.buf), 6)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if steps != 4 {
+		t.Fatalf("expected 4 steps, got %d", steps)
+	}
+	if !bytes.HasPrefix(out.buf, []byte("ID3")) {
+		t.Errorf("ID3v2 tag not kept")
+	}
+
+	var ape *APETag
+	var id3v1 *ID3v1Tag
+	d := NewDecoder(bytes.NewReader(out.buf),
+		WithAPEHandler(func(t *APETag) { ape = t }),
+		WithID3v1Handler(func(t *ID3v1Tag) { id3v1 = t }))
+	var f Frame
+	var skipped int
+	if err := d.Decode(&f, &skipped); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	l, err := f.LAME()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if l.MP3Gain != 4 || math.Abs(l.Peak-1) > 1e-6 || math.Abs(l.RadioGain.Gain+9) > 0.1 {
+		t.Errorf("unexpected tag %+v", l)
+	}
+	for i := 0; ; i++ {
+		err := d.Decode(&f, &skipped)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		si, _ := f.ParseSideInfo()
+		want := 154
+		if i == 5 {
+			want = 255
+		}
+		if v := si.Granule[1][1].GlobalGain; v != want {
+			t.Errorf("frame %d: expected gain %d, got %d", i, want, v)
+		}
+	}
+
+	if ape == nil || string(ape.Item("MP3GAIN_UNDO")) != "+002,+002,N" || string(ape.Item("MP3GAIN_MINMAX")) != "150,251" {
+		t.Errorf("unexpected APE tag %+v", ape)
+	}
+	if id3v1 == nil || id3v1.Title != "Title" {
+		t.Errorf("ID3v1 tag not kept")
+	}
+
+	// a further step would take frame 5 past the range of the field
+	if _, err := Gain(&seekBuffer{}, bytes.NewReader(src.buf), 5, WithClipping()); err != ErrGainRange {
+		t.Errorf("expected ErrGainRange, got %v", err)
+	}
+}
+
+func TestGainSilence(t *testing.T) {
+	// the silent frames of the package have a global gain of 0
+	g, err := NewSilenceGenerator(FrameHeader{0xFF, 0xFB, 0x90, 0x00})
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	var src bytes.Buffer
+	for i := 0; i < 5; i++ {
+		src.Write(g.Frame().Bytes())
+	}
+
+	var out seekBuffer
+	steps, err := Gain(&out, bytes.NewReader(src.Bytes()), -3)
+	if err != nil || steps != -3 {
+		t.Fatalf("expected -3 steps, got %d, %v", steps, err)
+	}
+	d := NewDecoder(bytes.NewReader(out.buf))
+	var f Frame
+	var skipped int
+	frames := 0
+	for d.Decode(&f, &skipped) == nil {
+		if f.IsStreamInfo() {
+			continue
+		}
+		frames++
+		si, _ := f.ParseSideInfo()
+		if v := si.Granule[0][0].GlobalGain; v != 0 {
+			t.Errorf("expected silent gain of 0, got %d", v)
+		}
+	}
+	if frames != 5 {
+		t.Errorf("expected 5 frames, got %d", frames)
+	}
+}
@@ -0,0 +1,35 @@
+package id3_test
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tcolgate/mp3"
+	"github.com/tcolgate/mp3/id3"
+)
+
+func ExampleParse() {
+	r, err := os.Open("file.mp3")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	d := mp3.NewDecoder(r, mp3.WithID3v2Handler(func(b []byte) {
+		tag, err := id3.Parse(b)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(tag.Artist(), "-", tag.Title())
+	}))
+
+	var f mp3.Frame
+	skipped := 0
+	for {
+		if err := d.Decode(&f, &skipped); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+}
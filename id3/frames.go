@@ -0,0 +1,204 @@
+package id3
+
+import (
+	"strings"
+)
+
+type (
+	// Comment is the content of a COMM frame. USLT frames share the same
+	// layout and are also returned as Comments.
+	Comment struct {
+		Language    string
+		Description string
+		Text        string
+	}
+
+	// Picture is the content of an APIC frame
+	Picture struct {
+		MIMEType    string
+		Type        byte
+		Description string
+		Data        []byte
+	}
+
+	// UserText is the content of a TXXX frame
+	UserText struct {
+		Description string
+		Value       string
+	}
+
+	// Private is the content of a PRIV frame
+	Private struct {
+		Owner string
+		Data  []byte
+	}
+
+	// UniqueFileID is the content of a UFID frame
+	UniqueFileID struct {
+		Owner      string
+		Identifier []byte
+	}
+)
+
+// readable reports whether the frame content can be interpreted
+func (f *Frame) readable() bool {
+	return f.FormatFlags&(FlagEncryption|FlagCompression) == 0
+}
+
+// Values returns the values of a text information frame. ID3v2.4 allows
+// several null separated values in one frame.
+func (f *Frame) Values() []string {
+	if !f.readable() || len(f.Data) < 1 {
+		return nil
+	}
+	return splitValues(f.Data[0], f.Data[1:])
+}
+
+// Text returns the first value of the text information frame with the given
+// identifier, or an empty string
+func (t *Tag) Text(id string) string {
+	f := t.Frame(id)
+	if f == nil {
+		return ""
+	}
+	vs := f.Values()
+	if len(vs) == 0 {
+		return ""
+	}
+	return vs[0]
+}
+
+// Title returns the TIT2 title
+func (t *Tag) Title() string {
+	return t.Text("TIT2")
+}
+
+// Artist returns the TPE1 lead artist
+func (t *Tag) Artist() string {
+	return t.Text("TPE1")
+}
+
+// Album returns the TALB album title
+func (t *Tag) Album() string {
+	return t.Text("TALB")
+}
+
+// Track returns the TRCK track number, which may be in the form "n/total"
+func (t *Tag) Track() string {
+	return t.Text("TRCK")
+}
+
+// Year returns the recording year, from TDRC in ID3v2.4 tags or TYER
+// otherwise
+func (t *Tag) Year() string {
+	if y := t.Text("TDRC"); y != "" {
+		if len(y) > 4 {
+			y = y[:4]
+		}
+		return y
+	}
+	return t.Text("TYER")
+}
+
+// Comments returns the content of all COMM frames
+func (t *Tag) Comments() []Comment {
+	return t.langTexts("COMM")
+}
+
+// Lyrics returns the content of all USLT frames
+func (t *Tag) Lyrics() []Comment {
+	return t.langTexts("USLT")
+}
+
+func (t *Tag) langTexts(id string) []Comment {
+	var cs []Comment
+	for _, f := range t.FramesByID(id) {
+		if !f.readable() || len(f.Data) < 4 {
+			continue
+		}
+		enc := f.Data[0]
+		c := Comment{Language: string(f.Data[1:4])}
+		var rest []byte
+		c.Description, rest = splitTerminated(enc, f.Data[4:])
+		c.Text = decodeText(enc, rest)
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// Pictures returns the content of all APIC frames
+func (t *Tag) Pictures() []Picture {
+	var ps []Picture
+	for _, f := range t.FramesByID("APIC") {
+		if !f.readable() || len(f.Data) < 1 {
+			continue
+		}
+		enc := f.Data[0]
+		p := Picture{}
+		var rest []byte
+		p.MIMEType, rest = splitTerminated(EncodingISO88591, f.Data[1:])
+		if len(rest) < 1 {
+			continue
+		}
+		p.Type = rest[0]
+		p.Description, p.Data = splitTerminated(enc, rest[1:])
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// UserTexts returns the content of all TXXX frames
+func (t *Tag) UserTexts() []UserText {
+	var us []UserText
+	for _, f := range t.FramesByID("TXXX") {
+		if !f.readable() || len(f.Data) < 1 {
+			continue
+		}
+		enc := f.Data[0]
+		u := UserText{}
+		var rest []byte
+		u.Description, rest = splitTerminated(enc, f.Data[1:])
+		u.Value = decodeText(enc, rest)
+		us = append(us, u)
+	}
+	return us
+}
+
+// UserText returns the value of the TXXX frame with the given description,
+// compared case insensitively, or an empty string
+func (t *Tag) UserText(desc string) string {
+	for _, u := range t.UserTexts() {
+		if strings.EqualFold(u.Description, desc) {
+			return u.Value
+		}
+	}
+	return ""
+}
+
+// Privates returns the content of all PRIV frames
+func (t *Tag) Privates() []Private {
+	var ps []Private
+	for _, f := range t.FramesByID("PRIV") {
+		if !f.readable() {
+			continue
+		}
+		p := Private{}
+		p.Owner, p.Data = splitTerminated(EncodingISO88591, f.Data)
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// UniqueFileIDs returns the content of all UFID frames
+func (t *Tag) UniqueFileIDs() []UniqueFileID {
+	var us []UniqueFileID
+	for _, f := range t.FramesByID("UFID") {
+		if !f.readable() {
+			continue
+		}
+		u := UniqueFileID{}
+		u.Owner, u.Identifier = splitTerminated(EncodingISO88591, f.Data)
+		us = append(us, u)
+	}
+	return us
+}
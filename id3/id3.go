@@ -0,0 +1,431 @@
+// Package id3 reads ID3v2.2, ID3v2.3 and ID3v2.4 tags.
+//
+// A tag can be read directly from the start of the same io.Reader that is
+// later handed to an mp3.Decoder, using Read, or parsed from the raw bytes
+// passed to a handler registered with mp3.WithID3v2Handler, using Parse.
+package id3
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/tcolgate/mp3"
+)
+
+type (
+	// Tag is a decoded ID3v2 tag
+	Tag struct {
+		// Version is the major version of the tag, 2, 3 or 4
+		Version byte
+		// Revision is the minor version of the tag
+		Revision byte
+		// Flags holds the tag header flags
+		Flags byte
+		// ExtendedHeader holds the raw extended header, if present
+		ExtendedHeader []byte
+		// Frames holds the tag frames in the order they were found
+		Frames []*Frame
+		// Size is the size of the tag as stored, including the header, any
+		// footer and any padding
+		Size int
+		// Padding is the number of padding bytes found after the last frame
+		Padding int
+	}
+
+	// Frame is a single ID3v2 frame. Data holds the frame content with any
+	// unsynchronisation and compression removed. ID3v2.2 frames are
+	// translated to their ID3v2.3 equivalents where one exists.
+	Frame struct {
+		ID string
+		// StatusFlags and FormatFlags are the frame flags, converted to the
+		// ID3v2.4 layout
+		StatusFlags byte
+		FormatFlags byte
+		// Group is the grouping identity, if FlagGrouping is set
+		Group byte
+		// EncryptionMethod is the encryption method, if FlagEncryption is set.
+		// Data is left encrypted.
+		EncryptionMethod byte
+		// DataLength is the length of the content once decrypted and
+		// decompressed, for encrypted frames that are also compressed
+		DataLength int
+		Data       []byte
+	}
+)
+
+// Tag header flags
+const (
+	FlagUnsynchronisation = 0x80
+	FlagExtendedHeader    = 0x40
+	FlagExperimental      = 0x20
+	FlagFooter            = 0x10
+)
+
+// Frame format flags, in the ID3v2.4 layout
+const (
+	FlagGrouping            = 0x40
+	FlagCompression         = 0x08
+	FlagEncryption          = 0x04
+	FlagFrameUnsync         = 0x02
+	FlagDataLengthIndicator = 0x01
+)
+
+// Frame status flags, in the ID3v2.4 layout
+const (
+	FlagTagAlterPreservation  = 0x40
+	FlagFileAlterPreservation = 0x20
+	FlagReadOnly              = 0x10
+)
+
+// HeaderLen is the length of the ID3v2 tag header and footer
+const HeaderLen = 10
+
+var (
+	// ErrNoTag indicates that the data did not start with an ID3v2 tag header
+	ErrNoTag = errors.New("id3: no ID3v2 tag")
+
+	// ErrUnsupportedVersion indicates a tag version this package can not read
+	ErrUnsupportedVersion = errors.New("id3: unsupported tag version")
+
+	// ErrTruncated indicates that the tag or one of its frames was cut short
+	ErrTruncated = errors.New("id3: tag truncated")
+)
+
+// v22IDs maps ID3v2.2 frame identifiers to their ID3v2.3 equivalents
+var v22IDs = map[string]string{
+	"BUF": "RBUF", "CNT": "PCNT", "COM": "COMM", "CRA": "AENC",
+	"ETC": "ETCO", "GEO": "GEOB", "IPL": "IPLS", "LNK": "LINK",
+	"MCI": "MCDI", "MLL": "MLLT", "PIC": "APIC", "POP": "POPM",
+	"REV": "RVRB", "RVA": "RVAD", "SLT": "SYLT", "STC": "SYTC",
+	"TAL": "TALB", "TBP": "TBPM", "TCM": "TCOM", "TCO": "TCON",
+	"TCR": "TCOP", "TDA": "TDAT", "TDY": "TDLY", "TEN": "TENC",
+	"TFT": "TFLT", "TIM": "TIME", "TKE": "TKEY", "TLA": "TLAN",
+	"TLE": "TLEN", "TMT": "TMED", "TOA": "TOPE", "TOF": "TOFN",
+	"TOL": "TOLY", "TOR": "TORY", "TOT": "TOAL", "TP1": "TPE1",
+	"TP2": "TPE2", "TP3": "TPE3", "TP4": "TPE4", "TPA": "TPOS",
+	"TPB": "TPUB", "TRC": "TSRC", "TRD": "TRDA", "TRK": "TRCK",
+	"TSI": "TSIZ", "TSS": "TSSE", "TT1": "TIT1", "TT2": "TIT2",
+	"TT3": "TIT3", "TXT": "TEXT", "TXX": "TXXX", "TYE": "TYER",
+	"UFI": "UFID", "ULT": "USLT", "WAF": "WOAF", "WAR": "WOAR",
+	"WAS": "WOAS", "WCM": "WCOM", "WCP": "WCOP", "WPB": "WPUB",
+	"WXX": "WXXX",
+}
+
+// Size returns the full size of the tag whose header starts b, including the
+// header and any footer. It returns false if b does not start with a valid
+// ID3v2 header.
+func Size(b []byte) (int, bool) {
+	return mp3.ID3v2Size(b)
+}
+
+// Read reads one complete ID3v2 tag from the start of r. On success r is left
+// positioned at the first byte after the tag, ready to be passed to an
+// mp3.Decoder. ErrNoTag is returned if r does not start with a tag, in which
+// case the header bytes have been consumed.
+func Read(r io.Reader) (*Tag, error) {
+	hdr := make([]byte, HeaderLen)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrNoTag
+		}
+		return nil, err
+	}
+	size, ok := Size(hdr)
+	if !ok {
+		return nil, ErrNoTag
+	}
+	buf := make([]byte, size)
+	copy(buf, hdr)
+	if _, err := io.ReadFull(r, buf[HeaderLen:]); err != nil {
+		return nil, ErrTruncated
+	}
+	return Parse(buf)
+}
+
+// Parse decodes a complete ID3v2 tag held in b
+func Parse(b []byte) (*Tag, error) {
+	size, ok := Size(b)
+	if !ok {
+		return nil, ErrNoTag
+	}
+	if len(b) < size {
+		return nil, ErrTruncated
+	}
+
+	t := &Tag{
+		Version:  b[3],
+		Revision: b[4],
+		Flags:    b[5],
+		Size:     size,
+	}
+	if t.Version < 2 || t.Version > 4 {
+		return nil, ErrUnsupportedVersion
+	}
+
+	body := b[HeaderLen:size]
+	if t.Version >= 4 && t.Flags&FlagFooter != 0 {
+		body = body[:len(body)-HeaderLen]
+	}
+
+	if t.Version < 4 && t.Flags&FlagUnsynchronisation != 0 {
+		body = Resync(body)
+	}
+
+	if t.Version == 2 && t.Flags&FlagExtendedHeader != 0 {
+		// In ID3v2.2 this bit marks a compressed tag, for which no scheme
+		// was ever defined
+		return nil, fmt.Errorf("id3: compressed ID3v2.2 tags are not supported")
+	}
+
+	if t.Version >= 3 && t.Flags&FlagExtendedHeader != 0 {
+		if len(body) < 4 {
+			return nil, ErrTruncated
+		}
+		var ext int
+		if t.Version == 3 {
+			ext = int(be32(body)) + 4
+		} else {
+			ext, ok = syncsafe(body[:4])
+			if !ok {
+				return nil, fmt.Errorf("id3: bad extended header size")
+			}
+		}
+		if ext > len(body) {
+			return nil, ErrTruncated
+		}
+		t.ExtendedHeader = body[:ext]
+		body = body[ext:]
+	}
+
+	for len(body) > 0 {
+		if body[0] == 0 {
+			t.Padding = len(body)
+			break
+		}
+		f, n, err := t.parseFrame(body)
+		if err != nil {
+			return t, err
+		}
+		t.Frames = append(t.Frames, f)
+		body = body[n:]
+	}
+
+	return t, nil
+}
+
+// parseFrame decodes the frame at the start of b, returning the number of
+// bytes it occupied
+func (t *Tag) parseFrame(b []byte) (*Frame, int, error) {
+	f := &Frame{}
+	var hlen, size int
+
+	switch t.Version {
+	case 2:
+		hlen = 6
+		if len(b) < hlen {
+			return nil, 0, ErrTruncated
+		}
+		id := string(b[0:3])
+		f.ID = id
+		if nid, ok := v22IDs[id]; ok {
+			f.ID = nid
+		}
+		size = int(b[3])<<16 | int(b[4])<<8 | int(b[5])
+	case 3:
+		hlen = 10
+		if len(b) < hlen {
+			return nil, 0, ErrTruncated
+		}
+		f.ID = string(b[0:4])
+		size = int(be32(b[4:8]))
+		f.StatusFlags = (b[8] >> 1) & 0x70
+		f.FormatFlags = v23FormatFlags(b[9])
+	case 4:
+		hlen = 10
+		if len(b) < hlen {
+			return nil, 0, ErrTruncated
+		}
+		f.ID = string(b[0:4])
+		var ok bool
+		size, ok = syncsafe(b[4:8])
+		if !ok {
+			return nil, 0, fmt.Errorf("id3: bad size for frame %q", f.ID)
+		}
+		f.StatusFlags = b[8]
+		f.FormatFlags = b[9]
+		if t.Flags&FlagUnsynchronisation != 0 {
+			f.FormatFlags |= FlagFrameUnsync
+		}
+	}
+
+	if hlen+size > len(b) {
+		return nil, 0, ErrTruncated
+	}
+	data := b[hlen : hlen+size]
+	if f.FormatFlags&FlagFrameUnsync != 0 {
+		data = Resync(data)
+	}
+
+	dlen := -1
+	if t.Version == 3 {
+		if f.FormatFlags&FlagCompression != 0 {
+			if len(data) < 4 {
+				return nil, 0, ErrTruncated
+			}
+			dlen = int(be32(data))
+			data = data[4:]
+		}
+		if f.FormatFlags&FlagEncryption != 0 {
+			if len(data) < 1 {
+				return nil, 0, ErrTruncated
+			}
+			f.EncryptionMethod = data[0]
+			data = data[1:]
+		}
+		if f.FormatFlags&FlagGrouping != 0 {
+			if len(data) < 1 {
+				return nil, 0, ErrTruncated
+			}
+			f.Group = data[0]
+			data = data[1:]
+		}
+	} else if t.Version == 4 {
+		if f.FormatFlags&FlagGrouping != 0 {
+			if len(data) < 1 {
+				return nil, 0, ErrTruncated
+			}
+			f.Group = data[0]
+			data = data[1:]
+		}
+		if f.FormatFlags&FlagEncryption != 0 {
+			if len(data) < 1 {
+				return nil, 0, ErrTruncated
+			}
+			f.EncryptionMethod = data[0]
+			data = data[1:]
+		}
+		if f.FormatFlags&FlagDataLengthIndicator != 0 {
+			if len(data) < 4 {
+				return nil, 0, ErrTruncated
+			}
+			dlen, _ = syncsafe(data[:4])
+			data = data[4:]
+		}
+	}
+
+	if f.FormatFlags&FlagCompression != 0 && f.FormatFlags&FlagEncryption == 0 {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, 0, fmt.Errorf("id3: frame %q, %v", f.ID, err)
+		}
+		data, err = ioutil.ReadAll(zr)
+		if err != nil {
+			return nil, 0, fmt.Errorf("id3: frame %q, %v", f.ID, err)
+		}
+		if dlen >= 0 && len(data) != dlen {
+			return nil, 0, fmt.Errorf("id3: frame %q decompressed to %d bytes, expected %d", f.ID, len(data), dlen)
+		}
+		f.FormatFlags &^= FlagCompression
+	} else if f.FormatFlags&FlagCompression != 0 {
+		f.DataLength = dlen
+	}
+	f.FormatFlags &^= FlagFrameUnsync | FlagDataLengthIndicator
+
+	if t.Version == 2 && f.ID == "APIC" {
+		data = picToAPIC(data)
+	}
+	f.Data = append([]byte(nil), data...)
+
+	return f, hlen + size, nil
+}
+
+// v23FormatFlags converts ID3v2.3 frame format flags to the ID3v2.4 layout
+func v23FormatFlags(b byte) byte {
+	var f byte
+	if b&0x80 != 0 {
+		f |= FlagCompression | FlagDataLengthIndicator
+	}
+	if b&0x40 != 0 {
+		f |= FlagEncryption
+	}
+	if b&0x20 != 0 {
+		f |= FlagGrouping
+	}
+	return f
+}
+
+// picToAPIC converts the body of an ID3v2.2 PIC frame to the APIC layout
+func picToAPIC(b []byte) []byte {
+	if len(b) < 4 {
+		return b
+	}
+	mime := "image/"
+	switch format := string(bytes.ToLower(b[1:4])); format {
+	case "jpg":
+		mime += "jpeg"
+	case "-->":
+		mime = "-->"
+	default:
+		mime += format
+	}
+	out := []byte{b[0]}
+	out = append(out, mime...)
+	out = append(out, 0)
+	return append(out, b[4:]...)
+}
+
+// Resync removes unsynchronisation from b, replacing every 0xFF 0x00 pair
+// with 0xFF
+func Resync(b []byte) []byte {
+	if bytes.Index(b, []byte{0xFF, 0x00}) == -1 {
+		return b
+	}
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xFF && i+1 < len(b) && b[i+1] == 0x00 {
+			i++
+		}
+	}
+	return out
+}
+
+func syncsafe(b []byte) (int, bool) {
+	v := 0
+	for _, c := range b {
+		if c&0x80 != 0 {
+			return 0, false
+		}
+		v = v<<7 | int(c)
+	}
+	return v, true
+}
+
+func be32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// Frame returns the first frame with the given identifier, or nil
+func (t *Tag) Frame(id string) *Frame {
+	for _, f := range t.Frames {
+		if f.ID == id {
+			return f
+		}
+	}
+	return nil
+}
+
+// FramesByID returns all frames with the given identifier
+func (t *Tag) FramesByID(id string) []*Frame {
+	var fs []*Frame
+	for _, f := range t.Frames {
+		if f.ID == id {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
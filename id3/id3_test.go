@@ -0,0 +1,99 @@
+package id3
+
+import (
+	"bytes"
+	"compress/zlib"
+	"testing"
+)
+
+func header(version, flags byte, size int) []byte {
+	return []byte{'I', 'D', '3', version, 0, flags,
+		byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+}
+
+func frame23(id string, flags byte, data []byte) []byte {
+	n := len(data)
+	b := []byte(id)
+	b = append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n), 0, flags)
+	return append(b, data...)
+}
+
+func TestParseV23(t *testing.T) {
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write([]byte("\x00An Album"))
+	zw.Close()
+	compressed := append([]byte{0, 0, 0, 9}, zbuf.Bytes()...)
+
+	var body []byte
+	body = append(body, frame23("TIT2", 0, []byte("\x00A Title"))...)
+	body = append(body, frame23("TPE1", 0, []byte{1, 0xFF, 0xFE, 'B', 0, 0xE9, 0, 0, 0})...)
+	body = append(body, frame23("TALB", 0x80, compressed)...)
+	body = append(body, frame23("COMM", 0, []byte("\x00engdesc\x00a comment"))...)
+	body = append(body, frame23("TXXX", 0, []byte("\x00REPLAYGAIN_TRACK_GAIN\x00-6.00 dB"))...)
+	body = append(body, make([]byte, 16)...)
+
+	tag, err := Parse(append(header(3, 0, len(body)), body...))
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if tag.Title() != "A Title" || tag.Artist() != "Bé" || tag.Album() != "An Album" {
+		t.Errorf("unexpected text frames %q %q %q", tag.Title(), tag.Artist(), tag.Album())
+	}
+	if cs := tag.Comments(); len(cs) != 1 || cs[0] != (Comment{"eng", "desc", "a comment"}) {
+		t.Errorf("unexpected comments %+v", cs)
+	}
+	if v := tag.UserText("replaygain_track_gain"); v != "-6.00 dB" {
+		t.Errorf("unexpected TXXX value %q", v)
+	}
+	if tag.Padding != 16 {
+		t.Errorf("expected 16 bytes padding, got %d", tag.Padding)
+	}
+}
+
+func TestParseV22Unsync(t *testing.T) {
+	pic := []byte("\x00JPG\x03cover\x00\xFF\x00\xD8\xFF\x00\xE0")
+	var body []byte
+	body = append(body, 'T', 'T', '2', 0, 0, 6)
+	body = append(body, "\x00Title"...)
+	// frame sizes count the data before unsynchronisation was applied
+	body = append(body, 'P', 'I', 'C', 0, 0, byte(len(Resync(pic))))
+	body = append(body, pic...)
+
+	tag, err := Parse(append(header(2, FlagUnsynchronisation, len(body)), body...))
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if tag.Title() != "Title" {
+		t.Errorf("unexpected title %q", tag.Title())
+	}
+	ps := tag.Pictures()
+	if len(ps) != 1 {
+		t.Fatalf("expected 1 picture, got %d", len(ps))
+	}
+	if ps[0].MIMEType != "image/jpeg" || ps[0].Type != 3 || ps[0].Description != "cover" ||
+		!bytes.Equal(ps[0].Data, []byte{0xFF, 0xD8, 0xFF, 0xE0}) {
+		t.Errorf("unexpected picture %+v", ps[0])
+	}
+}
+
+func TestReadV24(t *testing.T) {
+	data := []byte("\x032016-05-01\x00")
+	fr := []byte("TDRC")
+	fr = append(fr, 0, 0, 0, byte(len(data)), 0, 0)
+	fr = append(fr, data...)
+
+	src := append(header(4, 0, len(fr)), fr...)
+	src = append(src, "audio"...)
+	r := bytes.NewReader(src)
+	tag, err := Read(r)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if tag.Year() != "2016" {
+		t.Errorf("unexpected year %q", tag.Year())
+	}
+	if r.Len() != len("audio") {
+		t.Errorf("reader not left at end of tag")
+	}
+}
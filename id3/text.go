@@ -0,0 +1,131 @@
+package id3
+
+import (
+	"bytes"
+	"unicode/utf16"
+)
+
+// Text encodings used by ID3v2 frames
+const (
+	EncodingISO88591 byte = 0
+	EncodingUTF16    byte = 1 // UTF-16 with byte order mark
+	EncodingUTF16BE  byte = 2 // ID3v2.4 only
+	EncodingUTF8     byte = 3 // ID3v2.4 only
+)
+
+// decodeText converts b, encoded with enc, to a Go string. Trailing
+// terminators are removed.
+func decodeText(enc byte, b []byte) string {
+	switch enc {
+	case EncodingUTF16, EncodingUTF16BE:
+		bigEndian := enc == EncodingUTF16BE
+		if len(b) >= 2 {
+			switch {
+			case b[0] == 0xFE && b[1] == 0xFF:
+				bigEndian = true
+				b = b[2:]
+			case b[0] == 0xFF && b[1] == 0xFE:
+				bigEndian = false
+				b = b[2:]
+			}
+		}
+		u := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			if bigEndian {
+				u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+			} else {
+				u = append(u, uint16(b[i+1])<<8|uint16(b[i]))
+			}
+		}
+		for len(u) > 0 && u[len(u)-1] == 0 {
+			u = u[:len(u)-1]
+		}
+		return string(utf16.Decode(u))
+	case EncodingUTF8:
+		return string(bytes.TrimRight(b, "\x00"))
+	default:
+		b = bytes.TrimRight(b, "\x00")
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		return string(r)
+	}
+}
+
+// splitTerminated splits b at the first terminator for enc, returning the
+// text before it and the remaining bytes after it
+func splitTerminated(enc byte, b []byte) (string, []byte) {
+	if enc == EncodingUTF16 || enc == EncodingUTF16BE {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return decodeText(enc, b[:i]), b[i+2:]
+			}
+		}
+		return decodeText(enc, b), nil
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return decodeText(enc, b[:i]), b[i+1:]
+	}
+	return decodeText(enc, b), nil
+}
+
+// splitValues splits text frame content into its null separated values
+func splitValues(enc byte, b []byte) []string {
+	var vals []string
+	for len(b) > 0 {
+		var s string
+		s, b = splitTerminated(enc, b)
+		vals = append(vals, s)
+	}
+	return vals
+}
+
+// encodeText converts s to enc, without a terminator
+func encodeText(enc byte, s string) []byte {
+	switch enc {
+	case EncodingUTF16, EncodingUTF16BE:
+		u := utf16.Encode([]rune(s))
+		var out []byte
+		if enc == EncodingUTF16 {
+			out = append(out, 0xFF, 0xFE)
+			for _, c := range u {
+				out = append(out, byte(c), byte(c>>8))
+			}
+			return out
+		}
+		for _, c := range u {
+			out = append(out, byte(c>>8), byte(c))
+		}
+		return out
+	case EncodingUTF8:
+		return []byte(s)
+	default:
+		out := make([]byte, 0, len(s))
+		for _, r := range s {
+			if r > 0xFF {
+				r = '?'
+			}
+			out = append(out, byte(r))
+		}
+		return out
+	}
+}
+
+// terminator returns the string terminator for enc
+func terminator(enc byte) []byte {
+	if enc == EncodingUTF16 || enc == EncodingUTF16BE {
+		return []byte{0, 0}
+	}
+	return []byte{0}
+}
+
+// isLatin1 reports whether s can be stored as ISO-8859-1
+func isLatin1(s string) bool {
+	for _, r := range s {
+		if r > 0xFF {
+			return false
+		}
+	}
+	return true
+}
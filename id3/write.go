@@ -0,0 +1,457 @@
+package id3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/tcolgate/mp3"
+)
+
+// DefaultPadding is the padding added to tags written by UpdateFile when the
+// file has to be rewritten
+const DefaultPadding = 2048
+
+// maxTagSize is the largest size a 28 bit syncsafe integer can hold
+const maxTagSize = 1<<28 - 1
+
+// ErrTagTooLarge indicates that the tag exceeds the maximum ID3v2 size
+var ErrTagTooLarge = errors.New("id3: tag too large")
+
+// NewTag returns an empty tag of the given major version, 3 or 4
+func NewTag(version byte) *Tag {
+	return &Tag{Version: version}
+}
+
+// textEncoding picks the most compact encoding able to store s in this tag
+func (t *Tag) textEncoding(s ...string) byte {
+	for _, v := range s {
+		if !isLatin1(v) {
+			if t.Version >= 4 {
+				return EncodingUTF8
+			}
+			return EncodingUTF16
+		}
+	}
+	return EncodingISO88591
+}
+
+// RemoveFrames removes all frames with the given identifier
+func (t *Tag) RemoveFrames(id string) {
+	fs := t.Frames[:0]
+	for _, f := range t.Frames {
+		if f.ID != id {
+			fs = append(fs, f)
+		}
+	}
+	t.Frames = fs
+}
+
+// replace substitutes the frames matched by match with f, keeping the
+// position of the first match
+func (t *Tag) replace(f *Frame, match func(*Frame) bool) {
+	var fs []*Frame
+	done := false
+	for _, of := range t.Frames {
+		if !match(of) {
+			fs = append(fs, of)
+			continue
+		}
+		if !done {
+			fs = append(fs, f)
+			done = true
+		}
+	}
+	if !done {
+		fs = append(fs, f)
+	}
+	t.Frames = fs
+}
+
+// SetText sets the text information frame id to the given values, replacing
+// any existing frame. Multiple values are only supported by ID3v2.4.
+func (t *Tag) SetText(id string, values ...string) {
+	if len(values) == 0 {
+		t.RemoveFrames(id)
+		return
+	}
+	enc := t.textEncoding(values...)
+	data := []byte{enc}
+	for i, v := range values {
+		if i > 0 {
+			data = append(data, terminator(enc)...)
+		}
+		data = append(data, encodeText(enc, v)...)
+	}
+	t.replace(&Frame{ID: id, Data: data}, func(f *Frame) bool { return f.ID == id })
+}
+
+// SetTitle sets the TIT2 title
+func (t *Tag) SetTitle(s string) {
+	t.SetText("TIT2", s)
+}
+
+// SetArtist sets the TPE1 lead artist
+func (t *Tag) SetArtist(s string) {
+	t.SetText("TPE1", s)
+}
+
+// SetAlbum sets the TALB album title
+func (t *Tag) SetAlbum(s string) {
+	t.SetText("TALB", s)
+}
+
+// SetTrack sets the TRCK track number
+func (t *Tag) SetTrack(s string) {
+	t.SetText("TRCK", s)
+}
+
+// SetYear sets the recording year, as TDRC for ID3v2.4 tags and TYER
+// otherwise
+func (t *Tag) SetYear(s string) {
+	if t.Version >= 4 {
+		t.RemoveFrames("TYER")
+		t.SetText("TDRC", s)
+		return
+	}
+	t.RemoveFrames("TDRC")
+	t.SetText("TYER", s)
+}
+
+// SetComment adds a COMM frame, replacing any with the same language and
+// description
+func (t *Tag) SetComment(c Comment) {
+	t.setLangText("COMM", c)
+}
+
+// SetLyrics adds a USLT frame, replacing any with the same language and
+// description
+func (t *Tag) SetLyrics(c Comment) {
+	t.setLangText("USLT", c)
+}
+
+func (t *Tag) setLangText(id string, c Comment) {
+	lang := []byte((c.Language + "XXX")[:3])
+	enc := t.textEncoding(c.Description, c.Text)
+	data := []byte{enc}
+	data = append(data, lang...)
+	data = append(data, encodeText(enc, c.Description)...)
+	data = append(data, terminator(enc)...)
+	data = append(data, encodeText(enc, c.Text)...)
+
+	nt := &Tag{Version: t.Version}
+	t.replace(&Frame{ID: id, Data: data}, func(f *Frame) bool {
+		if f.ID != id {
+			return false
+		}
+		nt.Frames = []*Frame{f}
+		cs := nt.langTexts(id)
+		return len(cs) == 1 && cs[0].Language == string(lang) && cs[0].Description == c.Description
+	})
+}
+
+// SetUserText sets a TXXX frame, replacing any with the same description
+func (t *Tag) SetUserText(desc, value string) {
+	enc := t.textEncoding(desc, value)
+	data := []byte{enc}
+	data = append(data, encodeText(enc, desc)...)
+	data = append(data, terminator(enc)...)
+	data = append(data, encodeText(enc, value)...)
+
+	nt := &Tag{Version: t.Version}
+	t.replace(&Frame{ID: "TXXX", Data: data}, func(f *Frame) bool {
+		if f.ID != "TXXX" {
+			return false
+		}
+		nt.Frames = []*Frame{f}
+		us := nt.UserTexts()
+		return len(us) == 1 && us[0].Description == desc
+	})
+}
+
+// AddPicture adds an APIC frame, replacing any picture of the same type
+// and description
+func (t *Tag) AddPicture(p Picture) {
+	enc := t.textEncoding(p.Description)
+	data := []byte{enc}
+	data = append(data, p.MIMEType...)
+	data = append(data, 0, p.Type)
+	data = append(data, encodeText(enc, p.Description)...)
+	data = append(data, terminator(enc)...)
+	data = append(data, p.Data...)
+
+	nt := &Tag{Version: t.Version}
+	t.replace(&Frame{ID: "APIC", Data: data}, func(f *Frame) bool {
+		if f.ID != "APIC" {
+			return false
+		}
+		nt.Frames = []*Frame{f}
+		ps := nt.Pictures()
+		return len(ps) == 1 && ps[0].Type == p.Type && ps[0].Description == p.Description
+	})
+}
+
+// encodeFrame serialises a single frame for the given tag version
+func encodeFrame(version byte, f *Frame) ([]byte, error) {
+	if len(f.ID) != 4 {
+		return nil, fmt.Errorf("id3: can not write frame %q", f.ID)
+	}
+
+	// only encrypted frames are kept compressed, the content of others is
+	// written as it is
+	compressed := f.FormatFlags&(FlagCompression|FlagEncryption) == FlagCompression|FlagEncryption
+
+	data := f.Data
+	var extra []byte
+	var status, format byte
+	if version == 3 {
+		data = v23Data(f)
+		status = f.StatusFlags << 1 & 0xE0
+		if compressed {
+			format |= 0x80
+			n := f.DataLength
+			extra = append(extra, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+		}
+		if f.FormatFlags&FlagEncryption != 0 {
+			format |= 0x40
+			extra = append(extra, f.EncryptionMethod)
+		}
+		if f.FormatFlags&FlagGrouping != 0 {
+			format |= 0x20
+			extra = append(extra, f.Group)
+		}
+	} else {
+		status = f.StatusFlags & 0x70
+		if f.FormatFlags&FlagGrouping != 0 {
+			format |= FlagGrouping
+			extra = append(extra, f.Group)
+		}
+		if f.FormatFlags&FlagEncryption != 0 {
+			format |= FlagEncryption
+			extra = append(extra, f.EncryptionMethod)
+		}
+		if compressed {
+			format |= FlagCompression | FlagDataLengthIndicator
+			extra = append(extra, putSyncsafe(f.DataLength)...)
+		}
+	}
+
+	size := len(extra) + len(data)
+	if size > maxTagSize {
+		return nil, ErrTagTooLarge
+	}
+	b := make([]byte, 0, 10+size)
+	b = append(b, f.ID...)
+	if version == 3 {
+		b = append(b, byte(size>>24), byte(size>>16), byte(size>>8), byte(size))
+	} else {
+		b = append(b, putSyncsafe(size)...)
+	}
+	b = append(b, status, format)
+	b = append(b, extra...)
+	return append(b, data...), nil
+}
+
+// v23Data returns the content of f for an ID3v2.3 tag. Text in the UTF-8
+// and UTF-16BE encodings, which ID3v2.3 lacks, is converted to UTF-16 in
+// the text, TXXX, COMM, USLT and APIC frames. Other frames are left as they
+// are.
+func v23Data(f *Frame) []byte {
+	if !f.readable() || len(f.Data) < 1 ||
+		(f.Data[0] != EncodingUTF8 && f.Data[0] != EncodingUTF16BE) {
+		return f.Data
+	}
+	enc := f.Data[0]
+	data := []byte{EncodingUTF16}
+	text := func(s string) {
+		data = append(data, encodeText(EncodingUTF16, s)...)
+	}
+	term := func() {
+		data = append(data, terminator(EncodingUTF16)...)
+	}
+
+	switch {
+	case f.ID == "TXXX":
+		desc, rest := splitTerminated(enc, f.Data[1:])
+		text(desc)
+		term()
+		text(decodeText(enc, rest))
+	case f.ID == "COMM" || f.ID == "USLT":
+		if len(f.Data) < 4 {
+			return f.Data
+		}
+		data = append(data, f.Data[1:4]...)
+		desc, rest := splitTerminated(enc, f.Data[4:])
+		text(desc)
+		term()
+		text(decodeText(enc, rest))
+	case f.ID == "APIC":
+		i := bytes.IndexByte(f.Data[1:], 0) + 1
+		if i == 0 || i+1 >= len(f.Data) {
+			return f.Data
+		}
+		data = append(data, f.Data[1:i+2]...) // MIME type and picture type
+		desc, pic := splitTerminated(enc, f.Data[i+2:])
+		text(desc)
+		term()
+		data = append(data, pic...)
+	case f.ID[0] == 'T':
+		for i, v := range splitValues(enc, f.Data[1:]) {
+			if i > 0 {
+				term()
+			}
+			text(v)
+		}
+	default:
+		return f.Data
+	}
+	return data
+}
+
+// Encode serialises the tag, followed by padding bytes of padding. ID3v2.2
+// tags are written as ID3v2.3. Unsynchronisation, compression and extended
+// headers are not written, other than the compression of encrypted frames,
+// whose content can not be decompressed.
+func (t *Tag) Encode(padding int) ([]byte, error) {
+	version := t.Version
+	if version < 3 {
+		version = 3
+	}
+	if version > 4 {
+		return nil, ErrUnsupportedVersion
+	}
+
+	var body []byte
+	for _, f := range t.Frames {
+		fb, err := encodeFrame(version, f)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, fb...)
+	}
+	body = append(body, make([]byte, padding)...)
+	if len(body) > maxTagSize {
+		return nil, ErrTagTooLarge
+	}
+
+	b := []byte{'I', 'D', '3', version, 0, 0}
+	b = append(b, putSyncsafe(len(body))...)
+	return append(b, body...), nil
+}
+
+// WriteTo writes the tag to w, including the padding recorded in Padding
+func (t *Tag) WriteTo(w io.Writer) (int64, error) {
+	b, err := t.Encode(t.Padding)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// UpdateFile replaces the ID3v2 tag at the start of the named file with t,
+// adding one if none is present. If the new tag fits in the space of the
+// existing one, including its padding, the tag is rewritten in place and the
+// audio is left untouched. Otherwise the file is rewritten, with the audio
+// frames copied unchanged through an mp3.Decoder. Any ID3v1 and APE
+// trailers are kept.
+func UpdateFile(name string, t *Tag) error {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hdr := make([]byte, HeaderLen)
+	oldSize := 0
+	if _, err := io.ReadFull(f, hdr); err == nil {
+		oldSize, _ = Size(hdr)
+	}
+
+	b, err := t.Encode(0)
+	if err != nil {
+		return err
+	}
+	if oldSize > 0 && len(b) <= oldSize {
+		if b, err = t.Encode(oldSize - len(b)); err != nil {
+			return err
+		}
+		_, err = f.WriteAt(b, 0)
+		return err
+	}
+
+	if b, err = t.Encode(DefaultPadding); err != nil {
+		return err
+	}
+	return rewrite(f, name, b)
+}
+
+// rewrite writes tag followed by the audio frames of src to a temporary file
+// which then replaces the file called name
+func rewrite(src *os.File, name string, tag []byte) error {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := tmp.Write(tag); err != nil {
+		return err
+	}
+
+	// trailing tags are kept, in the order they were found
+	var trailers [][]byte
+	d := mp3.NewDecoder(src,
+		mp3.WithAPEHandler(func(t *mp3.APETag) {
+			if t.Items != nil {
+				trailers = append(trailers, t.Bytes())
+			}
+		}),
+		mp3.WithID3v1Handler(func(t *mp3.ID3v1Tag) {
+			trailers = append(trailers, t.Bytes())
+		}))
+	var fr mp3.Frame
+	skipped := 0
+	for {
+		err := d.Decode(&fr, &skipped)
+		if err == io.EOF || err == mp3.ErrNoSyncBits || err == mp3.ErrPrematureEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(tmp, fr.Reader()); err != nil {
+			return err
+		}
+	}
+	for _, t := range trailers {
+		if _, err := tmp.Write(t); err != nil {
+			return err
+		}
+	}
+
+	if err := tmp.Chmod(fi.Mode()); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func putSyncsafe(v int) []byte {
+	return []byte{byte(v >> 21 & 0x7F), byte(v >> 14 & 0x7F), byte(v >> 7 & 0x7F), byte(v & 0x7F)}
+}
@@ -0,0 +1,153 @@
+package id3
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tcolgate/mp3"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, v := range []byte{3, 4} {
+		tag := NewTag(v)
+		tag.SetTitle("Title")
+		tag.SetArtist("Ærtist ☃")
+		tag.SetYear("1999")
+		tag.SetComment(Comment{"eng", "", "comment"})
+		tag.SetUserText("REPLAYGAIN_TRACK_GAIN", "-1.00 dB")
+		tag.AddPicture(Picture{MIMEType: "image/png", Type: 3, Data: []byte{1, 2, 3}})
+		tag.SetTitle("New Title")
+
+		b, err := tag.Encode(32)
+		if err != nil {
+			t.Fatalf("v2.%d: unexpected error, %v", v, err)
+		}
+		got, err := Parse(b)
+		if err != nil {
+			t.Fatalf("v2.%d: unexpected error, %v", v, err)
+		}
+		if got.Title() != "New Title" || got.Artist() != "Ærtist ☃" || got.Year() != "1999" {
+			t.Errorf("v2.%d: unexpected text %q %q %q", v, got.Title(), got.Artist(), got.Year())
+		}
+		if len(got.FramesByID("TIT2")) != 1 {
+			t.Errorf("v2.%d: expected a single title frame", v)
+		}
+		if cs := got.Comments(); len(cs) != 1 || cs[0].Text != "comment" {
+			t.Errorf("v2.%d: unexpected comments %+v", v, cs)
+		}
+		if ps := got.Pictures(); len(ps) != 1 || !bytes.Equal(ps[0].Data, []byte{1, 2, 3}) {
+			t.Errorf("v2.%d: unexpected pictures %+v", v, ps)
+		}
+		if got.Padding != 32 {
+			t.Errorf("v2.%d: expected 32 bytes padding, got %d", v, got.Padding)
+		}
+	}
+}
+
+func TestUpdateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "id3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test.mp3")
+
+	tag := NewTag(3)
+	tag.SetTitle("Short")
+	b, _ := tag.Encode(64)
+	audio := append(append([]byte{}, mp3.SilentBytes...), mp3.SilentBytes...)
+	if err := ioutil.WriteFile(name, append(b, audio...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// fits in the padding
+	tag.SetArtist("Artist")
+	if err := UpdateFile(name, tag); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	out, _ := ioutil.ReadFile(name)
+	if len(out) != len(b)+len(audio) {
+		t.Errorf("expected in place update, file size changed from %d to %d", len(b)+len(audio), len(out))
+	}
+
+	// needs a rewrite
+	tag.SetComment(Comment{"eng", "", strings.Repeat("x", 200)})
+	if err := UpdateFile(name, tag); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	out, _ = ioutil.ReadFile(name)
+	got, err := Read(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if got.Artist() != "Artist" || got.Padding != DefaultPadding {
+		t.Errorf("unexpected tag %+v", got)
+	}
+	if !bytes.Equal(out[got.Size:], audio) {
+		t.Errorf("audio frames changed by rewrite")
+	}
+}
+
+func TestEncodeEncryptedFrame(t *testing.T) {
+	// an encrypted, compressed ID3v2.3 frame, whose content is kept as is
+	frame := []byte{'T', 'I', 'T', '2', 0, 0, 0, 9, 0, 0xC0, 0, 0, 0, 100, 0x81, 1, 2, 3, 4}
+	src := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frame))}, frame...)
+	tag, err := Parse(src)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+
+	for _, v := range []byte{3, 4} {
+		tag.Version = v
+		b, err := tag.Encode(0)
+		if err != nil {
+			t.Fatalf("v2.%d: unexpected error, %v", v, err)
+		}
+		got, err := Parse(b)
+		if err != nil {
+			t.Fatalf("v2.%d: unexpected error, %v", v, err)
+		}
+		f := got.Frame("TIT2")
+		if f == nil || f.FormatFlags != FlagCompression|FlagEncryption || f.EncryptionMethod != 0x81 ||
+			f.DataLength != 100 || !bytes.Equal(f.Data, []byte{1, 2, 3, 4}) {
+			t.Errorf("v2.%d: unexpected frame %+v", v, f)
+		}
+	}
+}
+
+func TestEncodeUTF8AsV23(t *testing.T) {
+	tag := NewTag(4)
+	tag.SetArtist("Ærtist ☃")
+	tag.SetUserText("NOTE", "☃")
+	tag.SetComment(Comment{"eng", "☃", "comment ☃"})
+	tag.AddPicture(Picture{MIMEType: "image/png", Type: 3, Description: "☃", Data: []byte{1, 2, 3}})
+
+	tag.Version = 3
+	b, err := tag.Encode(0)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	got, err := Parse(b)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	for _, f := range got.Frames {
+		if f.Data[0] != EncodingUTF16 {
+			t.Errorf("frame %s: expected UTF-16, got encoding %d", f.ID, f.Data[0])
+		}
+	}
+	if got.Artist() != "Ærtist ☃" || got.UserText("NOTE") != "☃" {
+		t.Errorf("unexpected text %q %q", got.Artist(), got.UserText("NOTE"))
+	}
+	if cs := got.Comments(); len(cs) != 1 || cs[0] != (Comment{"eng", "☃", "comment ☃"}) {
+		t.Errorf("unexpected comments %+v", cs)
+	}
+	if ps := got.Pictures(); len(ps) != 1 || ps[0].Description != "☃" || ps[0].Type != 3 ||
+		ps[0].MIMEType != "image/png" || !bytes.Equal(ps[0].Data, []byte{1, 2, 3}) {
+		t.Errorf("unexpected pictures %+v", ps)
+	}
+}
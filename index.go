@@ -0,0 +1,289 @@
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+type (
+	// FrameIndex records the position of every frame in a stream, allowing
+	// sample exact seeks and byte range lookups without decoding.
+	FrameIndex struct {
+		// SampleRate is the sample rate of the first frame
+		SampleRate int
+		Entries    []IndexEntry
+	}
+
+	// IndexEntry describes a single frame of an indexed stream
+	IndexEntry struct {
+		// Offset is the byte offset of the frame in the stream
+		Offset int64
+		// Sample is the position of the first sample of the frame. Xing,
+		// Info and VBRI header frames carry no audio and do not advance the
+		// sample position.
+		Sample int64
+		// Size is the frame length in bytes
+		Size int
+		// Header holds the frame header bytes, see FrameHeader
+		Header [4]byte
+	}
+
+	// DriftError reports the first point at which an index and the stream it
+	// was validated against disagree
+	DriftError struct {
+		Entry  int
+		Offset int64
+		Reason string
+	}
+)
+
+const (
+	indexMagic   = "MP3X"
+	indexVersion = 1
+)
+
+// ErrBadIndex indicates that serialised index data is malformed
+var ErrBadIndex = errors.New("malformed frame index")
+
+func (e *DriftError) Error() string {
+	return fmt.Sprintf("index drift at entry %d (offset %d): %s", e.Entry, e.Offset, e.Reason)
+}
+
+// BuildIndex decodes every frame of r and records it in a FrameIndex
+func BuildIndex(r io.Reader, opts ...DecoderOption) (*FrameIndex, error) {
+	d := NewDecoder(r, opts...)
+	ix := &FrameIndex{}
+	var f Frame
+	var sample int64
+	skipped := 0
+	for {
+		err := d.Decode(&f, &skipped)
+		if err == io.EOF || err == ErrNoSyncBits || err == ErrPrematureEOF {
+			break
+		}
+		if err != nil && err != ErrCRCMismatch {
+			return ix, err
+		}
+		if ix.SampleRate == 0 {
+			ix.SampleRate = int(f.Header().SampleRate())
+		}
+
+		e := IndexEntry{
+			Offset: d.Pos() - int64(len(f.buf)),
+			Sample: sample,
+			Size:   len(f.buf),
+		}
+		copy(e.Header[:], f.buf[:4])
+		ix.Entries = append(ix.Entries, e)
+		if len(ix.Entries) > 1 || !f.IsStreamInfo() {
+			sample += int64(f.Samples())
+		}
+	}
+	return ix, nil
+}
+
+// Samples returns the total number of samples in the indexed stream
+func (ix *FrameIndex) Samples() int64 {
+	if len(ix.Entries) == 0 {
+		return 0
+	}
+	e := ix.Entries[len(ix.Entries)-1]
+	h := FrameHeader(e.Header[:])
+	return e.Sample + int64(samplesPerFrame[h.Version()][h.Layer()])
+}
+
+// Duration returns the playing time of the indexed stream
+func (ix *FrameIndex) Duration() time.Duration {
+	if ix.SampleRate == 0 {
+		return 0
+	}
+	return samplesDuration(ix.Samples(), ix.SampleRate)
+}
+
+// samplesDuration converts a count of samples at the given rate to a
+// duration, truncated to the nanosecond. Whole seconds are taken out first,
+// so long streams do not overflow.
+func samplesDuration(n int64, rate int) time.Duration {
+	sr := int64(rate)
+	return time.Duration(n/sr)*time.Second + time.Duration(n%sr*int64(time.Second)/sr)
+}
+
+// FindSample returns the index of the entry for the frame containing
+// sample s, or -1 if s is outside the stream
+func (ix *FrameIndex) FindSample(s int64) int {
+	if s < 0 || s >= ix.Samples() {
+		return -1
+	}
+	i := sort.Search(len(ix.Entries), func(i int) bool {
+		return ix.Entries[i].Sample > s
+	})
+	return i - 1
+}
+
+// FindTime returns the index of the entry for the frame playing at t, or -1
+// if t is outside the stream
+func (ix *FrameIndex) FindTime(t time.Duration) int {
+	sr := int64(ix.SampleRate)
+	return ix.FindSample(int64(t/time.Second)*sr + int64(t%time.Second)*sr/int64(time.Second))
+}
+
+// FindOffset returns the index of the entry for the frame containing byte
+// offset off, or -1 if no frame does
+func (ix *FrameIndex) FindOffset(off int64) int {
+	i := sort.Search(len(ix.Entries), func(i int) bool {
+		return ix.Entries[i].Offset > off
+	}) - 1
+	if i < 0 || off >= ix.Entries[i].Offset+int64(ix.Entries[i].Size) {
+		return -1
+	}
+	return i
+}
+
+// MarshalBinary encodes the index in a compact binary form. Offsets, sizes
+// and sample positions are delta encoded, and headers are only stored when
+// they change.
+func (ix *FrameIndex) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	var tmp [binary.MaxVarintLen64]byte
+	uv := func(v uint64) {
+		n := binary.PutUvarint(tmp[:], v)
+		buf.Write(tmp[:n])
+	}
+
+	buf.WriteString(indexMagic)
+	buf.WriteByte(indexVersion)
+	uv(uint64(ix.SampleRate))
+	uv(uint64(len(ix.Entries)))
+
+	var prev IndexEntry
+	for i, e := range ix.Entries {
+		end := prev.Offset + int64(prev.Size)
+		if e.Offset < end || e.Sample < prev.Sample || e.Size < 0 {
+			return nil, fmt.Errorf("index entry %d out of order", i)
+		}
+		changed := i == 0 || e.Header != prev.Header
+		flag := uint64(0)
+		if changed {
+			flag = 1
+		}
+		uv(uint64(e.Offset-end)<<1 | flag)
+		if changed {
+			buf.Write(e.Header[:])
+		}
+		uv(uint64(e.Size))
+		uv(uint64(e.Sample - prev.Sample))
+		prev = e
+	}
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(sum[:])
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes an index encoded by MarshalBinary
+func (ix *FrameIndex) UnmarshalBinary(b []byte) error {
+	if len(b) < len(indexMagic)+1+4 || string(b[:len(indexMagic)]) != indexMagic {
+		return ErrBadIndex
+	}
+	body, sum := b[:len(b)-4], b[len(b)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return ErrBadIndex
+	}
+	if body[len(indexMagic)] != indexVersion {
+		return fmt.Errorf("unsupported frame index version %d", body[len(indexMagic)])
+	}
+	r := bytes.NewReader(body[len(indexMagic)+1:])
+
+	sr, err := binary.ReadUvarint(r)
+	if err != nil {
+		return ErrBadIndex
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(len(b)) {
+		return ErrBadIndex
+	}
+
+	ix.SampleRate = int(sr)
+	ix.Entries = make([]IndexEntry, 0, n)
+	var prev IndexEntry
+	for i := uint64(0); i < n; i++ {
+		gap, err := binary.ReadUvarint(r)
+		if err != nil {
+			return ErrBadIndex
+		}
+		e := IndexEntry{Header: prev.Header}
+		e.Offset = prev.Offset + int64(prev.Size) + int64(gap>>1)
+		if gap&1 != 0 {
+			if _, err := io.ReadFull(r, e.Header[:]); err != nil {
+				return ErrBadIndex
+			}
+		}
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return ErrBadIndex
+		}
+		ds, err := binary.ReadUvarint(r)
+		if err != nil {
+			return ErrBadIndex
+		}
+		e.Size = int(size)
+		e.Sample = prev.Sample + int64(ds)
+		ix.Entries = append(ix.Entries, e)
+		prev = e
+	}
+	if r.Len() != 0 {
+		return ErrBadIndex
+	}
+	return nil
+}
+
+// WriteTo writes the binary form of the index to w
+func (ix *FrameIndex) WriteTo(w io.Writer) (int64, error) {
+	b, err := ix.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// ReadIndex reads an index written by FrameIndex.WriteTo
+func ReadIndex(r io.Reader) (*FrameIndex, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	ix := &FrameIndex{}
+	return ix, ix.UnmarshalBinary(b)
+}
+
+// Validate checks the index against the stream it describes, of length
+// size, by confirming that every indexed frame header is present at its
+// recorded offset. The first disagreement is returned as a *DriftError.
+func (ix *FrameIndex) Validate(r io.ReaderAt, size int64) error {
+	var hdr [4]byte
+	for i, e := range ix.Entries {
+		if e.Offset+int64(e.Size) > size {
+			return &DriftError{i, e.Offset, "frame extends beyond end of stream"}
+		}
+		if _, err := r.ReadAt(hdr[:], e.Offset); err != nil {
+			return err
+		}
+		if hdr != e.Header {
+			return &DriftError{i, e.Offset, fmt.Sprintf("expected header % x, found % x", e.Header, hdr)}
+		}
+		f := Frame{buf: hdr[:]}
+		if f.Header().BitRate() > 0 && f.Size() != e.Size {
+			return &DriftError{i, e.Offset, fmt.Sprintf("expected frame size %d, header gives %d", e.Size, f.Size())}
+		}
+	}
+	return nil
+}
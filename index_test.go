@@ -0,0 +1,79 @@
+package mp3
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFrameIndex(t *testing.T) {
+	tag := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	src := append(tag, bytes.Repeat(SilentBytes, 10)...)
+	src = append(src, silentFrameAt(9)...)
+
+	ix, err := BuildIndex(bytes.NewReader(src))
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if len(ix.Entries) != 11 || ix.Entries[0].Offset != int64(len(tag)) {
+		t.Fatalf("unexpected index %+v", ix.Entries)
+	}
+	if ix.Samples() != 11*1152 || ix.SampleRate != 44100 {
+		t.Errorf("unexpected samples %d at %d", ix.Samples(), ix.SampleRate)
+	}
+	if i := ix.FindSample(1152*3 + 5); i != 3 {
+		t.Errorf("expected sample in frame 3, got %d", i)
+	}
+	if i := ix.FindOffset(int64(len(tag) + len(SilentBytes)*10 + 1)); i != 10 {
+		t.Errorf("expected offset in frame 10, got %d", i)
+	}
+
+	b, err := ix.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	got, err := ReadIndex(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if got.SampleRate != ix.SampleRate || len(got.Entries) != len(ix.Entries) {
+		t.Fatalf("index changed by round trip")
+	}
+	for i := range got.Entries {
+		if got.Entries[i] != ix.Entries[i] {
+			t.Errorf("entry %d changed from %+v to %+v", i, ix.Entries[i], got.Entries[i])
+		}
+	}
+
+	if err := ix.Validate(bytes.NewReader(src), int64(len(src))); err != nil {
+		t.Errorf("unexpected error, %v", err)
+	}
+	moved := append(append([]byte{}, src[:600]...), append([]byte{0}, src[600:]...)...)
+	err = ix.Validate(bytes.NewReader(moved), int64(len(moved)))
+	if de, ok := err.(*DriftError); !ok || de.Entry != 1 {
+		t.Errorf("expected drift at entry 1, got %v", err)
+	}
+}
+
+func TestFrameIndexLong(t *testing.T) {
+	// a week of audio, long enough to overflow nanosecond sample arithmetic
+	week := 7 * 24 * time.Hour
+	n := int64(week/time.Second) * 44100 / 1152
+	var hdr [4]byte
+	copy(hdr[:], SilentBytes)
+	ix := &FrameIndex{SampleRate: 44100, Entries: []IndexEntry{
+		{Offset: 0, Sample: 0, Size: len(SilentBytes), Header: hdr},
+		{Offset: int64(len(SilentBytes)), Sample: 1152, Size: len(SilentBytes), Header: hdr},
+		{Offset: n * int64(len(SilentBytes)), Sample: n * 1152, Size: len(SilentBytes), Header: hdr},
+	}}
+
+	if d := ix.Duration(); d < week || d > week+time.Second {
+		t.Errorf("expected duration of about %v, got %v", week, d)
+	}
+	if i := ix.FindTime(week); i != 2 {
+		t.Errorf("expected time in entry 2, got %d", i)
+	}
+	if i := ix.FindTime(time.Second / 20); i != 1 {
+		t.Errorf("expected time in entry 1, got %d", i)
+	}
+}
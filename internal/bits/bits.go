@@ -0,0 +1,156 @@
+// Package bits provides simple MSB first bit level readers and writers, as
+// used throughout the MPEG audio bitstream.
+package bits
+
+import "errors"
+
+// ErrShortBuffer indicates that a read went beyond the available data
+var ErrShortBuffer = errors.New("bits: read beyond end of buffer")
+
+// Reader reads big endian bit fields from a byte slice
+type Reader struct {
+	buf []byte
+	pos int // position in bits
+	err error
+}
+
+// NewReader returns a Reader over b, starting at the first bit
+func NewReader(b []byte) *Reader {
+	return &Reader{buf: b}
+}
+
+// Reset points the reader at a new buffer, clearing any error
+func (r *Reader) Reset(b []byte) {
+	r.buf = b
+	r.pos = 0
+	r.err = nil
+}
+
+// Read returns the next n bits (n <= 32) as an unsigned value. Reads past the
+// end of the buffer return zero bits and set the reader error.
+func (r *Reader) Read(n int) uint32 {
+	var v uint32
+	for n > 0 {
+		byteIdx := r.pos >> 3
+		if byteIdx >= len(r.buf) {
+			r.err = ErrShortBuffer
+			v <<= uint(n)
+			r.pos += n
+			return v
+		}
+		bitIdx := uint(r.pos & 7)
+		avail := 8 - int(bitIdx)
+		take := avail
+		if n < take {
+			take = n
+		}
+		b := uint32(r.buf[byteIdx]) >> uint(avail-take) & (1<<uint(take) - 1)
+		v = v<<uint(take) | b
+		n -= take
+		r.pos += take
+	}
+	return v
+}
+
+// Bit reads a single bit
+func (r *Reader) Bit() bool {
+	return r.Read(1) == 1
+}
+
+// Skip advances the reader by n bits
+func (r *Reader) Skip(n int) {
+	r.pos += n
+	if r.pos > len(r.buf)*8 {
+		r.err = ErrShortBuffer
+	}
+}
+
+// Pos returns the current position in bits
+func (r *Reader) Pos() int {
+	return r.pos
+}
+
+// Seek moves the reader to bit position p
+func (r *Reader) Seek(p int) {
+	r.pos = p
+}
+
+// Len returns the number of unread bits
+func (r *Reader) Len() int {
+	l := len(r.buf)*8 - r.pos
+	if l < 0 {
+		return 0
+	}
+	return l
+}
+
+// Err returns the first error encountered by the reader
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Writer writes big endian bit fields into a growing byte slice
+type Writer struct {
+	buf []byte
+	pos int // position in bits
+}
+
+// NewWriter returns a writer appending to b
+func NewWriter(b []byte) *Writer {
+	return &Writer{buf: b[:0]}
+}
+
+// Write appends the low n bits (n <= 32) of v
+func (w *Writer) Write(v uint32, n int) {
+	for n > 0 {
+		if w.pos&7 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		bitIdx := uint(w.pos & 7)
+		avail := 8 - int(bitIdx)
+		take := avail
+		if n < take {
+			take = n
+		}
+		b := byte(v>>uint(n-take)) & (1<<uint(take) - 1)
+		w.buf[len(w.buf)-1] |= b << uint(avail-take)
+		n -= take
+		w.pos += take
+	}
+}
+
+// Bit writes a single bit
+func (w *Writer) Bit(b bool) {
+	if b {
+		w.Write(1, 1)
+		return
+	}
+	w.Write(0, 1)
+}
+
+// Len returns the number of bits written
+func (w *Writer) Len() int {
+	return w.pos
+}
+
+// Bytes returns the written data, the final byte is zero padded
+func (w *Writer) Bytes() []byte {
+	return w.buf
+}
+
+// Put overwrites n bits at bit position p within an existing buffer b
+func Put(b []byte, p int, v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		bit := byte(v>>uint(i)) & 1
+		byteIdx := p >> 3
+		shift := uint(7 - p&7)
+		b[byteIdx] = b[byteIdx]&^(1<<shift) | bit<<shift
+		p++
+	}
+}
+
+// Get reads n bits at bit position p from b
+func Get(b []byte, p int, n int) uint32 {
+	r := Reader{buf: b, pos: p}
+	return r.Read(n)
+}
@@ -0,0 +1,97 @@
+// Package filterbank implements the polyphase analysis and synthesis
+// filterbanks shared by all MPEG audio layers, as given in ISO/IEC 11172-3.
+package filterbank
+
+import "math"
+
+var (
+	// synthMatrix holds the synthesis matrixing coefficients N[i][k]
+	synthMatrix [64][32]float32
+	// analysisMatrix holds the analysis matrixing coefficients M[k][i]
+	analysisMatrix [32][64]float32
+)
+
+func init() {
+	for i := 0; i < 64; i++ {
+		for k := 0; k < 32; k++ {
+			synthMatrix[i][k] = float32(math.Cos(float64((16+i)*(2*k+1)) * math.Pi / 64))
+			analysisMatrix[k][i] = float32(math.Cos(float64((2*k+1)*(i-16)) * math.Pi / 64))
+		}
+	}
+}
+
+// Synthesis is the synthesis filterbank, turning 32 subband samples into 32
+// PCM samples at a time. The zero value is ready for use.
+type Synthesis struct {
+	v   [1024]float32
+	off int
+}
+
+// Filter runs one time slot of subband samples through the filterbank,
+// writing 32 samples to out
+func (s *Synthesis) Filter(in *[32]float32, out []float32) {
+	s.off = (s.off - 64) & 1023
+	v := s.v[s.off : s.off+64]
+	for i := range v {
+		var sum float32
+		m := &synthMatrix[i]
+		for k, x := range in {
+			sum += m[k] * x
+		}
+		v[i] = sum
+	}
+
+	for j := 0; j < 32; j++ {
+		var sum float32
+		for i := 0; i < 8; i++ {
+			sum += s.v[(s.off+128*i+j)&1023] * Window[64*i+j]
+			sum += s.v[(s.off+128*i+96+j)&1023] * Window[64*i+32+j]
+		}
+		out[j] = sum
+	}
+}
+
+// Reset clears the filter history
+func (s *Synthesis) Reset() {
+	*s = Synthesis{}
+}
+
+// Analysis is the analysis filterbank, turning 32 PCM samples into one time
+// slot of 32 subband samples. The output of an Analysis passed through a
+// Synthesis reproduces the input delayed by 481 samples. The zero value is
+// ready for use.
+type Analysis struct {
+	x   [512]float32
+	off int
+}
+
+// Filter adds 32 PCM samples, in time order, to the filterbank and writes
+// the next time slot of subband samples to out
+func (a *Analysis) Filter(in []float32, out *[32]float32) {
+	a.off = (a.off - 32) & 511
+	for i := 0; i < 32; i++ {
+		a.x[(a.off+31-i)&511] = in[i]
+	}
+
+	var y [64]float32
+	for i := 0; i < 64; i++ {
+		var sum float32
+		for j := 0; j < 8; j++ {
+			sum += Window[i+64*j] * a.x[(a.off+i+64*j)&511]
+		}
+		y[i] = sum / 32
+	}
+	for k := 0; k < 32; k++ {
+		var sum float32
+		m := &analysisMatrix[k]
+		for i, v := range y {
+			sum += m[i] * v
+		}
+		out[k] = sum
+	}
+}
+
+// Reset clears the filter history
+func (a *Analysis) Reset() {
+	*a = Analysis{}
+}
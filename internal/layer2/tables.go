@@ -0,0 +1,108 @@
+// Package layer2 holds the bit allocation and quantisation tables used by
+// MPEG audio Layer II, as given in ISO/IEC 11172-3 Annex B and ISO/IEC
+// 13818-3 Annex B.
+package layer2
+
+// QuantClass describes one of the Layer II quantisation classes
+type QuantClass struct {
+	// Levels is the number of quantisation steps
+	Levels int
+	// Grouped indicates that three consecutive samples share one codeword
+	Grouped bool
+	// Bits is the codeword length, for grouped classes this covers all
+	// three samples
+	Bits int
+}
+
+// AllocTable is one of the Layer II bit allocation tables
+type AllocTable struct {
+	// SBLimit is the number of subbands that can carry an allocation
+	SBLimit int
+	// NBal is the width of the allocation field for each subband
+	NBal [32]int
+	// Class maps a non zero allocation value a, for subband sb, to the index
+	// of its quantisation class in QuantClasses via Class[sb][a-1]
+	Class [32][]int
+}
+
+// QuantClasses lists all quantisation classes in increasing precision
+var QuantClasses = [17]QuantClass{
+	{3, true, 5},
+	{5, true, 7},
+	{7, false, 3},
+	{9, true, 10},
+	{15, false, 4},
+	{31, false, 5},
+	{63, false, 6},
+	{127, false, 7},
+	{255, false, 8},
+	{511, false, 9},
+	{1023, false, 10},
+	{2047, false, 11},
+	{4095, false, 12},
+	{8191, false, 13},
+	{16383, false, 14},
+	{32767, false, 15},
+	{65535, false, 16},
+}
+
+var (
+	classA0 = []int{0, 2, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	classA1 = []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 16}
+	classA2 = []int{0, 1, 2, 3, 4, 5, 16}
+	classA3 = []int{0, 1, 16}
+	classC0 = []int{0, 1, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	classC1 = []int{0, 1, 3, 4, 5, 6, 7}
+	classL0 = []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14}
+	classL2 = []int{0, 1, 3}
+
+	// TableA is ISO/IEC 11172-3 Table B.2a
+	TableA = build(27, []span{{3, 4, classA0}, {8, 4, classA1}, {12, 3, classA2}, {4, 2, classA3}})
+	// TableB is ISO/IEC 11172-3 Table B.2b
+	TableB = build(30, []span{{3, 4, classA0}, {8, 4, classA1}, {12, 3, classA2}, {7, 2, classA3}})
+	// TableC is ISO/IEC 11172-3 Table B.2c
+	TableC = build(8, []span{{2, 4, classC0}, {6, 3, classC1}})
+	// TableD is ISO/IEC 11172-3 Table B.2d
+	TableD = build(12, []span{{2, 4, classC0}, {10, 3, classC1}})
+	// TableLSF is ISO/IEC 13818-3 Table B.1, used for all MPEG-2 and
+	// MPEG-2.5 Layer II streams
+	TableLSF = build(30, []span{{4, 4, classL0}, {7, 3, classC1}, {19, 2, classL2}})
+)
+
+type span struct {
+	count   int
+	nbal    int
+	classes []int
+}
+
+func build(sblimit int, spans []span) *AllocTable {
+	t := &AllocTable{SBLimit: sblimit}
+	sb := 0
+	for _, s := range spans {
+		for i := 0; i < s.count; i++ {
+			t.NBal[sb] = s.nbal
+			t.Class[sb] = s.classes
+			sb++
+		}
+	}
+	return t
+}
+
+// Select returns the allocation table for a stream. lsf is set for MPEG-2
+// and MPEG-2.5 streams, bitrate is the per channel bitrate in kbit/s.
+func Select(lsf bool, bitrate, sampleRate int) *AllocTable {
+	switch {
+	case lsf:
+		return TableLSF
+	case bitrate <= 48 && sampleRate == 32000:
+		return TableD
+	case bitrate <= 48:
+		return TableC
+	case bitrate <= 80:
+		return TableA
+	case sampleRate == 48000:
+		return TableA
+	default:
+		return TableB
+	}
+}
@@ -0,0 +1,47 @@
+package layer3
+
+// HuffTable is one of the Layer III Huffman code tables
+type HuffTable struct {
+	// Codes and Lens give the code and code length of each value, Codes
+	// is nil for tables that code only zeros
+	Codes []uint16
+	Lens  []uint8
+	// Dim is the number of values along each dimension, 2 for the count1
+	// tables, whose four values are each 0 or 1
+	Dim int
+	// Linbits is the number of extra bits following a value of 15
+	Linbits int
+}
+
+var (
+	// BigValueTables are the 32 tables available for the big values region
+	BigValueTables [32]HuffTable
+	// Count1Tables are the two quadruple tables for the count1 region
+	Count1Tables [2]HuffTable
+)
+
+func init() {
+	// Tables 0, 4 and 14 have no codes, and decode as zeros
+	BigValueTables[1] = HuffTable{Codes: codes1, Lens: lens1, Dim: 2}
+	BigValueTables[2] = HuffTable{Codes: codes2, Lens: lens2, Dim: 3}
+	BigValueTables[3] = HuffTable{Codes: codes3, Lens: lens3, Dim: 3}
+	BigValueTables[5] = HuffTable{Codes: codes5, Lens: lens5, Dim: 4}
+	BigValueTables[6] = HuffTable{Codes: codes6, Lens: lens6, Dim: 4}
+	BigValueTables[7] = HuffTable{Codes: codes7, Lens: lens7, Dim: 6}
+	BigValueTables[8] = HuffTable{Codes: codes8, Lens: lens8, Dim: 6}
+	BigValueTables[9] = HuffTable{Codes: codes9, Lens: lens9, Dim: 6}
+	BigValueTables[10] = HuffTable{Codes: codes10, Lens: lens10, Dim: 8}
+	BigValueTables[11] = HuffTable{Codes: codes11, Lens: lens11, Dim: 8}
+	BigValueTables[12] = HuffTable{Codes: codes12, Lens: lens12, Dim: 8}
+	BigValueTables[13] = HuffTable{Codes: codes13, Lens: lens13, Dim: 16}
+	BigValueTables[15] = HuffTable{Codes: codes15, Lens: lens15, Dim: 16}
+	for i, lb := range []int{1, 2, 3, 4, 6, 8, 10, 13} {
+		BigValueTables[16+i] = HuffTable{Codes: codes16, Lens: lens16, Dim: 16, Linbits: lb}
+	}
+	for i, lb := range []int{4, 5, 6, 7, 8, 9, 11, 13} {
+		BigValueTables[24+i] = HuffTable{Codes: codes24, Lens: lens24, Dim: 16, Linbits: lb}
+	}
+
+	Count1Tables[0] = HuffTable{Codes: codes32, Lens: lens32, Dim: 2}
+	Count1Tables[1] = HuffTable{Codes: codes33, Lens: lens33, Dim: 2}
+}
@@ -0,0 +1,135 @@
+// Package layer3 holds the tables used by MPEG audio Layer III, as given in
+// ISO/IEC 11172-3 and ISO/IEC 13818-3, shared by the decoder and encoder.
+package layer3
+
+import "math"
+
+// Bands holds the scalefactor band boundaries for one sample rate
+type Bands struct {
+	Long  [23]int
+	Short [14]int
+}
+
+var (
+	// SFBands holds the scalefactor band boundaries, in the order of the
+	// sample rate index within each version: 44.1, 48, 32, 22.05, 24, 16,
+	// 11.025, 12 and 8kHz. Use BandIndex to select one.
+	SFBands = [9]Bands{
+		{
+			Long:  [23]int{0, 4, 8, 12, 16, 20, 24, 30, 36, 44, 52, 62, 74, 90, 110, 134, 162, 196, 238, 288, 342, 418, 576},
+			Short: [14]int{0, 4, 8, 12, 16, 22, 30, 40, 52, 66, 84, 106, 136, 192},
+		},
+		{
+			Long:  [23]int{0, 4, 8, 12, 16, 20, 24, 30, 36, 42, 50, 60, 72, 88, 106, 128, 156, 190, 230, 276, 330, 384, 576},
+			Short: [14]int{0, 4, 8, 12, 16, 22, 28, 38, 50, 64, 80, 100, 126, 192},
+		},
+		{
+			Long:  [23]int{0, 4, 8, 12, 16, 20, 24, 30, 36, 44, 54, 66, 82, 102, 126, 156, 194, 240, 296, 364, 448, 550, 576},
+			Short: [14]int{0, 4, 8, 12, 16, 22, 30, 42, 58, 78, 104, 138, 180, 192},
+		},
+		{
+			Long:  [23]int{0, 6, 12, 18, 24, 30, 36, 44, 54, 66, 80, 96, 116, 140, 168, 200, 238, 284, 336, 396, 464, 522, 576},
+			Short: [14]int{0, 4, 8, 12, 18, 24, 32, 42, 56, 74, 100, 132, 174, 192},
+		},
+		{
+			Long:  [23]int{0, 6, 12, 18, 24, 30, 36, 44, 54, 66, 80, 96, 114, 136, 162, 194, 232, 278, 332, 394, 464, 540, 576},
+			Short: [14]int{0, 4, 8, 12, 18, 26, 36, 48, 62, 80, 104, 136, 180, 192},
+		},
+		{
+			Long:  [23]int{0, 6, 12, 18, 24, 30, 36, 44, 54, 66, 80, 96, 116, 140, 168, 200, 238, 284, 336, 396, 464, 522, 576},
+			Short: [14]int{0, 4, 8, 12, 18, 26, 36, 48, 62, 80, 104, 134, 174, 192},
+		},
+		{
+			Long:  [23]int{0, 6, 12, 18, 24, 30, 36, 44, 54, 66, 80, 96, 116, 140, 168, 200, 238, 284, 336, 396, 464, 522, 576},
+			Short: [14]int{0, 4, 8, 12, 18, 26, 36, 48, 62, 80, 104, 134, 174, 192},
+		},
+		{
+			Long:  [23]int{0, 6, 12, 18, 24, 30, 36, 44, 54, 66, 80, 96, 116, 140, 168, 200, 238, 284, 336, 396, 464, 522, 576},
+			Short: [14]int{0, 4, 8, 12, 18, 26, 36, 48, 62, 80, 104, 134, 174, 192},
+		},
+		{
+			Long:  [23]int{0, 12, 24, 36, 48, 60, 72, 88, 108, 132, 160, 192, 232, 280, 336, 400, 476, 566, 568, 570, 572, 574, 576},
+			Short: [14]int{0, 8, 16, 24, 36, 52, 72, 96, 124, 160, 162, 164, 166, 192},
+		},
+	}
+
+	// Slen gives the MPEG-1 scalefactor lengths for each scalefac_compress
+	Slen = [2][16]int{
+		{0, 0, 0, 0, 3, 1, 1, 1, 2, 2, 2, 3, 3, 3, 4, 4},
+		{0, 1, 2, 3, 0, 1, 2, 3, 1, 2, 3, 1, 2, 3, 2, 3},
+	}
+
+	// Pretab is added to the long block scalefactors when preflag is set
+	Pretab = [22]int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 3, 3, 3, 2, 0}
+
+	// NrOfSfb gives the number of scalefactors in each of the four
+	// partitions of an MPEG-2 granule, for each of the six slen layouts and
+	// for long, short and mixed blocks
+	NrOfSfb = [6][3][4]int{
+		{{6, 5, 5, 5}, {9, 9, 9, 9}, {6, 9, 9, 9}},
+		{{6, 5, 7, 3}, {9, 9, 12, 6}, {6, 9, 12, 6}},
+		{{11, 10, 0, 0}, {18, 18, 0, 0}, {15, 18, 0, 0}},
+		{{7, 7, 7, 0}, {12, 12, 12, 0}, {6, 15, 12, 0}},
+		{{6, 6, 6, 3}, {12, 9, 9, 6}, {6, 12, 9, 6}},
+		{{8, 8, 5, 0}, {15, 12, 9, 0}, {6, 18, 9, 0}},
+	}
+
+	// AliasCs and AliasCa hold the alias reduction butterfly coefficients
+	AliasCs, AliasCa [8]float32
+
+	// Windows holds the IMDCT window for each block type. The short block
+	// window occupies the first 12 entries of Windows[2].
+	Windows [4][36]float32
+)
+
+// BandIndex gives the index into SFBands for a sample rate index, as found
+// in the frame header, and whether the stream is MPEG-2 or MPEG-2.5
+func BandIndex(rateIndex int, mpeg2, mpeg25 bool) int {
+	switch {
+	case mpeg25:
+		return rateIndex + 6
+	case mpeg2:
+		return rateIndex + 3
+	}
+	return rateIndex
+}
+
+// MixedBounds gives the number of long bands, and the first short band, of
+// a mixed block
+func (b *Bands) MixedBounds() (longBands, shortStart int) {
+	for longBands < 22 && b.Long[longBands+1] <= 36 {
+		longBands++
+	}
+	for shortStart < 13 && b.Short[shortStart]*3 < 36 {
+		shortStart++
+	}
+	return longBands, shortStart
+}
+
+func init() {
+	c := [8]float64{-0.6, -0.535, -0.33, -0.185, -0.095, -0.041, -0.0142, -0.0037}
+	for i, v := range c {
+		sq := math.Sqrt(1 + v*v)
+		AliasCs[i] = float32(1 / sq)
+		AliasCa[i] = float32(v / sq)
+	}
+
+	for i := 0; i < 36; i++ {
+		Windows[0][i] = float32(math.Sin(math.Pi / 36 * (float64(i) + 0.5)))
+	}
+	for i := 0; i < 18; i++ {
+		Windows[1][i] = Windows[0][i]
+		Windows[3][i+18] = Windows[0][i+18]
+	}
+	for i := 18; i < 24; i++ {
+		Windows[1][i] = 1
+		Windows[3][i-6] = 1
+	}
+	for i := 24; i < 30; i++ {
+		Windows[1][i] = float32(math.Sin(math.Pi / 12 * (float64(i-18) + 0.5)))
+		Windows[3][i-18] = float32(math.Sin(math.Pi / 12 * (float64(i-24) + 0.5)))
+	}
+	for i := 0; i < 12; i++ {
+		Windows[2][i] = float32(math.Sin(math.Pi / 12 * (float64(i) + 0.5)))
+	}
+}
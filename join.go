@@ -0,0 +1,232 @@
+package mp3
+
+import (
+	"errors"
+	"io"
+)
+
+type (
+	// JoinOption configures optional Join behaviour
+	JoinOption func(*joiner)
+
+	// joiner appends streams to a single Writer
+	joiner struct {
+		w     *Writer
+		mixed bool
+		first FrameHeader // header of the first audio frame
+	}
+)
+
+var (
+	// ErrJoinFormat indicates that the streams to join differ in MPEG
+	// version, layer, sample rate, or in being mono or stereo
+	ErrJoinFormat = errors.New("streams to join differ in format")
+
+	// ErrJoinReservoir indicates that no frame of a stream to join could be
+	// decoded, as the main data of each begins before the start of the
+	// stream
+	ErrJoinReservoir = errors.New("stream to join has no frame with complete main data")
+)
+
+// maxPadding is the most padding, in samples, a decoder can be told to drop
+// by a LAME tag
+const maxPadding = 0x0FFF - DecoderDelay
+
+// WithMixedFormats allows Join to append streams whose format differs from
+// that of the first stream. Few players cope with changes of sample rate or
+// channel count within a stream.
+func WithMixedFormats() JoinOption {
+	return func(j *joiner) {
+		j.mixed = true
+	}
+}
+
+// Join writes the streams read from rs, one after the other, to w, without
+// decoding or re-encoding their audio. ID3 and APE tags, and the Xing,
+// Info, VBRI and LAME header frames of the streams are dropped, and a
+// single header for the joined stream is written, as by Writer. If the
+// first stream has a LAME tag, that of the joined stream takes the encoder
+// delay of the first stream and the padding of the last, and the frames at
+// the end of the other streams that hold only padding are dropped.
+//
+// The join is not gapless. A LAME tag can only tell a decoder to drop
+// samples at the start and end of the whole stream, so at each join the
+// encoder delay of the stream after it, and the padding of the stream
+// before it that does not fill a whole frame, are still played, as a short
+// gap or glitch. Removing them would need the audio to be re-encoded.
+//
+// Streams that have been cut may begin with frames whose main data lies in
+// the bit reservoir of frames that are missing. These cannot be decoded, and
+// left in place would take their main data from the end of the stream
+// before, so they are dropped. Where the frames kept take main data from
+// them, a silent frame carrying just that data is inserted at the join. ErrJoinReservoir is returned if none of the frames of a stream can
+// be decoded.
+func Join(w io.WriteSeeker, rs []io.Reader, opts ...JoinOption) error {
+	j := &joiner{w: NewWriter(w)}
+	for _, o := range opts {
+		o(j)
+	}
+	for i, r := range rs {
+		if err := j.add(r, i == 0, i == len(rs)-1); err != nil {
+			j.w.Close()
+			return err
+		}
+	}
+	return j.w.Close()
+}
+
+// compatible reports whether frames with header h can follow those of the
+// first stream
+func (j *joiner) compatible(h FrameHeader) bool {
+	return j.mixed ||
+		h.Version() == j.first.Version() &&
+			h.Layer() == j.first.Layer() &&
+			h.SampleRate() == j.first.SampleRate() &&
+			(h.ChannelMode() == SingleChannel) == (j.first.ChannelMode() == SingleChannel)
+}
+
+// add appends the stream read from r
+func (j *joiner) add(r io.Reader, first, last bool) error {
+	d := NewDecoder(r)
+	var f Frame
+	var tag *LAMETag
+	var res Reservoir
+	var pos int64
+	var queue []cutFrame // frames that may hold only padding
+	var lead []byte      // main data from before the first frame kept
+	var kept []*Frame    // frames kept while lead may still be needed
+	avail := 0           // main data carried by the frames in kept
+	started := first
+	skipped := 0
+	for {
+		err := d.Decode(&f, &skipped)
+		if err == io.EOF || err == ErrNoSyncBits || err == ErrPrematureEOF {
+			break
+		}
+		if err != nil && err != ErrCRCMismatch {
+			return err
+		}
+		if f.IsStreamInfo() {
+			if pos == 0 && tag == nil {
+				tag, _ = f.LAME()
+			}
+			continue
+		}
+
+		h := f.Header()
+		if j.first == nil {
+			j.first = append(FrameHeader(nil), h...)
+		} else if !j.compatible(h) {
+			return ErrJoinFormat
+		}
+		cf := cutFrame{
+			f:      f.clone(),
+			pos:    pos,
+			before: append([]byte(nil), res.buf...),
+		}
+		pos += int64(f.Samples())
+		need := 0
+		if h.Layer() == Layer3 {
+			if si, err := cf.f.ParseSideInfo(); err == nil {
+				need = si.MainDataBegin
+			}
+			res.Add(cf.f)
+		}
+
+		if !started {
+			if need > len(cf.before) {
+				continue
+			}
+			started = true
+			lead = cf.before
+		}
+
+		// the frames that follow may reach further back than the first,
+		// until they carry as much main data as can be referred back to
+		queue = append(queue, cf)
+		if len(lead) > 0 {
+			kept = append(kept, cf.f)
+			avail += len(cf.f.MainData())
+			if avail >= maxMainDataBegin {
+				if err := j.lead(lead, kept); err != nil {
+					return err
+				}
+				lead = nil
+			}
+		}
+		for len(lead) == 0 && len(queue) > 1 && queueSamples(queue[1:]) >= maxPadding {
+			if err := j.w.WriteFrame(queue[0].f); err != nil {
+				return err
+			}
+			queue = queue[1:]
+		}
+	}
+	if pos == 0 {
+		return ErrNoFrames
+	}
+	if !started {
+		return ErrJoinReservoir
+	}
+
+	if len(lead) > 0 {
+		if err := j.lead(lead, kept); err != nil {
+			return err
+		}
+	}
+
+	end := pos
+	if !last && tag != nil {
+		_, tail := tag.Trim()
+		end -= int64(tail)
+	}
+	for _, cf := range queue {
+		if cf.pos >= end {
+			break
+		}
+		if err := j.w.WriteFrame(cf.f); err != nil {
+			return err
+		}
+	}
+
+	if first && tag != nil {
+		l := *tag
+		l.Peak = 0
+		l.RadioGain = ReplayGain{}
+		l.AudiophileGain = ReplayGain{}
+		j.w.lame = &l
+	}
+	if last && j.w.lame != nil {
+		j.w.lame.Padding = DecoderDelay
+		if tag != nil {
+			j.w.lame.Padding = tag.Padding
+		}
+	}
+	return nil
+}
+
+// lead writes a silent frame carrying the end of before, the main data from
+// before the first of the frames fs kept from a stream, as much as they
+// refer back to
+func (j *joiner) lead(before []byte, fs []*Frame) error {
+	need := reservoirNeed(fs)
+	if need > len(before) {
+		need = len(before)
+	}
+	if need == 0 {
+		return nil
+	}
+	rf, err := reservoirFrame(fs[0].Header(), before[len(before)-need:])
+	if err != nil {
+		return err
+	}
+	return j.w.WriteFrame(rf)
+}
+
+// queueSamples gives the samples held by the frames of q
+func queueSamples(q []cutFrame) int64 {
+	var n int64
+	for _, cf := range q {
+		n += int64(cf.f.Samples())
+	}
+	return n
+}
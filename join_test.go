@@ -0,0 +1,115 @@
+package mp3
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/tcolgate/mp3/internal/bits"
+)
+
+// taggedStream writes the frames as a stream with a LAME tag
+func taggedStream(fs []*Frame, delay, padding int) io.Reader {
+	var sb seekBuffer
+	w := NewWriter(&sb, WithLAMETag(LAMETag{EncoderDelay: delay, Padding: padding}))
+	for _, f := range fs {
+		w.WriteFrame(f)
+	}
+	w.Close()
+	return bytes.NewReader(sb.buf)
+}
+
+func TestJoin(t *testing.T) {
+	// the padding of the first stream fills its last frame
+	a := taggedStream(markedFrames(t, 20), 576, 2000)
+
+	// the second stream was cut, its first frame takes main data from
+	// frames that are missing, and its second from the first
+	fs := markedFrames(t, 20)
+	bits.Put(fs[0].buf, 4*8, 200, 9)
+	bits.Put(fs[1].buf, 4*8, 100, 9)
+	b := taggedStream(fs, 1000, 700)
+
+	var sb seekBuffer
+	if err := Join(&sb, []io.Reader{a, b}); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	l, marks := readCut(t, sb.buf)
+	var want []int
+	for i := 0; i < 19; i++ {
+		want = append(want, i)
+	}
+	want = append(want, 0) // the frame carrying main data for frame 1
+	for i := 1; i < 20; i++ {
+		want = append(want, i)
+	}
+	if !equalInts(marks, want) {
+		t.Errorf("expected frames %v, got %v", want, marks)
+	}
+	if l.EncoderDelay != 576 || l.Padding != 700 {
+		t.Errorf("unexpected delay %d and padding %d", l.EncoderDelay, l.Padding)
+	}
+
+	// a stream with no decodable frame
+	fs = markedFrames(t, 10)[:1]
+	bits.Put(fs[0].buf, 4*8, 200, 9)
+	err := Join(&seekBuffer{}, []io.Reader{taggedStream(markedFrames(t, 10), 0, 0), taggedStream(fs, 0, 0)})
+	if err != ErrJoinReservoir {
+		t.Errorf("expected ErrJoinReservoir, got %v", err)
+	}
+}
+
+func TestJoinReservoirDepth(t *testing.T) {
+	// the first frame of the second stream is dropped, and the third
+	// reaches further back into it than the second, the first kept
+	fs := markedFrames(t, 20)
+	bits.Put(fs[0].buf, 4*8, 200, 9)
+	bits.Put(fs[1].buf, 4*8, 100, 9)
+	bits.Put(fs[2].buf, 4*8, 500, 9)
+	md := fs[0].MainData()
+	for i := range md[:len(md)-1] {
+		md[i] = byte(i)
+	}
+	var res Reservoir
+	res.Add(fs[0])
+	res.Add(fs[1])
+	want, _ := res.Add(fs[2])
+
+	var sb seekBuffer
+	rs := []io.Reader{taggedStream(markedFrames(t, 20), 576, 0), taggedStream(fs, 576, 0)}
+	if err := Join(&sb, rs); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if got := mainData(t, sb.buf); !bytes.Equal(got[2], want) {
+		t.Errorf("main data of frame 2 not kept")
+	}
+}
+
+func TestJoinFormats(t *testing.T) {
+	g, err := NewSilenceGenerator(FrameHeader{0xFF, 0xFB, 0x90, 0xC0})
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	mono, _ := g.Samples(10 * 1152)
+	var buf bytes.Buffer
+	for _, f := range mono {
+		buf.Write(f.Bytes())
+	}
+
+	stereo := taggedStream(markedFrames(t, 10), 576, 1000)
+	err = Join(&seekBuffer{}, []io.Reader{stereo, bytes.NewReader(buf.Bytes())})
+	if err != ErrJoinFormat {
+		t.Errorf("expected ErrJoinFormat, got %v", err)
+	}
+
+	stereo = taggedStream(markedFrames(t, 10), 576, 1000)
+	var sb seekBuffer
+	err = Join(&sb, []io.Reader{stereo, bytes.NewReader(buf.Bytes())}, WithMixedFormats())
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	l, marks := readCut(t, sb.buf)
+	if len(marks) != 20 || l.Padding != DecoderDelay {
+		t.Errorf("expected 20 frames and no padding, got %d and %d", len(marks), l.Padding)
+	}
+}
@@ -0,0 +1,295 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type (
+	// LAMETag is the LAME extension written after the Xing header by LAME and
+	// compatible encoders
+	LAMETag struct {
+		// Encoder is the encoder version string, e.g. "LAME3.99r"
+		Encoder string
+		// Revision is the tag revision
+		Revision int
+		// VBRMethod is the bitrate mode, see the LAMEVBR constants
+		VBRMethod int
+		// Lowpass is the lowpass filter frequency in Hz
+		Lowpass int
+		// Peak is the peak signal amplitude, 1.0 being full scale
+		Peak float64
+		// RadioGain and AudiophileGain are the track and album ReplayGain
+		// adjustments
+		RadioGain      ReplayGain
+		AudiophileGain ReplayGain
+		// EncodingFlags holds the nspsytune, nssafejoint, nogap next and
+		// nogap previous flags
+		EncodingFlags int
+		// ATHType is the absolute threshold of hearing type
+		ATHType int
+		// Bitrate is the ABR target bitrate, the minimal VBR bitrate or the
+		// CBR bitrate, in kbit/s. 255 means 255 or more.
+		Bitrate int
+		// EncoderDelay is the number of priming samples the encoder added at
+		// the start of the stream, and Padding the number added at the end.
+		// For gapless playback a decoder drops EncoderDelay + 529 samples
+		// from the start of its output and Padding - 529 from the end.
+		EncoderDelay int
+		Padding      int
+		// NoiseShaping is the noise shaping type
+		NoiseShaping int
+		// StereoMode is the stereo mode used by the encoder, see the
+		// LAMEStereo constants
+		StereoMode int
+		// Unwise is set if unwise settings were used
+		Unwise bool
+		// SourceRate is the sample rate of the source, 0 for 32 kHz or lower,
+		// 1 for 44.1 kHz, 2 for 48 kHz and 3 for higher rates
+		SourceRate int
+		// MP3Gain is the global gain change applied by MP3Gain, in 1.5 dB
+		// steps
+		MP3Gain int
+		// Surround is the surround encoding information
+		Surround int
+		// Preset is the encoder preset used
+		Preset int
+		// MusicLength is the length of the stream in bytes, from the start of
+		// the tag frame to the end of the last audio frame
+		MusicLength int
+		// MusicCRC is the CRC-16 of the audio data
+		MusicCRC uint16
+		// TagCRC is the stored CRC-16 of the tag frame up to the CRC itself,
+		// TagCRCValid reports whether it matched
+		TagCRC      uint16
+		TagCRCValid bool
+	}
+
+	// ReplayGain is a ReplayGain field of the LAME tag
+	ReplayGain struct {
+		// Name is 0 when not set, 1 for radio (track) and 2 for audiophile
+		// (album) gain
+		Name int
+		// Originator records who set the gain, 1 for the artist, 2 for the
+		// user, 3 for automatic models
+		Originator int
+		// Gain is the adjustment in dB
+		Gain float64
+	}
+)
+
+// LAME tag VBR methods
+const (
+	LAMEVBRUnknown = iota
+	LAMECBR
+	LAMEABR
+	LAMEVBR1 // vbr-old / vbr-rh
+	LAMEVBR2 // vbr-mtrh
+	LAMEVBR3 // vbr-mt
+	LAMEVBR4
+	LAMECBR2Pass = 8
+	LAMEABR2Pass = 9
+)
+
+// LAME tag stereo modes
+const (
+	LAMEMono = iota
+	LAMEStereo
+	LAMEDual
+	LAMEJoint
+	LAMEForce
+	LAMEAuto
+	LAMEIntensity
+	LAMEUndefined
+)
+
+const (
+	lameTagLen = 36
+
+	// DecoderDelay is the delay, in samples, that decoders add ahead of the
+	// encoder delay recorded in a LAME tag
+	DecoderDelay = 529
+)
+
+// ErrNoLAME indicates that the frame does not hold a LAME extension tag
+var ErrNoLAME = errors.New("no LAME tag")
+
+// LAME parses the LAME extension tag that follows the Xing or Info header
+// held in the frame. ErrNoLAME is returned if there is none.
+func (f *Frame) LAME() (*LAMETag, error) {
+	x, err := f.Xing()
+	if err != nil {
+		return nil, err
+	}
+	off := x.end()
+	if off+lameTagLen > len(f.buf) {
+		return nil, ErrNoLAME
+	}
+	b := f.buf[off : off+lameTagLen]
+	for _, c := range b[:4] {
+		if c < 'A' || c > 'z' {
+			return nil, ErrNoLAME
+		}
+	}
+
+	l := &LAMETag{
+		Encoder:        strings.TrimRight(string(b[0:9]), "\x00 "),
+		Revision:       int(b[9] >> 4),
+		VBRMethod:      int(b[9] & 0x0F),
+		Lowpass:        int(b[10]) * 100,
+		Peak:           float64(binary.BigEndian.Uint32(b[11:15])) / (1 << 23),
+		RadioGain:      parseReplayGain(binary.BigEndian.Uint16(b[15:17])),
+		AudiophileGain: parseReplayGain(binary.BigEndian.Uint16(b[17:19])),
+		EncodingFlags:  int(b[19] >> 4),
+		ATHType:        int(b[19] & 0x0F),
+		Bitrate:        int(b[20]),
+		EncoderDelay:   int(b[21])<<4 | int(b[22]>>4),
+		Padding:        int(b[22]&0x0F)<<8 | int(b[23]),
+		NoiseShaping:   int(b[24] & 0x03),
+		StereoMode:     int(b[24] >> 2 & 0x07),
+		Unwise:         b[24]&0x20 != 0,
+		SourceRate:     int(b[24] >> 6),
+		MP3Gain:        int(int8(b[25])),
+		Surround:       int(b[26] >> 3 & 0x07),
+		Preset:         int(binary.BigEndian.Uint16(b[26:28]) & 0x07FF),
+		MusicLength:    int(binary.BigEndian.Uint32(b[28:32])),
+		MusicCRC:       binary.BigEndian.Uint16(b[32:34]),
+		TagCRC:         binary.BigEndian.Uint16(b[34:36]),
+	}
+	l.TagCRCValid = lameCRC16(0, f.buf[:off+34]) == l.TagCRC
+	return l, nil
+}
+
+// Trim returns the number of decoded samples to drop from the start and
+// end of the stream to leave only its audio, as given by the encoder delay
+// and padding of the tag, taking account of the decoder delay
+func (l *LAMETag) Trim() (skip, tail int) {
+	skip = l.EncoderDelay + DecoderDelay
+	if l.Padding > DecoderDelay {
+		tail = l.Padding - DecoderDelay
+	}
+	return skip, tail
+}
+
+// parseReplayGain decodes a 16 bit LAME tag ReplayGain field
+func parseReplayGain(v uint16) ReplayGain {
+	g := ReplayGain{
+		Name:       int(v >> 13),
+		Originator: int(v >> 10 & 0x07),
+		Gain:       float64(v&0x01FF) / 10,
+	}
+	if v&0x0200 != 0 {
+		g.Gain = -g.Gain
+	}
+	return g
+}
+
+// encode packs the gain into a 16 bit LAME tag ReplayGain field, the
+// inverse of parseReplayGain
+func (g ReplayGain) encode() uint16 {
+	v := uint16(g.Name&0x07)<<13 | uint16(g.Originator&0x07)<<10
+	gain := g.Gain
+	if gain < 0 {
+		v |= 0x0200
+		gain = -gain
+	}
+	n := int(gain*10 + 0.5)
+	if n > 0x01FF {
+		n = 0x01FF
+	}
+	return v | uint16(n)
+}
+
+// put encodes the tag into the first lameTagLen bytes of b, the inverse of
+// LAME. The tag CRC is stored as is, it is up to the caller to compute it
+// once the rest of the frame is in place. EncoderDelay and Padding are
+// limited to the 12 bits the tag allows.
+func (l *LAMETag) put(b []byte) {
+	for i := range b[:9] {
+		b[i] = 0
+	}
+	copy(b[0:9], l.Encoder)
+	b[9] = byte(l.Revision<<4 | l.VBRMethod&0x0F)
+	b[10] = byte(l.Lowpass / 100)
+	binary.BigEndian.PutUint32(b[11:15], uint32(l.Peak*(1<<23)))
+	binary.BigEndian.PutUint16(b[15:17], l.RadioGain.encode())
+	binary.BigEndian.PutUint16(b[17:19], l.AudiophileGain.encode())
+	b[19] = byte(l.EncodingFlags<<4 | l.ATHType&0x0F)
+	b[20] = byte(l.Bitrate)
+	delay, pad := clamp12(l.EncoderDelay), clamp12(l.Padding)
+	b[21] = byte(delay >> 4)
+	b[22] = byte(delay<<4 | pad>>8)
+	b[23] = byte(pad)
+	b[24] = byte(l.NoiseShaping&0x03 | (l.StereoMode&0x07)<<2 | (l.SourceRate&0x03)<<6)
+	if l.Unwise {
+		b[24] |= 0x20
+	}
+	b[25] = byte(int8(l.MP3Gain))
+	binary.BigEndian.PutUint16(b[26:28], uint16(l.Surround&0x07)<<11|uint16(l.Preset&0x07FF))
+	binary.BigEndian.PutUint32(b[28:32], uint32(l.MusicLength))
+	binary.BigEndian.PutUint16(b[32:34], l.MusicCRC)
+	binary.BigEndian.PutUint16(b[34:36], l.TagCRC)
+}
+
+// clamp12 limits v to the range of an unsigned 12 bit field
+func clamp12(v int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > 0x0FFF {
+		return 0x0FFF
+	}
+	return v
+}
+
+// end returns the offset within the frame of the first byte after the Xing
+// header fields, where any LAME tag starts
+func (x *XingHeader) end() int {
+	p := x.offset + 8
+	if x.Flags&XingFrames != 0 {
+		p += 4
+	}
+	if x.Flags&XingBytes != 0 {
+		p += 4
+	}
+	if x.Flags&XingTOC != 0 {
+		p += 100
+	}
+	if x.Flags&XingQuality != 0 {
+		p += 4
+	}
+	return p
+}
+
+// lameCRC16 is the reflected CRC-16 (polynomial 0xA001) used by the LAME tag
+func lameCRC16(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// String renders the tag for display purposes
+func (l *LAMETag) String() string {
+	str := ""
+	str += fmt.Sprintf(" Encoder: %v\n", l.Encoder)
+	str += fmt.Sprintf(" VBRMethod: %v\n", l.VBRMethod)
+	str += fmt.Sprintf(" Lowpass: %v\n", l.Lowpass)
+	str += fmt.Sprintf(" Peak: %v\n", l.Peak)
+	str += fmt.Sprintf(" RadioGain: %+v\n", l.RadioGain)
+	str += fmt.Sprintf(" AudiophileGain: %+v\n", l.AudiophileGain)
+	str += fmt.Sprintf(" EncoderDelay: %v\n", l.EncoderDelay)
+	str += fmt.Sprintf(" Padding: %v\n", l.Padding)
+	str += fmt.Sprintf(" MusicLength: %v\n", l.MusicLength)
+	str += fmt.Sprintf(" TagCRCValid: %v\n", l.TagCRCValid)
+	return str
+}
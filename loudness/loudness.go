@@ -0,0 +1,116 @@
+// Package loudness measures the loudness of mp3 streams, following EBU R128
+// and ITU-R BS.1770, for ReplayGain 2.0. The integrated loudness, loudness
+// range, sample peak and true peak of each stream are found by decoding its
+// frames with the pcm package, and can be combined into album values.
+//
+// Results can be stored as the REPLAYGAIN_* TXXX frames of an ID3v2 tag,
+// with SetID3, or in the ReplayGain fields of a LAME tag, with SetLAME.
+package loudness
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tcolgate/mp3"
+	"github.com/tcolgate/mp3/id3"
+	"github.com/tcolgate/mp3/pcm"
+)
+
+// ErrFormatChange indicates a stream whose sample rate or number of
+// channels changes part way through
+var ErrFormatChange = errors.New("loudness: stream changes format")
+
+// Analyze measures the loudness of the stream of frames read from d. The
+// encoder delay and padding recorded in a LAME tag of the stream are left
+// out, so that only the audio itself is measured.
+func Analyze(d *mp3.Decoder) (*Result, error) {
+	var fd pcm.FrameDecoder
+	var m *Meter
+	var f mp3.Frame
+	var skip, tail int
+	var pend [][]float32 // samples that may be padding
+	skipped := 0
+	for {
+		err := d.Decode(&f, &skipped)
+		if err == io.EOF || err == mp3.ErrNoSyncBits || err == mp3.ErrPrematureEOF {
+			break
+		}
+		if err != nil && err != mp3.ErrCRCMismatch {
+			return nil, err
+		}
+		if f.IsStreamInfo() {
+			if l, err := f.LAME(); err == nil && m == nil {
+				skip, tail = l.Trim()
+			}
+			continue
+		}
+
+		s, err := fd.Decode(&f)
+		if err != nil && err != pcm.ErrMissingMainData && err != pcm.ErrBadFrame {
+			return nil, err
+		}
+		rate := int(f.Header().SampleRate())
+		if m == nil {
+			m = NewMeter(rate, len(s))
+			pend = make([][]float32, len(s))
+		} else if rate != m.Rate() || len(s) != m.Channels() {
+			return nil, ErrFormatChange
+		}
+
+		n := len(s[0])
+		if skip >= n {
+			skip -= n
+			continue
+		}
+		for ch := range s {
+			pend[ch] = append(pend[ch], s[ch][skip:]...)
+		}
+		skip = 0
+		if k := len(pend[0]) - tail; k > 0 {
+			out := make([][]float32, len(pend))
+			for ch := range pend {
+				out[ch] = pend[ch][:k]
+			}
+			m.Add(out)
+			for ch := range pend {
+				pend[ch] = append(pend[ch][:0], pend[ch][k:]...)
+			}
+		}
+	}
+	if m == nil {
+		return nil, mp3.ErrNoFrames
+	}
+	return m.Result(), nil
+}
+
+// SetID3 sets the REPLAYGAIN_TRACK_GAIN, REPLAYGAIN_TRACK_PEAK and
+// REPLAYGAIN_TRACK_RANGE TXXX frames of t from track, and the matching
+// REPLAYGAIN_ALBUM_* frames from album if it is not nil, along with
+// REPLAYGAIN_REFERENCE_LOUDNESS. The sample peak is recorded, as players
+// expect.
+func SetID3(t *id3.Tag, track, album *Result) {
+	t.SetUserText("REPLAYGAIN_REFERENCE_LOUDNESS", fmt.Sprintf("%.2f LUFS", ReferenceLoudness))
+	for _, v := range []struct {
+		name string
+		r    *Result
+	}{{"TRACK", track}, {"ALBUM", album}} {
+		if v.r == nil {
+			continue
+		}
+		t.SetUserText("REPLAYGAIN_"+v.name+"_GAIN", fmt.Sprintf("%.2f dB", v.r.Gain()))
+		t.SetUserText("REPLAYGAIN_"+v.name+"_PEAK", fmt.Sprintf("%.6f", v.r.SamplePeak))
+		t.SetUserText("REPLAYGAIN_"+v.name+"_RANGE", fmt.Sprintf("%.2f dB", v.r.Range))
+	}
+}
+
+// SetLAME sets the radio (track) ReplayGain and peak of l from track, and
+// the audiophile (album) ReplayGain from album if it is not nil. The tag
+// can then be written with mp3.WithLAMETag.
+func SetLAME(l *mp3.LAMETag, track, album *Result) {
+	l.Peak = track.SamplePeak
+	l.RadioGain = mp3.ReplayGain{Name: 1, Originator: 3, Gain: track.Gain()}
+	if album != nil {
+		l.AudiophileGain = mp3.ReplayGain{Name: 2, Originator: 3, Gain: album.Gain()}
+	}
+}
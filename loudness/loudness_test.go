@@ -0,0 +1,169 @@
+package loudness
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/tcolgate/mp3"
+	"github.com/tcolgate/mp3/encoder"
+	"github.com/tcolgate/mp3/id3"
+)
+
+// sine returns n samples of a sine wave, with the given peak level in dBFS
+// and starting phase, for each of channels channels
+func sine(n, channels, rate int, freq, level, phase float64) [][]float32 {
+	a := math.Pow(10, level/20)
+	s := make([][]float32, channels)
+	for ch := range s {
+		s[ch] = make([]float32, n)
+		for i := range s[ch] {
+			s[ch][i] = float32(a * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)+phase))
+		}
+	}
+	return s
+}
+
+func TestMeter(t *testing.T) {
+	// EBU Tech 3341 case 1, a stereo 1kHz sine at -23dBFS
+	m := NewMeter(48000, 2)
+	m.Add(sine(20*48000, 2, 48000, 997, -23, 0))
+	r := m.Result()
+	if math.Abs(r.Integrated+23) > 0.1 {
+		t.Errorf("expected -23 LUFS, got %v", r.Integrated)
+	}
+	if math.Abs(r.Gain()-5) > 0.1 {
+		t.Errorf("expected gain of 5dB, got %v", r.Gain())
+	}
+	if want := math.Pow(10, -23.0/20); math.Abs(r.SamplePeak-want) > 1e-4 {
+		t.Errorf("expected sample peak %v, got %v", want, r.SamplePeak)
+	}
+
+	// EBU Tech 3342 case 1, 20s at -20dBFS then 20s at -30dBFS
+	m = NewMeter(48000, 2)
+	m.Add(sine(20*48000, 2, 48000, 1000, -20, 0))
+	m.Add(sine(20*48000, 2, 48000, 1000, -30, 0))
+	if r := m.Result(); math.Abs(r.Range-10) > 1 {
+		t.Errorf("expected range of 10 LU, got %v", r.Range)
+	}
+
+	// a sine at a quarter of the sample rate, sampled 45 degrees from its
+	// peaks
+	m = NewMeter(48000, 1)
+	m.Add(sine(48000, 1, 48000, 12000, 0, math.Pi/4))
+	r = m.Result()
+	if math.Abs(r.SamplePeak-math.Sqrt(0.5)) > 1e-4 {
+		t.Errorf("expected sample peak 0.707, got %v", r.SamplePeak)
+	}
+	if tp := 20 * math.Log10(r.TruePeak); math.Abs(tp) > 0.2 {
+		t.Errorf("expected true peak 0dBFS, got %vdBFS", tp)
+	}
+
+	m = NewMeter(44100, 2)
+	m.Add(sine(44100, 2, 44100, 1000, -100, 0))
+	if r := m.Result(); !math.IsInf(r.Integrated, -1) || r.Gain() != 0 {
+		t.Errorf("expected silence, got %v LUFS, gain %v", r.Integrated, r.Gain())
+	}
+}
+
+// encode encodes the samples, with a LAME tag giving their delay and
+// padding
+func encode(t *testing.T, s [][]float32, rate int) []byte {
+	e, err := encoder.New(rate, len(s))
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	in := make([]int16, len(s[0])*len(s))
+	for i := range s[0] {
+		for ch := range s {
+			in[i*len(s)+ch] = int16(s[ch][i] * 32767)
+		}
+	}
+	fs, err := e.Encode(in)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	rest, err := e.Flush()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+
+	// the Writer needs to seek back to fill in its header frame
+	tmp, err := ioutil.TempFile("", "loudness")
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	w := mp3.NewWriter(tmp, mp3.WithLAMETag(mp3.LAMETag{
+		EncoderDelay: e.Delay() - mp3.DecoderDelay,
+		Padding:      e.Padding() + mp3.DecoderDelay,
+	}))
+	for _, f := range append(fs, rest...) {
+		if err := w.WriteFrame(f); err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	b, err := ioutil.ReadFile(tmp.Name())
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	return b
+}
+
+func TestAnalyze(t *testing.T) {
+	loud := encode(t, sine(5*44100, 2, 44100, 1000, -10, 0), 44100)
+	quiet := encode(t, sine(5*44100, 2, 44100, 1000, -30, 0), 44100)
+
+	var rs []*Result
+	for _, b := range [][]byte{loud, quiet} {
+		r, err := Analyze(mp3.NewDecoder(bytes.NewReader(b)))
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		rs = append(rs, r)
+	}
+	if math.Abs(rs[0].Integrated+10) > 0.2 || math.Abs(rs[1].Integrated+30) > 0.2 {
+		t.Errorf("expected -10 and -30 LUFS, got %v and %v", rs[0].Integrated, rs[1].Integrated)
+	}
+	if math.Abs(rs[0].SamplePeak-math.Pow(10, -0.5)) > 0.01 {
+		t.Errorf("expected sample peak %v, got %v", math.Pow(10, -0.5), rs[0].SamplePeak)
+	}
+
+	// the quiet track falls below the relative gate of the album
+	a := Album(rs...)
+	if math.Abs(a.Integrated+10) > 0.2 || a.SamplePeak != rs[0].SamplePeak {
+		t.Errorf("unexpected album loudness %v, peak %v", a.Integrated, a.SamplePeak)
+	}
+
+	tag := id3.NewTag(4)
+	SetID3(tag, rs[1], a)
+	for desc, want := range map[string]string{
+		"REPLAYGAIN_TRACK_GAIN":         fmt.Sprintf("%.2f dB", rs[1].Gain()),
+		"REPLAYGAIN_TRACK_PEAK":         fmt.Sprintf("%.6f", rs[1].SamplePeak),
+		"REPLAYGAIN_ALBUM_GAIN":         fmt.Sprintf("%.2f dB", a.Gain()),
+		"REPLAYGAIN_ALBUM_RANGE":        fmt.Sprintf("%.2f dB", a.Range),
+		"REPLAYGAIN_REFERENCE_LOUDNESS": "-18.00 LUFS",
+	} {
+		if got := tag.UserText(desc); got != want {
+			t.Errorf("expected %s of %q, got %q", desc, want, got)
+		}
+	}
+
+	var l mp3.LAMETag
+	SetLAME(&l, rs[1], a)
+	if l.RadioGain.Name != 1 || math.Abs(l.RadioGain.Gain-12) > 0.2 ||
+		l.AudiophileGain.Name != 2 || math.Abs(l.AudiophileGain.Gain+8) > 0.2 {
+		t.Errorf("unexpected LAME gains %+v, %+v", l.RadioGain, l.AudiophileGain)
+	}
+
+	if _, err := Analyze(mp3.NewDecoder(bytes.NewReader(nil))); err != mp3.ErrNoFrames {
+		t.Errorf("expected ErrNoFrames, got %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package loudness
+
+import (
+	"math"
+	"sort"
+)
+
+type (
+	// Meter measures the loudness of PCM audio, following ITU-R BS.1770-4
+	// and EBU Tech 3341 and 3342. Audio is K-weighted and its mean square
+	// taken over 100ms steps, from which overlapping 400ms blocks give the
+	// integrated loudness and 3s blocks the loudness range.
+	Meter struct {
+		rate     int
+		channels int
+		filters  []kFilter
+		peaks    []truePeak
+
+		step int     // samples per 100ms step
+		n    int     // samples in the current step
+		sum  float64 // weighted sum of squares of the current step
+		hist []float64
+
+		res Result
+	}
+
+	// Result holds the loudness of a stream, or of an album of streams
+	Result struct {
+		// Integrated is the gated loudness in LUFS, negative infinity if
+		// no audio rose above the absolute gate of -70 LUFS
+		Integrated float64
+		// Range is the loudness range in LU
+		Range float64
+		// SamplePeak is the largest absolute sample value, 1.0 being full
+		// scale
+		SamplePeak float64
+		// TruePeak is the peak of the audio oversampled four times, an
+		// estimate of the peak of the reconstructed signal
+		TruePeak float64
+
+		blocks []float64 // mean squares of the 400ms blocks
+		short  []float64 // mean squares of the 3s blocks
+	}
+
+	// kFilter is the K-weighting filter of one channel, a high shelf
+	// followed by a high pass, as a pair of biquads
+	kFilter struct {
+		b, a [2][3]float64
+		z    [2][2]float64
+	}
+
+	// truePeak oversamples one channel to find its true peak
+	truePeak struct {
+		hist [truePeakTaps]float64
+		peak float64
+	}
+)
+
+const (
+	// ReferenceLoudness is the level, in LUFS, that ReplayGain 2.0 gains
+	// bring streams to
+	ReferenceLoudness = -18.0
+
+	absoluteGate = -70.0 // LUFS
+	relativeGate = -10.0 // LU below the ungated integrated loudness
+	rangeGate    = -20.0 // LU below the ungated short term loudness
+
+	blockSteps = 4  // 100ms steps in a 400ms block
+	shortSteps = 30 // 100ms steps in a 3s block
+
+	oversample   = 4
+	truePeakTaps = 12 // input samples in the interpolation filter
+)
+
+// interp holds the phases of the windowed sinc filter that interpolates
+// between samples for the true peak
+var interp [oversample][truePeakTaps]float64
+
+func init() {
+	n := oversample * truePeakTaps
+	c := float64(n-1) / 2
+	for k := 0; k < n; k++ {
+		x := (float64(k) - c) / oversample
+		v := 1.0
+		if x != 0 {
+			v = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		// Blackman window
+		w := 0.42 - 0.5*math.Cos(2*math.Pi*float64(k)/float64(n-1)) +
+			0.08*math.Cos(4*math.Pi*float64(k)/float64(n-1))
+		interp[k%oversample][k/oversample] = v * w
+	}
+}
+
+// NewMeter returns a Meter for audio of the given sample rate and number of
+// channels
+func NewMeter(rate, channels int) *Meter {
+	m := &Meter{
+		rate:     rate,
+		channels: channels,
+		filters:  make([]kFilter, channels),
+		peaks:    make([]truePeak, channels),
+		step:     (rate + 5) / 10,
+	}
+	for i := range m.filters {
+		m.filters[i] = newKFilter(float64(rate))
+	}
+	return m
+}
+
+// newKFilter returns the K-weighting filter for the sample rate, as given
+// by BS.1770 at 48kHz and derived for other rates
+func newKFilter(rate float64) kFilter {
+	var f kFilter
+
+	// high shelf
+	k := math.Tan(math.Pi * 1681.974450955533 / rate)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	f.b[0] = [3]float64{(vh + vb*k/q + k*k) / a0, 2 * (k*k - vh) / a0, (vh - vb*k/q + k*k) / a0}
+	f.a[0] = [3]float64{1, 2 * (k*k - 1) / a0, (1 - k/q + k*k) / a0}
+
+	// high pass
+	k = math.Tan(math.Pi * 38.13547087602444 / rate)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	f.b[1] = [3]float64{1, -2, 1}
+	f.a[1] = [3]float64{1, 2 * (k*k - 1) / a0, (1 - k/q + k*k) / a0}
+	return f
+}
+
+// filter passes one sample through the filter
+func (f *kFilter) filter(x float64) float64 {
+	for i := range f.b {
+		b, a, z := &f.b[i], &f.a[i], &f.z[i]
+		y := b[0]*x + z[0]
+		z[0] = b[1]*x - a[1]*y + z[1]
+		z[1] = b[2]*x - a[2]*y
+		x = y
+	}
+	return x
+}
+
+// add takes the next sample of the channel
+func (p *truePeak) add(x float64) {
+	copy(p.hist[1:], p.hist[:truePeakTaps-1])
+	p.hist[0] = x
+	for _, h := range interp {
+		var y float64
+		for i, c := range h {
+			y += c * p.hist[i]
+		}
+		if y = math.Abs(y); y > p.peak {
+			p.peak = y
+		}
+	}
+}
+
+// Rate returns the sample rate of the audio measured
+func (m *Meter) Rate() int {
+	return m.rate
+}
+
+// Channels returns the number of channels of the audio measured
+func (m *Meter) Channels() int {
+	return m.channels
+}
+
+// Add measures the samples, one slice per channel, as returned by
+// pcm.FrameDecoder. Samples are in the range [-1, 1].
+func (m *Meter) Add(samples [][]float32) {
+	if len(samples) < m.channels {
+		return
+	}
+	for i := range samples[0] {
+		for ch := 0; ch < m.channels; ch++ {
+			x := float64(samples[ch][i])
+			if a := math.Abs(x); a > m.res.SamplePeak {
+				m.res.SamplePeak = a
+			}
+			m.peaks[ch].add(x)
+			y := m.filters[ch].filter(x)
+			m.sum += y * y
+		}
+		if m.n++; m.n == m.step {
+			m.next()
+		}
+	}
+}
+
+// next completes a 100ms step, and the blocks that end with it
+func (m *Meter) next() {
+	m.hist = append(m.hist, m.sum)
+	if len(m.hist) > shortSteps {
+		m.hist = m.hist[1:]
+	}
+	m.sum, m.n = 0, 0
+
+	if n := len(m.hist); n >= blockSteps {
+		m.res.blocks = append(m.res.blocks, meanSquare(m.hist[n-blockSteps:], m.step))
+	}
+	if len(m.hist) == shortSteps {
+		m.res.short = append(m.res.short, meanSquare(m.hist, m.step))
+	}
+}
+
+// meanSquare returns the mean square of the steps of n samples
+func meanSquare(steps []float64, n int) float64 {
+	var sum float64
+	for _, s := range steps {
+		sum += s
+	}
+	return sum / float64(len(steps)*n)
+}
+
+// Result returns the loudness of the audio added so far. Blocks not yet
+// complete are left out.
+func (m *Meter) Result() *Result {
+	r := m.res
+	r.blocks = append([]float64(nil), m.res.blocks...)
+	r.short = append([]float64(nil), m.res.short...)
+	for _, p := range m.peaks {
+		if p.peak > r.TruePeak {
+			r.TruePeak = p.peak
+		}
+	}
+	if r.SamplePeak > r.TruePeak {
+		r.TruePeak = r.SamplePeak
+	}
+	r.measure()
+	return &r
+}
+
+// Album returns the loudness of the streams with the given results taken
+// together, as for ReplayGain album gain
+func Album(rs ...*Result) *Result {
+	a := &Result{}
+	for _, r := range rs {
+		a.blocks = append(a.blocks, r.blocks...)
+		a.short = append(a.short, r.short...)
+		if r.SamplePeak > a.SamplePeak {
+			a.SamplePeak = r.SamplePeak
+		}
+		if r.TruePeak > a.TruePeak {
+			a.TruePeak = r.TruePeak
+		}
+	}
+	a.measure()
+	return a
+}
+
+// measure gates the blocks to find the integrated loudness and loudness
+// range
+func (r *Result) measure() {
+	r.Integrated = math.Inf(-1)
+	r.Range = 0
+
+	bs := gate(r.blocks, meanSquareOf(absoluteGate))
+	if len(bs) > 0 {
+		bs = gate(bs, mean(bs)*math.Pow(10, relativeGate/10))
+		r.Integrated = loudness(mean(bs))
+	}
+
+	ss := gate(r.short, meanSquareOf(absoluteGate))
+	if len(ss) == 0 {
+		return
+	}
+	ss = gate(ss, mean(ss)*math.Pow(10, rangeGate/10))
+	sort.Float64s(ss)
+	lo := ss[int(float64(len(ss)-1)*0.10+0.5)]
+	hi := ss[int(float64(len(ss)-1)*0.95+0.5)]
+	r.Range = loudness(hi) - loudness(lo)
+}
+
+// Gain returns the ReplayGain 2.0 gain, in dB, that brings the audio to
+// ReferenceLoudness. It is 0 if the audio is silent.
+func (r *Result) Gain() float64 {
+	if math.IsInf(r.Integrated, -1) {
+		return 0
+	}
+	return ReferenceLoudness - r.Integrated
+}
+
+// gate returns the blocks whose mean square is above min
+func gate(blocks []float64, min float64) []float64 {
+	var out []float64
+	for _, b := range blocks {
+		if b > min {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func mean(vs []float64) float64 {
+	var sum float64
+	for _, v := range vs {
+		sum += v
+	}
+	return sum / float64(len(vs))
+}
+
+// loudness converts a weighted mean square to LUFS
+func loudness(ms float64) float64 {
+	return -0.691 + 10*math.Log10(ms)
+}
+
+// meanSquareOf converts a loudness in LUFS to a weighted mean square
+func meanSquareOf(l float64) float64 {
+	return math.Pow(10, (l+0.691)/10)
+}
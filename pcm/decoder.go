@@ -0,0 +1,86 @@
+package pcm
+
+import (
+	"errors"
+
+	"github.com/tcolgate/mp3"
+	"github.com/tcolgate/mp3/internal/filterbank"
+)
+
+// FrameDecoder decodes individual frames into PCM samples. It carries the
+// state needed between consecutive frames of a stream, such as the bit
+// reservoir and the filterbank history, so frames must be passed to it in
+// stream order.
+type FrameDecoder struct {
+	l12   layer12
+	l3    layer3Decoder
+	synth [2]filterbank.Synthesis
+	out   [2][]float32
+}
+
+var (
+	// ErrUnsupportedLayer indicates a frame of a layer that cannot be decoded
+	ErrUnsupportedLayer = errors.New("pcm: unsupported layer")
+
+	// ErrMissingMainData indicates that the main data of a Layer III frame
+	// begins in frames that were not seen, as happens at the start of a
+	// stream or after a seek. The frame decodes as silence.
+	ErrMissingMainData = mp3.ErrMissingMainData
+
+	// ErrBadFrame indicates a Layer I or II frame with invalid allocation
+	// or scalefactor data, or too short to hold its samples
+	ErrBadFrame = errors.New("pcm: invalid frame data")
+)
+
+// Decode decodes the frame f, of any layer, returning one slice of samples
+// per channel. Samples are in the range [-1, 1]. The slices are reused by
+// the next call to Decode. ErrMissingMainData and ErrBadFrame are returned
+// along with silent samples when the frame cannot be decoded, and decoding
+// may continue with the next frame.
+func (d *FrameDecoder) Decode(f *mp3.Frame) ([][]float32, error) {
+	h := f.Header()
+	nch := 2
+	if h.ChannelMode() == mp3.SingleChannel {
+		nch = 1
+	}
+	n := f.Samples()
+	for ch := 0; ch < nch; ch++ {
+		if cap(d.out[ch]) < n {
+			d.out[ch] = make([]float32, n)
+		}
+		d.out[ch] = d.out[ch][:n]
+	}
+	out := d.out[:nch]
+
+	var err error
+	switch h.Layer() {
+	case mp3.Layer1:
+		err = d.l12.layer1(f, &d.synth, out)
+	case mp3.Layer2:
+		err = d.l12.layer2(f, &d.synth, out)
+	case mp3.Layer3:
+		err = d.l3.decode(f, &d.synth, out)
+	default:
+		return nil, ErrUnsupportedLayer
+	}
+	if err == ErrBadFrame {
+		for ch := range out {
+			for i := range out[ch] {
+				out[ch][i] = 0
+			}
+		}
+	}
+	if err != nil && err != ErrMissingMainData && err != ErrBadFrame {
+		return nil, err
+	}
+	return out, err
+}
+
+// Reset discards the state carried between frames. It should be called
+// when the frames passed to Decode stop being contiguous, after a seek for
+// instance.
+func (d *FrameDecoder) Reset() {
+	d.l3.reset()
+	d.synth[0].Reset()
+	d.synth[1].Reset()
+}
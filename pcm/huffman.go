@@ -0,0 +1,115 @@
+package pcm
+
+import (
+	"github.com/tcolgate/mp3/internal/bits"
+	"github.com/tcolgate/mp3/internal/layer3"
+)
+
+type (
+	// huffTree is a binary decoding tree built from a code table. Each node
+	// holds its two children, negative entries are leaves holding -(value+1).
+	huffTree [][2]int16
+
+	// huffTable describes one of the 32 big value tables
+	huffTable struct {
+		tree    huffTree
+		dim     int
+		linbits int
+	}
+)
+
+var (
+	bigValueTables [32]huffTable
+	count1Tables   [2]huffTree
+)
+
+func init() {
+	trees := map[*uint16]huffTree{}
+	tree := func(t *layer3.HuffTable) huffTree {
+		if t.Codes == nil {
+			return nil
+		}
+		if tr, ok := trees[&t.Codes[0]]; ok {
+			return tr
+		}
+		tr := newHuffTree(t.Codes, t.Lens)
+		trees[&t.Codes[0]] = tr
+		return tr
+	}
+	for i := range layer3.BigValueTables {
+		t := &layer3.BigValueTables[i]
+		bigValueTables[i] = huffTable{tree: tree(t), dim: t.Dim, linbits: t.Linbits}
+	}
+	for i := range layer3.Count1Tables {
+		count1Tables[i] = tree(&layer3.Count1Tables[i])
+	}
+}
+
+// newHuffTree builds a decoding tree from a set of codes and their lengths.
+func newHuffTree(codes []uint16, lens []uint8) huffTree {
+	t := huffTree{{0, 0}}
+	for v, c := range codes {
+		n := 0
+		for i := int(lens[v]) - 1; i >= 0; i-- {
+			b := (c >> uint(i)) & 1
+			if i == 0 {
+				t[n][b] = int16(-(v + 1))
+				break
+			}
+			if t[n][b] == 0 {
+				t = append(t, [2]int16{0, 0})
+				t[n][b] = int16(len(t) - 1)
+			}
+			n = int(t[n][b])
+		}
+	}
+	return t
+}
+
+// decode reads one code from r. Invalid codes decode as zero.
+func (t huffTree) decode(r *bits.Reader) int {
+	n := 0
+	for {
+		c := t[n][r.Read(1)]
+		if c < 0 {
+			return int(-c - 1)
+		}
+		if c == 0 || r.Err() != nil {
+			return 0
+		}
+		n = int(c)
+	}
+}
+
+// pair decodes a pair of big values, including any linbits and signs
+func (t *huffTable) pair(r *bits.Reader) (x, y int) {
+	if t.tree == nil {
+		return 0, 0
+	}
+	v := t.tree.decode(r)
+	x, y = v/t.dim, v%t.dim
+	x = t.value(r, x)
+	y = t.value(r, y)
+	return x, y
+}
+
+func (t *huffTable) value(r *bits.Reader, v int) int {
+	if v == 15 && t.linbits > 0 {
+		v += int(r.Read(t.linbits))
+	}
+	if v != 0 && r.Bit() {
+		v = -v
+	}
+	return v
+}
+
+// quad decodes a quadruple of count1 values, including their signs
+func (t huffTree) quad(r *bits.Reader, q *[4]int) {
+	v := t.decode(r)
+	for i := 0; i < 4; i++ {
+		q[i] = (v >> uint(3-i)) & 1
+		if q[i] != 0 && r.Bit() {
+			q[i] = -q[i]
+		}
+	}
+}
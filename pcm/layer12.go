@@ -0,0 +1,204 @@
+package pcm
+
+import (
+	"math"
+
+	"github.com/tcolgate/mp3"
+	"github.com/tcolgate/mp3/internal/bits"
+	"github.com/tcolgate/mp3/internal/filterbank"
+	"github.com/tcolgate/mp3/internal/layer2"
+)
+
+// layer12 decodes Layer I and Layer II frames, which carry no state between
+// frames beyond the synthesis filterbank
+type layer12 struct {
+	br bits.Reader
+}
+
+// scaleFactors holds the Layer I and II scalefactors, index 63 is invalid
+var scaleFactors [64]float32
+
+func init() {
+	for i := 0; i < 63; i++ {
+		scaleFactors[i] = float32(math.Exp2(1 - float64(i)/3))
+	}
+}
+
+// jointBound gives the first subband coded as intensity stereo, limited to
+// limit
+func jointBound(h mp3.FrameHeader, limit int) int {
+	if h.ChannelMode() != mp3.JointStereo {
+		return limit
+	}
+	b := int(h.ModeExtension()+1) * 4
+	if b > limit {
+		return limit
+	}
+	return b
+}
+
+// dequantize12 maps a code of a quantiser with the given number of levels
+// to a fraction in (-1, 1)
+func dequantize12(c, levels int) float32 {
+	return float32(2*c-levels+1) / float32(levels)
+}
+
+// layer1 decodes a Layer I frame into out
+func (d *layer12) layer1(f *mp3.Frame, synth *[2]filterbank.Synthesis, out [][]float32) error {
+	h := f.Header()
+	nch := len(out)
+	bound := jointBound(h, 32)
+	d.br.Reset(f.Body())
+
+	var alloc [2][32]int
+	for sb := 0; sb < 32; sb++ {
+		for ch := 0; ch < nch; ch++ {
+			if sb >= bound && ch > 0 {
+				alloc[ch][sb] = alloc[0][sb]
+				continue
+			}
+			a := int(d.br.Read(4))
+			if a == 15 {
+				return ErrBadFrame
+			}
+			alloc[ch][sb] = a
+		}
+	}
+
+	var scale [2][32]float32
+	for sb := 0; sb < 32; sb++ {
+		for ch := 0; ch < nch; ch++ {
+			if alloc[ch][sb] != 0 {
+				scale[ch][sb] = scaleFactors[d.br.Read(6)]
+			}
+		}
+	}
+
+	var smp [2][32]float32
+	for s := 0; s < 12; s++ {
+		for sb := 0; sb < 32; sb++ {
+			var v float32
+			for ch := 0; ch < nch; ch++ {
+				if sb < bound || ch == 0 {
+					v = 0
+					if a := alloc[ch][sb]; a != 0 {
+						v = dequantize12(int(d.br.Read(a+1)), 1<<uint(a+1)-1)
+					}
+				}
+				smp[ch][sb] = v * scale[ch][sb]
+			}
+		}
+		for ch := 0; ch < nch; ch++ {
+			synth[ch].Filter(&smp[ch], out[ch][s*32:])
+		}
+	}
+
+	if d.br.Err() != nil {
+		return ErrBadFrame
+	}
+	return nil
+}
+
+// layer2 decodes a Layer II frame into out
+func (d *layer12) layer2(f *mp3.Frame, synth *[2]filterbank.Synthesis, out [][]float32) error {
+	h := f.Header()
+	nch := len(out)
+	t := layer2.Select(h.Version() != mp3.MPEG1, int(f.BitRate())/1000/nch, int(h.SampleRate()))
+	bound := jointBound(h, t.SBLimit)
+	d.br.Reset(f.Body())
+
+	var alloc [2][32]int
+	for sb := 0; sb < t.SBLimit; sb++ {
+		for ch := 0; ch < nch; ch++ {
+			if sb >= bound && ch > 0 {
+				alloc[ch][sb] = alloc[0][sb]
+				continue
+			}
+			alloc[ch][sb] = int(d.br.Read(t.NBal[sb]))
+		}
+	}
+
+	var scfsi [2][32]uint32
+	for sb := 0; sb < t.SBLimit; sb++ {
+		for ch := 0; ch < nch; ch++ {
+			if alloc[ch][sb] != 0 {
+				scfsi[ch][sb] = d.br.Read(2)
+			}
+		}
+	}
+
+	var scale [2][32][3]float32
+	for sb := 0; sb < t.SBLimit; sb++ {
+		for ch := 0; ch < nch; ch++ {
+			if alloc[ch][sb] == 0 {
+				continue
+			}
+			sf := &scale[ch][sb]
+			switch scfsi[ch][sb] {
+			case 0:
+				sf[0] = scaleFactors[d.br.Read(6)]
+				sf[1] = scaleFactors[d.br.Read(6)]
+				sf[2] = scaleFactors[d.br.Read(6)]
+			case 1:
+				sf[0] = scaleFactors[d.br.Read(6)]
+				sf[1] = sf[0]
+				sf[2] = scaleFactors[d.br.Read(6)]
+			case 2:
+				sf[0] = scaleFactors[d.br.Read(6)]
+				sf[1], sf[2] = sf[0], sf[0]
+			case 3:
+				sf[0] = scaleFactors[d.br.Read(6)]
+				sf[1] = scaleFactors[d.br.Read(6)]
+				sf[2] = sf[1]
+			}
+		}
+	}
+
+	var smp [2][3][32]float32
+	for gr := 0; gr < 12; gr++ {
+		part := gr / 4
+		for sb := 0; sb < 32; sb++ {
+			var v [3]float32
+			for ch := 0; ch < nch; ch++ {
+				if sb < bound || ch == 0 {
+					v = d.layer2Samples(t, sb, alloc[ch][sb])
+				}
+				for s := 0; s < 3; s++ {
+					smp[ch][s][sb] = v[s] * scale[ch][sb][part]
+				}
+			}
+		}
+		for s := 0; s < 3; s++ {
+			for ch := 0; ch < nch; ch++ {
+				synth[ch].Filter(&smp[ch][s], out[ch][(gr*3+s)*32:])
+			}
+		}
+	}
+
+	if d.br.Err() != nil {
+		return ErrBadFrame
+	}
+	return nil
+}
+
+// layer2Samples reads the three consecutive samples of a subband, given its
+// allocation, returning them as fractions
+func (d *layer12) layer2Samples(t *layer2.AllocTable, sb, a int) [3]float32 {
+	var v [3]float32
+	if sb >= t.SBLimit || a == 0 {
+		return v
+	}
+	q := layer2.QuantClasses[t.Class[sb][a-1]]
+	if q.Grouped {
+		c := int(d.br.Read(q.Bits))
+		for s := 0; s < 3; s++ {
+			v[s] = dequantize12(c%q.Levels, q.Levels)
+			c /= q.Levels
+		}
+		return v
+	}
+	for s := 0; s < 3; s++ {
+		v[s] = dequantize12(int(d.br.Read(q.Bits)), q.Levels)
+	}
+	return v
+}
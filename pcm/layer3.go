@@ -0,0 +1,627 @@
+package pcm
+
+import (
+	"math"
+
+	"github.com/tcolgate/mp3"
+	"github.com/tcolgate/mp3/internal/bits"
+	"github.com/tcolgate/mp3/internal/filterbank"
+	"github.com/tcolgate/mp3/internal/layer3"
+)
+
+type (
+	// layer3Decoder holds the Layer III decoder state carried between frames
+	layer3Decoder struct {
+		reservoir mp3.Reservoir
+		br        bits.Reader
+
+		scalefac [2]scalefactors
+		is       [2][576]int
+		xr       [2][576]float32
+		nonzero  [2]int
+		isLine   [576]bool
+
+		overlap [2][32][18]float32
+	}
+
+	// scalefactors holds the scalefactors of one channel. lmax and smax
+	// hold the illegal intensity positions for MPEG-2 streams.
+	scalefactors struct {
+		l    [22]int
+		s    [13][3]int
+		lmax [22]int
+		smax [13]int
+	}
+)
+
+// decode decodes a Layer III frame into out, one slice per channel. Frames
+// whose main data is not yet available are decoded as silence, and
+// ErrMissingMainData is returned.
+func (d *layer3Decoder) decode(f *mp3.Frame, synth *[2]filterbank.Synthesis, out [][]float32) error {
+	si, ok, err := d.start(f)
+	if err != nil {
+		return err
+	}
+	bt := bands(f.Header())
+
+	for gr := 0; gr < si.Granules; gr++ {
+		d.granule(f.Header(), si, gr, ok)
+		for ch := 0; ch < si.Channels; ch++ {
+			g := &si.Granule[gr][ch]
+			d.reorder(g, bt, ch)
+			d.antialias(g, ch)
+			d.hybrid(g, ch)
+			d.subbandSynthesis(&synth[ch], ch, out[ch][gr*576:])
+		}
+	}
+
+	if !ok {
+		return ErrMissingMainData
+	}
+	return nil
+}
+
+// start parses the side info of a frame and assembles its main data,
+// reporting whether the main data was complete
+func (d *layer3Decoder) start(f *mp3.Frame) (*mp3.Layer3SideInfo, bool, error) {
+	si, err := f.ParseSideInfo()
+	if err != nil {
+		return nil, false, err
+	}
+	main, err := d.reservoir.Add(f)
+	ok := err == nil
+	if !ok && err != mp3.ErrMissingMainData {
+		return nil, false, err
+	}
+	d.br.Reset(main)
+	return si, ok, nil
+}
+
+// granule decodes the frequency lines of every channel of granule gr into
+// d.xr, up to and including stereo processing. If ok is false the lines
+// are all zero.
+func (d *layer3Decoder) granule(h mp3.FrameHeader, si *mp3.Layer3SideInfo, gr int, ok bool) {
+	bt := bands(h)
+	mpeg1 := h.Version() == mp3.MPEG1
+	for ch := 0; ch < si.Channels; ch++ {
+		g := &si.Granule[gr][ch]
+		if ok {
+			part2 := d.br.Pos()
+			if mpeg1 {
+				d.readScalefactors(si, gr, ch)
+			} else {
+				rightIS := ch == 1 && h.ChannelMode() == mp3.JointStereo && h.ModeExtension()&1 != 0
+				d.readScalefactorsLSF(g, ch, rightIS)
+			}
+			d.readHuffman(g, bt, ch, part2+g.Part2_3Length)
+			d.br.Seek(part2 + g.Part2_3Length)
+		} else {
+			d.is[ch] = [576]int{}
+			d.nonzero[ch] = 0
+		}
+		d.requantize(g, bt, ch)
+	}
+
+	if si.Channels == 2 {
+		d.stereo(h, &si.Granule[gr][1], bt, mpeg1)
+	}
+}
+
+// reset drops the reservoir and IMDCT overlap
+func (d *layer3Decoder) reset() {
+	d.reservoir.Reset()
+	d.overlap = [2][32][18]float32{}
+}
+
+// bands returns the scalefactor bands for the sample rate of h
+func bands(h mp3.FrameHeader) *layer3.Bands {
+	v := h.Version()
+	return &layer3.SFBands[layer3.BandIndex(int(h[2]>>2)&0x03, v == mp3.MPEG2, v == mp3.MPEG25)]
+}
+
+// readScalefactors reads the MPEG-1 scalefactors for a granule and channel
+func (d *layer3Decoder) readScalefactors(si *mp3.Layer3SideInfo, gr, ch int) {
+	g := &si.Granule[gr][ch]
+	sf := &d.scalefac[ch]
+	slen1 := layer3.Slen[0][g.ScalefacCompress]
+	slen2 := layer3.Slen[1][g.ScalefacCompress]
+
+	if g.WindowSwitching && g.BlockType == 2 {
+		sfb := 0
+		if g.MixedBlock {
+			for ; sfb < 8; sfb++ {
+				sf.l[sfb] = int(d.br.Read(slen1))
+			}
+			sfb = 3
+		}
+		for ; sfb < 12; sfb++ {
+			n := slen1
+			if sfb >= 6 {
+				n = slen2
+			}
+			for win := 0; win < 3; win++ {
+				sf.s[sfb][win] = int(d.br.Read(n))
+			}
+		}
+		sf.s[12] = [3]int{}
+		return
+	}
+
+	groups := [5]int{0, 6, 11, 16, 21}
+	for i := 0; i < 4; i++ {
+		if gr == 1 && si.Scfsi[ch][i] {
+			continue
+		}
+		n := slen1
+		if i >= 2 {
+			n = slen2
+		}
+		for sfb := groups[i]; sfb < groups[i+1]; sfb++ {
+			sf.l[sfb] = int(d.br.Read(n))
+		}
+	}
+	sf.l[21] = 0
+}
+
+// readScalefactorsLSF reads the MPEG-2 scalefactors for a channel. rightIS
+// is set for the right channel of an intensity stereo frame, which uses a
+// different layout.
+func (d *layer3Decoder) readScalefactorsLSF(g *mp3.GranuleInfo, ch int, rightIS bool) {
+	sf := &d.scalefac[ch]
+	var slens [4]int
+	var layout int
+	c := g.ScalefacCompress
+	if !rightIS {
+		switch {
+		case c < 400:
+			slens = [4]int{(c >> 4) / 5, (c >> 4) % 5, (c & 15) >> 2, c & 3}
+			layout = 0
+		case c < 500:
+			c -= 400
+			slens = [4]int{(c >> 2) / 5, (c >> 2) % 5, c & 3, 0}
+			layout = 1
+		default:
+			c -= 500
+			slens = [4]int{c / 3, c % 3, 0, 0}
+			layout = 2
+			g.Preflag = true
+		}
+	} else {
+		c >>= 1
+		switch {
+		case c < 180:
+			slens = [4]int{c / 36, (c % 36) / 6, (c % 36) % 6, 0}
+			layout = 3
+		case c < 244:
+			c -= 180
+			slens = [4]int{(c % 64) >> 4, (c % 16) >> 2, c % 4, 0}
+			layout = 4
+		default:
+			c -= 244
+			slens = [4]int{c / 3, c % 3, 0, 0}
+			layout = 5
+		}
+	}
+
+	block := 0
+	if g.WindowSwitching && g.BlockType == 2 {
+		block = 1
+		if g.MixedBlock {
+			block = 2
+		}
+	}
+
+	var vals, max [39]int
+	n := 0
+	for part, count := range layer3.NrOfSfb[layout][block] {
+		for i := 0; i < count; i++ {
+			vals[n] = int(d.br.Read(slens[part]))
+			max[n] = 1<<uint(slens[part]) - 1
+			n++
+		}
+	}
+
+	n = 0
+	sfb := 0
+	switch block {
+	case 0:
+		for ; sfb < 21; sfb++ {
+			sf.l[sfb], sf.lmax[sfb] = vals[n], max[n]
+			n++
+		}
+		sf.l[21], sf.lmax[21] = 0, sf.lmax[20]
+		return
+	case 2:
+		for ; sfb < 6; sfb++ {
+			sf.l[sfb], sf.lmax[sfb] = vals[n], max[n]
+			n++
+		}
+		sfb = 3
+	}
+	for ; sfb < 12; sfb++ {
+		for win := 0; win < 3; win++ {
+			sf.s[sfb][win] = vals[n]
+			n++
+		}
+		sf.smax[sfb] = max[n-1]
+	}
+	sf.s[12], sf.smax[12] = [3]int{}, sf.smax[11]
+}
+
+// readHuffman decodes the quantised spectral values of a granule and
+// channel, stopping at the bit position end
+func (d *layer3Decoder) readHuffman(g *mp3.GranuleInfo, bt *layer3.Bands, ch, end int) {
+	is := &d.is[ch]
+	bigEnd := g.BigValues * 2
+	if bigEnd > 576 {
+		bigEnd = 576
+	}
+
+	var r1, r2 int
+	if g.WindowSwitching && g.BlockType == 2 {
+		r1, r2 = 36, 576
+	} else {
+		r1 = bt.Long[clampBand(g.Region0Count+1)]
+		r2 = bt.Long[clampBand(g.Region0Count+g.Region1Count+2)]
+	}
+
+	for i := 0; i < bigEnd; i += 2 {
+		t := g.TableSelect[0]
+		switch {
+		case i >= r2:
+			t = g.TableSelect[2]
+		case i >= r1:
+			t = g.TableSelect[1]
+		}
+		is[i], is[i+1] = bigValueTables[t].pair(&d.br)
+	}
+
+	i := bigEnd
+	tree := count1Tables[g.Count1TableSelect]
+	var q [4]int
+	for i+4 <= 576 && d.br.Pos() < end {
+		tree.quad(&d.br, &q)
+		if d.br.Pos() > end {
+			break
+		}
+		copy(is[i:], q[:])
+		i += 4
+	}
+	d.nonzero[ch] = i
+	for ; i < 576; i++ {
+		is[i] = 0
+	}
+}
+
+func clampBand(i int) int {
+	if i > 22 {
+		return 22
+	}
+	return i
+}
+
+// requantize scales the quantised values of a granule and channel
+func (d *layer3Decoder) requantize(g *mp3.GranuleInfo, bt *layer3.Bands, ch int) {
+	is := &d.is[ch]
+	xr := &d.xr[ch]
+	sf := &d.scalefac[ch]
+	*xr = [576]float32{}
+	if d.nonzero[ch] == 0 {
+		return
+	}
+
+	gain := float64(g.GlobalGain-210) / 4
+	mult := 0.5
+	if g.ScalefacScale {
+		mult = 1
+	}
+
+	longBand := func(sfb int) {
+		sv := sf.l[sfb]
+		if g.Preflag {
+			sv += layer3.Pretab[sfb]
+		}
+		scale := float32(math.Exp2(gain - mult*float64(sv)))
+		for i := bt.Long[sfb]; i < bt.Long[sfb+1]; i++ {
+			xr[i] = scale * dequantize(is[i])
+		}
+	}
+	shortBands := func(from int) {
+		for sfb := from; sfb < 13; sfb++ {
+			width := bt.Short[sfb+1] - bt.Short[sfb]
+			start := bt.Short[sfb] * 3
+			for win := 0; win < 3; win++ {
+				scale := float32(math.Exp2(gain - 2*float64(g.SubblockGain[win]) - mult*float64(sf.s[sfb][win])))
+				for i := start + win*width; i < start+(win+1)*width; i++ {
+					xr[i] = scale * dequantize(is[i])
+				}
+			}
+		}
+	}
+
+	switch {
+	case !g.WindowSwitching || g.BlockType != 2:
+		for sfb := 0; sfb < 22; sfb++ {
+			longBand(sfb)
+		}
+	case g.MixedBlock:
+		longBands, shortStart := bt.MixedBounds()
+		for sfb := 0; sfb < longBands; sfb++ {
+			longBand(sfb)
+		}
+		shortBands(shortStart)
+	default:
+		shortBands(0)
+	}
+}
+
+func dequantize(v int) float32 {
+	switch {
+	case v == 0:
+		return 0
+	case v > 0:
+		if v >= len(pow43) {
+			v = len(pow43) - 1
+		}
+		return pow43[v]
+	default:
+		v = -v
+		if v >= len(pow43) {
+			v = len(pow43) - 1
+		}
+		return -pow43[v]
+	}
+}
+
+// stereo applies intensity and mid/side stereo processing. g is the side
+// info of the right channel.
+func (d *layer3Decoder) stereo(h mp3.FrameHeader, g *mp3.GranuleInfo, bt *layer3.Bands, mpeg1 bool) {
+	if h.ChannelMode() != mp3.JointStereo {
+		return
+	}
+	ext := h.ModeExtension()
+	d.isLine = [576]bool{}
+
+	if ext&1 != 0 {
+		d.intensity(g, bt, mpeg1)
+		if d.nonzero[0] > d.nonzero[1] {
+			d.nonzero[1] = d.nonzero[0]
+		}
+	}
+
+	if ext&2 != 0 {
+		n := d.nonzero[0]
+		if d.nonzero[1] > n {
+			n = d.nonzero[1]
+		}
+		l, r := &d.xr[0], &d.xr[1]
+		for i := 0; i < n; i++ {
+			if d.isLine[i] {
+				continue
+			}
+			m, s := l[i], r[i]
+			l[i] = (m + s) * math.Sqrt2 / 2
+			r[i] = (m - s) * math.Sqrt2 / 2
+		}
+		d.nonzero[0], d.nonzero[1] = n, n
+	}
+}
+
+// intensity applies intensity stereo above the last non zero line of the
+// right channel
+func (d *layer3Decoder) intensity(g *mp3.GranuleInfo, bt *layer3.Bands, mpeg1 bool) {
+	sf := &d.scalefac[1]
+	right := &d.is[1]
+	scale := g.ScalefacCompress & 1
+
+	longBands := func(limit int) {
+		last := d.nonzero[1] - 1
+		for last >= 0 && right[last] == 0 {
+			last--
+		}
+		sfb := 0
+		for sfb < limit && bt.Long[sfb] <= last {
+			sfb++
+		}
+		for ; sfb < limit; sfb++ {
+			pos := sfb
+			if pos > 20 {
+				pos = 20
+			}
+			d.intensityBand(bt.Long[sfb], bt.Long[sfb+1], sf.l[pos], sf.lmax[pos], scale, mpeg1)
+		}
+	}
+
+	if !g.WindowSwitching || g.BlockType != 2 {
+		longBands(22)
+		return
+	}
+
+	longLimit, shortStart := 0, 0
+	if g.MixedBlock {
+		longLimit, shortStart = bt.MixedBounds()
+	}
+	shortZero := true
+	for win := 0; win < 3; win++ {
+		last := -1
+		for sfb := shortStart; sfb < 13; sfb++ {
+			width := bt.Short[sfb+1] - bt.Short[sfb]
+			start := bt.Short[sfb]*3 + win*width
+			for i := start; i < start+width; i++ {
+				if right[i] != 0 {
+					last = sfb
+					break
+				}
+			}
+		}
+		sfb := shortStart
+		if last >= 0 {
+			shortZero = false
+			sfb = last + 1
+		}
+		for ; sfb < 13; sfb++ {
+			pos := sfb
+			if pos > 11 {
+				pos = 11
+			}
+			width := bt.Short[sfb+1] - bt.Short[sfb]
+			start := bt.Short[sfb]*3 + win*width
+			d.intensityBand(start, start+width, sf.s[pos][win], sf.smax[pos], scale, mpeg1)
+		}
+	}
+	if g.MixedBlock && shortZero {
+		longBands(longLimit)
+	}
+}
+
+// intensityBand derives both channels of lines start to end from the left
+// channel, using intensity position pos
+func (d *layer3Decoder) intensityBand(start, end, pos, max, scale int, mpeg1 bool) {
+	var kl, kr float32
+	if mpeg1 {
+		if pos >= len(isRatio) {
+			return
+		}
+		kl, kr = isRatio[pos][0], isRatio[pos][1]
+	} else {
+		if pos == max {
+			return
+		}
+		io := math.Exp2(-0.25 * float64(scale+1))
+		kl, kr = 1, 1
+		if pos&1 == 1 {
+			kl = float32(math.Pow(io, float64((pos+1)/2)))
+		} else {
+			kr = float32(math.Pow(io, float64(pos/2)))
+		}
+	}
+	l, r := &d.xr[0], &d.xr[1]
+	for i := start; i < end; i++ {
+		v := l[i]
+		l[i] = v * kl
+		r[i] = v * kr
+		d.isLine[i] = true
+	}
+}
+
+// reorder moves the lines of short blocks from window order into
+// frequency order, interleaving the three windows
+func (d *layer3Decoder) reorder(g *mp3.GranuleInfo, bt *layer3.Bands, ch int) {
+	if !g.WindowSwitching || g.BlockType != 2 {
+		return
+	}
+	start := 0
+	if g.MixedBlock {
+		_, start = bt.MixedBounds()
+	}
+	xr := &d.xr[ch]
+	var tmp [576]float32
+	for sfb := start; sfb < 13; sfb++ {
+		width := bt.Short[sfb+1] - bt.Short[sfb]
+		base := bt.Short[sfb] * 3
+		for win := 0; win < 3; win++ {
+			for j := 0; j < width; j++ {
+				tmp[base+3*j+win] = xr[base+win*width+j]
+			}
+		}
+		copy(xr[base:base+3*width], tmp[base:base+3*width])
+	}
+}
+
+// antialias applies the alias reduction butterflies between the subbands
+// of long blocks
+func (d *layer3Decoder) antialias(g *mp3.GranuleInfo, ch int) {
+	limit := 32
+	if g.WindowSwitching && g.BlockType == 2 {
+		if !g.MixedBlock {
+			return
+		}
+		limit = 2
+	}
+	xr := &d.xr[ch]
+	for sb := 1; sb < limit; sb++ {
+		for i := 0; i < 8; i++ {
+			lo, hi := sb*18-1-i, sb*18+i
+			bu, bd := xr[lo], xr[hi]
+			xr[lo] = bu*layer3.AliasCs[i] - bd*layer3.AliasCa[i]
+			xr[hi] = bd*layer3.AliasCs[i] + bu*layer3.AliasCa[i]
+		}
+	}
+}
+
+// hybrid runs the IMDCT, windowing and overlap-add for each subband, and
+// applies the frequency inversion ahead of the synthesis filterbank
+func (d *layer3Decoder) hybrid(g *mp3.GranuleInfo, ch int) {
+	xr := &d.xr[ch]
+	for sb := 0; sb < 32; sb++ {
+		block := g.BlockType
+		if g.MixedBlock && sb < 2 {
+			block = 0
+		}
+		x := xr[sb*18 : sb*18+18]
+		var raw [36]float32
+		if !allZero(x) {
+			if block == 2 {
+				imdctShortBlock(x, &raw)
+			} else {
+				imdctLongBlock(x, &raw, &layer3.Windows[block])
+			}
+		}
+		prev := &d.overlap[ch][sb]
+		for i := 0; i < 18; i++ {
+			x[i] = raw[i] + prev[i]
+			prev[i] = raw[i+18]
+		}
+		if sb&1 == 1 {
+			for i := 1; i < 18; i += 2 {
+				x[i] = -x[i]
+			}
+		}
+	}
+}
+
+func allZero(x []float32) bool {
+	for _, v := range x {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func imdctLongBlock(x []float32, out *[36]float32, win *[36]float32) {
+	for i := 0; i < 36; i++ {
+		var s float32
+		c := &imdctLong[i]
+		for k, v := range x {
+			s += v * c[k]
+		}
+		out[i] = s * win[i]
+	}
+}
+
+func imdctShortBlock(x []float32, out *[36]float32) {
+	for win := 0; win < 3; win++ {
+		for i := 0; i < 12; i++ {
+			var s float32
+			c := &imdctShort[i]
+			for k := 0; k < 6; k++ {
+				s += x[3*k+win] * c[k]
+			}
+			out[6+6*win+i] += s * layer3.Windows[2][i]
+		}
+	}
+}
+
+// subbandSynthesis runs the 18 time slots of a granule through the
+// synthesis filterbank, writing 576 samples to out
+func (d *layer3Decoder) subbandSynthesis(s *filterbank.Synthesis, ch int, out []float32) {
+	xr := &d.xr[ch]
+	var in [32]float32
+	for t := 0; t < 18; t++ {
+		for sb := 0; sb < 32; sb++ {
+			in[sb] = xr[sb*18+t]
+		}
+		s.Filter(&in, out[t*32:])
+	}
+}
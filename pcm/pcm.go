@@ -0,0 +1,135 @@
+// Package pcm decodes the frames of an mp3 stream into PCM audio. It is
+// written in pure Go, and is built on the frames produced by mp3.Decoder.
+package pcm
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/tcolgate/mp3"
+)
+
+// Format is the sample encoding produced by a Reader
+type Format int
+
+const (
+	// Int16 produces signed 16 bit little endian samples
+	Int16 Format = iota
+	// Float32 produces IEEE 754 32 bit little endian samples in the range
+	// [-1, 1]
+	Float32
+)
+
+// Size returns the size of one sample in bytes
+func (f Format) Size() int {
+	if f == Float32 {
+		return 4
+	}
+	return 2
+}
+
+// Reader reads interleaved PCM samples decoded from the frames of an
+// mp3.Decoder. Xing, Info and VBRI header frames are skipped.
+type Reader struct {
+	d      *mp3.Decoder
+	format Format
+	fd     FrameDecoder
+	f      mp3.Frame
+
+	buf      []byte
+	rate     int
+	channels int
+	err      error
+}
+
+// NewReader returns a Reader producing samples in the format f from the
+// frames of d
+func NewReader(d *mp3.Decoder, f Format) *Reader {
+	return &Reader{d: d, format: f}
+}
+
+// SampleRate returns the sample rate of the most recently decoded frame,
+// decoding the first frame if none has been read yet
+func (r *Reader) SampleRate() int {
+	if r.rate == 0 && r.err == nil {
+		r.fill()
+	}
+	return r.rate
+}
+
+// Channels returns the number of interleaved channels of the most recently
+// decoded frame, decoding the first frame if none has been read yet
+func (r *Reader) Channels() int {
+	if r.channels == 0 && r.err == nil {
+		r.fill()
+	}
+	return r.channels
+}
+
+// Read reads decoded samples into p. Only whole samples for every channel
+// are returned unless p is too small to hold them.
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// fill decodes the next audio frame into the buffer
+func (r *Reader) fill() {
+	var skipped int
+	for {
+		if err := r.d.Decode(&r.f, &skipped); err != nil {
+			r.err = err
+			return
+		}
+		if r.f.IsStreamInfo() {
+			continue
+		}
+		break
+	}
+
+	samples, err := r.fd.Decode(&r.f)
+	if err != nil && err != ErrMissingMainData && err != ErrBadFrame {
+		r.err = err
+		return
+	}
+	r.rate = int(r.f.Header().SampleRate())
+	r.channels = len(samples)
+
+	size := r.format.Size()
+	n := len(samples[0]) * len(samples) * size
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	r.buf = r.buf[:n]
+	off := 0
+	for i := range samples[0] {
+		for ch := range samples {
+			v := samples[ch][i]
+			if r.format == Float32 {
+				binary.LittleEndian.PutUint32(r.buf[off:], math.Float32bits(v))
+			} else {
+				binary.LittleEndian.PutUint16(r.buf[off:], uint16(toInt16(v)))
+			}
+			off += size
+		}
+	}
+}
+
+// toInt16 converts a sample to 16 bits, clipping it to range
+func toInt16(v float32) int16 {
+	s := math.Floor(float64(v)*32768 + 0.5)
+	switch {
+	case s > math.MaxInt16:
+		return math.MaxInt16
+	case s < math.MinInt16:
+		return math.MinInt16
+	}
+	return int16(s)
+}
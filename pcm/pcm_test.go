@@ -0,0 +1,280 @@
+package pcm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/tcolgate/mp3"
+	"github.com/tcolgate/mp3/internal/bits"
+	"github.com/tcolgate/mp3/internal/layer2"
+)
+
+// toneFrame builds a mono MPEG-1 Layer III frame, at 128kbps and 44.1kHz,
+// with a single non zero spectral line in each granule
+func toneFrame(line int) []byte {
+	w := bits.NewWriter(nil)
+	pairs := line/2 + 1
+	for i := 0; i < pairs-1; i++ {
+		w.Write(1, 1) // table 1, (0, 0)
+	}
+	if line&1 == 0 {
+		w.Write(1, 2) // table 1, (1, 0)
+	} else {
+		w.Write(1, 3) // table 1, (0, 1)
+	}
+	w.Write(0, 1) // sign
+	gran := w.Len()
+
+	si := bits.NewWriter(nil)
+	si.Write(0, 9) // main_data_begin
+	si.Write(0, 5) // private bits
+	si.Write(0, 4) // scfsi
+	for gr := 0; gr < 2; gr++ {
+		si.Write(uint32(gran), 12)
+		si.Write(uint32(pairs), 9)
+		si.Write(210, 8) // global_gain
+		si.Write(0, 4)   // scalefac_compress
+		si.Write(0, 1)   // window switching
+		for i := 0; i < 3; i++ {
+			si.Write(1, 5)
+		}
+		si.Write(15, 4) // region0_count
+		si.Write(7, 3)  // region1_count
+		si.Write(0, 3)  // preflag, scalefac_scale, count1table_select
+	}
+
+	b := []byte{0xFF, 0xFB, 0x90, 0xC0}
+	b = append(b, si.Bytes()...)
+	md := bits.NewWriter(nil)
+	for gr := 0; gr < 2; gr++ {
+		r := bits.NewReader(w.Bytes())
+		for i := 0; i < gran; i++ {
+			md.Write(r.Read(1), 1)
+		}
+	}
+	b = append(b, md.Bytes()...)
+	return append(b, make([]byte, 417-len(b))...)
+}
+
+func TestDecodeTone(t *testing.T) {
+	const line = 100
+	buf := &bytes.Buffer{}
+	for i := 0; i < 8; i++ {
+		buf.Write(toneFrame(line))
+	}
+
+	r := NewReader(mp3.NewDecoder(buf), Float32)
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if r.SampleRate() != 44100 || r.Channels() != 1 {
+		t.Fatalf("expected 44100Hz mono, got %vHz %v channels", r.SampleRate(), r.Channels())
+	}
+	if len(data) != 8*1152*4 {
+		t.Fatalf("expected %v bytes, got %v", 8*1152*4, len(data))
+	}
+
+	samples := make([]float64, len(data)/4)
+	for i := range samples {
+		samples[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:])))
+	}
+	samples = samples[2*1152:]
+
+	// The same line repeated in every granule alternates in phase, which
+	// moves its energy to the neighbouring whole line frequencies
+	power := func(l int) float64 {
+		w := 2 * math.Pi * float64(l) / 1152
+		var re, im float64
+		for i, s := range samples {
+			re += s * math.Cos(w*float64(i))
+			im += s * math.Sin(w*float64(i))
+		}
+		return re*re + im*im
+	}
+	tone := power(line)
+	for _, l := range []int{line - 20, line - 8, line - 3, line + 8, line + 20} {
+		if p := power(l); p*100 > tone {
+			t.Fatalf("expected energy at line %v, found %v at line %v against %v", line, p, l, tone)
+		}
+	}
+}
+
+// subbandFrame builds a mono MPEG-1 frame of layer 1 or 2, at 128kbps and
+// 48kHz, carrying a constant signal in a single subband
+func subbandFrame(layer mp3.FrameLayer, sb int) []byte {
+	w := bits.NewWriter(nil)
+	switch layer {
+	case mp3.Layer1:
+		w.Write(0xFFFF44C0, 32)
+		for i := 0; i < 32; i++ {
+			if i == sb {
+				w.Write(14, 4) // 15 bit samples
+			} else {
+				w.Write(0, 4)
+			}
+		}
+		w.Write(3, 6) // scalefactor 1.0
+		for s := 0; s < 12; s++ {
+			w.Write(1<<15-2, 15)
+		}
+		return append(w.Bytes(), make([]byte, 128-len(w.Bytes()))...)
+	default:
+		t := layer2.Select(false, 128, 48000)
+		w.Write(0xFFFD84C0, 32)
+		a := 1<<uint(t.NBal[sb]) - 1
+		q := layer2.QuantClasses[t.Class[sb][a-1]]
+		for i := 0; i < t.SBLimit; i++ {
+			if i == sb {
+				w.Write(uint32(a), t.NBal[i])
+			} else {
+				w.Write(0, t.NBal[i])
+			}
+		}
+		w.Write(2, 2) // scfsi, one scalefactor
+		w.Write(3, 6)
+		for s := 0; s < 36; s++ {
+			w.Write(uint32(q.Levels-1), q.Bits)
+		}
+		return append(w.Bytes(), make([]byte, 384-len(w.Bytes()))...)
+	}
+}
+
+func TestDecodeLayer12(t *testing.T) {
+	const sb = 2
+	for _, l := range []mp3.FrameLayer{mp3.Layer1, mp3.Layer2} {
+		buf := &bytes.Buffer{}
+		for i := 0; i < 4; i++ {
+			buf.Write(subbandFrame(l, sb))
+		}
+		r := NewReader(mp3.NewDecoder(buf), Float32)
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%v: unexpected error, %v", l, err)
+		}
+		n := 4 * 384
+		if l == mp3.Layer2 {
+			n = 4 * 1152
+		}
+		if len(data) != n*4 {
+			t.Fatalf("%v: expected %v bytes, got %v", l, n*4, len(data))
+		}
+
+		samples := make([]float64, n)
+		for i := range samples {
+			samples[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:])))
+		}
+		samples = samples[512:]
+
+		// A constant subband signal is repeated every 32 samples, its
+		// energy lies on multiples of fs/32 within the subband, which is
+		// the lower edge for subband 2
+		power := func(f float64) float64 {
+			w := 2 * math.Pi * f / 64
+			var re, im float64
+			for i, s := range samples {
+				re += s * math.Cos(w*float64(i))
+				im += s * math.Sin(w*float64(i))
+			}
+			return re*re + im*im
+		}
+		tone := power(sb)
+		for _, f := range []float64{sb - 2, sb + 2, sb + 6} {
+			if p := power(f); p*100 > tone {
+				t.Fatalf("%v: expected energy in subband %v, found %v in %v against %v", l, sb, p, f, tone)
+			}
+		}
+	}
+}
+
+func TestDecodeSilence(t *testing.T) {
+	buf := &bytes.Buffer{}
+	for i := 0; i < 4; i++ {
+		buf.Write(mp3.SilentBytes)
+	}
+
+	r := NewReader(mp3.NewDecoder(buf), Int16)
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if len(data) != 4*1152*2*2 {
+		t.Fatalf("expected %v bytes, got %v", 4*1152*2*2, len(data))
+	}
+	for i := 0; i < len(data); i += 2 {
+		if v := int16(binary.LittleEndian.Uint16(data[i:])); v > 1 || v < -1 {
+			t.Fatalf("expected silence, got sample %v at %v", v, i/2)
+		}
+	}
+}
+
+func TestDecodeLayer1At44100(t *testing.T) {
+	// at 44.1kHz Layer I frames are rounded down to a whole number of 4
+	// byte slots, and padded by a whole slot
+	for _, c := range []struct {
+		h        []byte
+		size, ch int
+	}{
+		{[]byte{0xFF, 0xFF, 0xC0, 0x00}, 416, 2}, // 384kbps stereo
+		{[]byte{0xFF, 0xFF, 0x10, 0xC0}, 32, 1},  // 32kbps mono
+	} {
+		buf := &bytes.Buffer{}
+		for i := 0; i < 6; i++ {
+			b := make([]byte, c.size)
+			copy(b, c.h)
+			if i%2 == 1 {
+				b[2] |= 0x02
+				b = append(b, 0, 0, 0, 0)
+			}
+			buf.Write(b)
+		}
+
+		r := NewReader(mp3.NewDecoder(buf), Int16)
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("% x: unexpected error, %v", c.h, err)
+		}
+		if n := 6 * 384 * c.ch * 2; len(data) != n {
+			t.Fatalf("% x: expected %v bytes, got %v", c.h, n, len(data))
+		}
+		for i := 0; i < len(data); i += 2 {
+			if v := int16(binary.LittleEndian.Uint16(data[i:])); v != 0 {
+				t.Fatalf("% x: expected silence, got sample %v at %v", c.h, v, i/2)
+			}
+		}
+	}
+}
+
+func TestDecodeGeneratedSilence(t *testing.T) {
+	for _, h := range []mp3.FrameHeader{
+		{0xFF, 0xFE, 0x20, 0x00},
+		{0xFF, 0xFC, 0x44, 0xC0},
+		{0xFF, 0xF3, 0x80, 0xC4},
+	} {
+		g, err := mp3.NewSilenceGenerator(h)
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		buf := &bytes.Buffer{}
+		fs, _ := g.Samples(4000)
+		for _, f := range fs {
+			buf.Write(f.Bytes())
+		}
+		r := NewReader(mp3.NewDecoder(buf), Int16)
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%x: unexpected error, %v", []byte(h), err)
+		}
+		if want := len(fs) * g.SamplesPerFrame() * r.Channels() * 2; len(data) != want {
+			t.Fatalf("%x: expected %v bytes, got %v", []byte(h), want, len(data))
+		}
+		for i := range data {
+			if data[i] != 0 {
+				t.Fatalf("%x: expected digital silence, got %x at %d", []byte(h), data[i], i)
+			}
+		}
+	}
+}
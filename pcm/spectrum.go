@@ -0,0 +1,82 @@
+package pcm
+
+import "github.com/tcolgate/mp3"
+
+type (
+	// Spectrum holds the frequency lines of a Layer III frame, after
+	// requantisation and stereo processing, but before the IMDCT and
+	// synthesis filterbank.
+	Spectrum struct {
+		// Granules is the number of granules present, 2 for MPEG-1 and 1
+		// for MPEG-2 and MPEG-2.5
+		Granules int
+		// Channels is the number of channels present
+		Channels int
+		// Granule holds the lines for each granule and channel
+		Granule [2][2]GranuleSpectrum
+	}
+
+	// GranuleSpectrum holds the 576 frequency lines of one granule and
+	// channel. For long blocks the lines are in increasing frequency. For
+	// short blocks the lines of each scalefactor band are grouped by window,
+	// the band's lines for window 0 followed by those for windows 1 and 2.
+	GranuleSpectrum struct {
+		Lines [576]float32
+		// BlockType is 0 for normal long blocks, 1 for start blocks, 2 for
+		// short blocks and 3 for stop blocks
+		BlockType int
+		// Mixed is set if the lowest two subbands use long blocks within a
+		// short block granule
+		Mixed bool
+	}
+
+	// SpectrumDecoder decodes Layer III frames as far as their frequency
+	// lines. This is much cheaper than a full decode, and suits spectral
+	// analysis. Like FrameDecoder, it keeps the bit reservoir between
+	// frames, so frames must be passed to it in stream order.
+	SpectrumDecoder struct {
+		l3 layer3Decoder
+		sp Spectrum
+	}
+)
+
+// Decode decodes the frequency lines of the Layer III frame f. The returned
+// Spectrum is reused by the next call to Decode. ErrMissingMainData is
+// returned, along with all zero lines, when the bit reservoir is incomplete.
+func (d *SpectrumDecoder) Decode(f *mp3.Frame) (*Spectrum, error) {
+	if f.Header().Layer() != mp3.Layer3 {
+		return nil, mp3.ErrNotLayer3
+	}
+	si, ok, err := d.l3.start(f)
+	if err != nil {
+		return nil, err
+	}
+
+	d.sp.Granules, d.sp.Channels = si.Granules, si.Channels
+	for gr := 0; gr < si.Granules; gr++ {
+		d.l3.granule(f.Header(), si, gr, ok)
+		for ch := 0; ch < si.Channels; ch++ {
+			g := &si.Granule[gr][ch]
+			gs := &d.sp.Granule[gr][ch]
+			gs.Lines = d.l3.xr[ch]
+			gs.BlockType = g.BlockType
+			gs.Mixed = g.MixedBlock
+		}
+	}
+
+	if !ok {
+		return &d.sp, ErrMissingMainData
+	}
+	return &d.sp, nil
+}
+
+// Reset discards the bit reservoir, it should be called after a seek
+func (d *SpectrumDecoder) Reset() {
+	d.l3.reset()
+}
+
+// Frequency returns the centre frequency, in Hz, of line i of a long block
+// at the given sample rate
+func Frequency(i, sampleRate int) float64 {
+	return (float64(i) + 0.5) * float64(sampleRate) / 1152
+}
@@ -0,0 +1,42 @@
+package pcm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tcolgate/mp3"
+)
+
+func TestSpectrumDecoder(t *testing.T) {
+	const line = 37
+	d := mp3.NewDecoder(bytes.NewReader(toneFrame(line)))
+	f := mp3.Frame{}
+	skipped := 0
+	if err := d.Decode(&f, &skipped); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+
+	sd := SpectrumDecoder{}
+	sp, err := sd.Decode(&f)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if sp.Granules != 2 || sp.Channels != 1 {
+		t.Fatalf("expected 2 granules of 1 channel, got %v of %v", sp.Granules, sp.Channels)
+	}
+	for gr := 0; gr < 2; gr++ {
+		g := sp.Granule[gr][0]
+		if g.BlockType != 0 || g.Mixed {
+			t.Fatalf("expected long blocks, got type %v", g.BlockType)
+		}
+		for i, v := range g.Lines {
+			want := float32(0)
+			if i == line {
+				want = 1
+			}
+			if v != want {
+				t.Fatalf("granule %v line %v: expected %v, got %v", gr, i, want, v)
+			}
+		}
+	}
+}
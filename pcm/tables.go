@@ -0,0 +1,39 @@
+package pcm
+
+import "math"
+
+var (
+	// pow43 holds |i|^(4/3) for every legal quantised value
+	pow43 [8207]float32
+
+	// imdctLong and imdctShort hold the IMDCT cosine terms
+	imdctLong  [36][18]float32
+	imdctShort [12][6]float32
+
+	// isRatio holds the MPEG-1 intensity stereo left and right factors for
+	// each legal intensity position
+	isRatio [7][2]float32
+)
+
+func init() {
+	for i := range pow43 {
+		pow43[i] = float32(math.Pow(float64(i), 4.0/3.0))
+	}
+
+	for i := 0; i < 36; i++ {
+		for k := 0; k < 18; k++ {
+			imdctLong[i][k] = float32(math.Cos(math.Pi / 72 * float64((2*i+1+18)*(2*k+1))))
+		}
+	}
+	for i := 0; i < 12; i++ {
+		for k := 0; k < 6; k++ {
+			imdctShort[i][k] = float32(math.Cos(math.Pi / 24 * float64((2*i+1+6)*(2*k+1))))
+		}
+	}
+
+	for i := range isRatio {
+		s, c := math.Sincos(float64(i) * math.Pi / 12)
+		isRatio[i][0] = float32(s / (s + c))
+		isRatio[i][1] = float32(c / (s + c))
+	}
+}
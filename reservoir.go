@@ -0,0 +1,109 @@
+package mp3
+
+import "errors"
+
+// maxMainDataBegin is the largest main_data_begin that can be signalled,
+// using the 9 bit MPEG-1 field
+const maxMainDataBegin = 511
+
+// ErrMissingMainData indicates that the main data of a frame begins in
+// earlier frames that were not seen, as happens at the start of a stream,
+// after a seek, or after joining two streams.
+var ErrMissingMainData = errors.New("main data begins before the first frame seen")
+
+// Reservoir reassembles the logical main data of consecutive Layer III
+// frames. The main data of a frame may begin up to 511 bytes back, in the
+// main data of earlier frames, as given by the main_data_begin field of the
+// side info. The zero value is ready for use.
+type Reservoir struct {
+	buf  []byte // trailing main data of previous frames
+	main []byte
+}
+
+// Add adds the main data of frame f to the reservoir, and returns the
+// complete main data of f. Frames must be added in stream order. If the
+// reservoir does not hold the bytes needed from earlier frames, only the
+// main data carried by f itself is returned, along with ErrMissingMainData.
+// The returned slice is only valid until the next call to Add.
+func (r *Reservoir) Add(f *Frame) ([]byte, error) {
+	si, err := f.ParseSideInfo()
+	if err != nil {
+		return nil, err
+	}
+	data := f.MainData()
+
+	err = nil
+	r.main = r.main[:0]
+	if begin := si.MainDataBegin; begin <= len(r.buf) {
+		r.main = append(r.main, r.buf[len(r.buf)-begin:]...)
+	} else {
+		err = ErrMissingMainData
+	}
+	r.main = append(r.main, data...)
+
+	r.buf = append(r.buf, data...)
+	if n := len(r.buf); n > maxMainDataBegin {
+		copy(r.buf, r.buf[n-maxMainDataBegin:])
+		r.buf = r.buf[:maxMainDataBegin]
+	}
+	return r.main, err
+}
+
+// Len returns the number of bytes held from earlier frames, and so the
+// largest main_data_begin the next frame can use
+func (r *Reservoir) Len() int {
+	return len(r.buf)
+}
+
+// Reset empties the reservoir. It should be called whenever the frames
+// being added stop being contiguous, after a seek for instance.
+func (r *Reservoir) Reset() {
+	r.buf = r.buf[:0]
+}
+
+// reservoirNeed returns the number of bytes of main data from before the
+// first of the consecutive Layer III frames fs that they refer back to
+func reservoirNeed(fs []*Frame) int {
+	need, avail := 0, 0
+	for _, f := range fs {
+		if si, err := f.ParseSideInfo(); err == nil && si.MainDataBegin-avail > need {
+			need = si.MainDataBegin - avail
+		}
+		avail += len(f.MainData())
+	}
+	return need
+}
+
+// reservoirFrame builds a silent Layer III frame, in the format of header h,
+// whose main data ends with data, so that a following frame can take data
+// from the bit reservoir. The smallest bit rate with room for data is used.
+func reservoirFrame(h FrameHeader, data []byte) (*Frame, error) {
+	t := FrameHeader{h[0], h[1], h[2] &^ 0x02, h[3]}
+	f := &Frame{buf: t}
+	sil, err := f.SideInfoLength()
+	if err != nil {
+		return nil, err
+	}
+	off := 4 + sil
+	if t.Protection() {
+		off += 2
+	}
+	t[2] = t[2]&0x0F | 1<<4
+	for f.Size() < off+len(data) {
+		if t[2]>>4 == 14 {
+			return nil, ErrFrameSize
+		}
+		t[2] += 1 << 4
+	}
+
+	f.buf = append(f.buf, make([]byte, f.Size()-4)...)
+	copy(f.buf[len(f.buf)-len(data):], data)
+	if t.Protection() {
+		crc, err := f.ComputeCRC()
+		if err != nil {
+			return nil, err
+		}
+		f.buf[4], f.buf[5] = byte(crc>>8), byte(crc)
+	}
+	return f, nil
+}
@@ -0,0 +1,55 @@
+package mp3
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tcolgate/mp3/internal/bits"
+)
+
+// silentFrameBegin returns a copy of the silent frame with main_data_begin
+// set to begin, and distinct main data bytes
+func silentFrameBegin(begin int, fill byte) *Frame {
+	b := append([]byte{}, SilentBytes...)
+	bits.Put(b, 32, uint32(begin), 9)
+	f := &Frame{buf: b}
+	md := f.MainData()
+	for i := range md {
+		md[i] = fill
+	}
+	return f
+}
+
+func TestReservoir(t *testing.T) {
+	r := Reservoir{}
+	first := silentFrameBegin(0, 1)
+	data, err := r.Add(first)
+	if err != nil || !bytes.Equal(data, first.MainData()) {
+		t.Fatalf("expected first frame main data, got err %v", err)
+	}
+
+	second := silentFrameBegin(10, 2)
+	data, err = r.Add(second)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if len(data) != 10+len(second.MainData()) || data[9] != 1 || data[10] != 2 {
+		t.Fatalf("expected 10 bytes of earlier main data, got %v bytes", len(data))
+	}
+
+	for i := 0; i < 4; i++ {
+		r.Add(silentFrameBegin(0, 3))
+	}
+	if r.Len() != 511 {
+		t.Fatalf("expected reservoir of 511 bytes, got %v", r.Len())
+	}
+
+	r.Reset()
+	data, err = r.Add(second)
+	if err != ErrMissingMainData {
+		t.Fatalf("expected ErrMissingMainData, got %v", err)
+	}
+	if !bytes.Equal(data, second.MainData()) {
+		t.Fatalf("expected only the frame's own main data")
+	}
+}
@@ -0,0 +1,448 @@
+package mp3
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"time"
+)
+
+// SeekDecoder is a Decoder over an io.ReadSeeker that can seek to a
+// playing time.
+type SeekDecoder struct {
+	*Decoder
+	rs   io.ReadSeeker
+	opts []DecoderOption
+
+	start      int64      // offset of the first frame
+	audioStart int64      // offset of the first audio frame
+	end        int64      // length of the source
+	info       StreamInfo // header found in the first frame, if any
+	first      Frame      // the first audio frame
+	frameDur   time.Duration
+	vbr        bool
+
+	profile []ratePoint // bitrate samples used for untagged VBR streams
+	marks   []seekMark  // frames of untagged VBR streams whose position is known
+}
+
+type (
+	// ratePoint is a sample of the local byte rate of a VBR stream
+	ratePoint struct {
+		off  int64
+		rate float64 // bytes per second
+	}
+
+	// seekMark records the first sample of the audio frame at off
+	seekMark struct {
+		off    int64
+		sample int64
+	}
+)
+
+const (
+	// seekCheckFrames is the number of consecutive frames that must be
+	// found after a seek before a header is accepted
+	seekCheckFrames = 3
+	// seekMaxResync bounds the number of candidate headers tried while
+	// resynchronising after a seek
+	seekMaxResync = 64
+	// seekProbes is the number of points sampled across an untagged VBR
+	// stream to estimate its bitrate profile
+	seekProbes = 16
+	// seekProbeFrames is the number of frames measured at each probe
+	seekProbeFrames = 8
+	// seekMarkFrames is the number of frames between the positions kept
+	// while walking an untagged VBR stream
+	seekMarkFrames = 64
+	// seekMaxSteps bounds the bisection of an untagged VBR stream
+	seekMaxSteps = 32
+)
+
+var (
+	// ErrNoFrames indicates that no audio frames were found in the stream
+	ErrNoFrames = errors.New("no frames found")
+
+	// ErrResync indicates that no valid frame header could be found after
+	// seeking
+	ErrResync = errors.New("could not resynchronise after seek")
+)
+
+// NewSeekDecoder returns a decoder for rs, starting at its current position.
+// The first frames of the stream are read to find any Xing, Info or VBRI
+// header, and the decoder is then left positioned at the first frame.
+func NewSeekDecoder(rs io.ReadSeeker, opts ...DecoderOption) (*SeekDecoder, error) {
+	base, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	d := &SeekDecoder{rs: rs, opts: opts, end: end}
+	if err := d.reset(base); err != nil {
+		return nil, err
+	}
+
+	skipped := 0
+	if err := d.Decode(&d.first, &skipped); err != nil {
+		if err == io.EOF || err == ErrNoSyncBits {
+			return nil, ErrNoFrames
+		}
+		return nil, err
+	}
+	d.start = d.Pos() - int64(len(d.first.buf))
+	d.audioStart = d.start
+	if info, err := d.first.StreamInfo(); err == nil {
+		d.info = info
+		d.audioStart = d.Pos()
+		if err := d.Decode(&d.first, &skipped); err != nil {
+			return nil, ErrNoFrames
+		}
+	}
+	d.frameDur = d.first.Duration()
+
+	// a short run of differing bitrates marks an untagged stream as VBR
+	if err := d.probe(d.Pos()); err != nil {
+		return nil, err
+	}
+	var f Frame
+	for i := 0; i < seekProbeFrames; i++ {
+		if err := d.Decode(&f, &skipped); err != nil {
+			break
+		}
+		if f.BitRate() != d.first.BitRate() {
+			d.vbr = true
+			break
+		}
+	}
+
+	return d, d.reset(d.start)
+}
+
+// reset repositions the source and clears the decoder state
+func (d *SeekDecoder) reset(off int64) error {
+	return d.position(off, d.opts...)
+}
+
+// probe repositions the source for internal reads, without any of the
+// caller's options, so tag handlers are not invoked
+func (d *SeekDecoder) probe(off int64) error {
+	return d.position(off)
+}
+
+func (d *SeekDecoder) position(off int64, opts ...DecoderOption) error {
+	if _, err := d.rs.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	nd := NewDecoder(d.rs, opts...)
+	nd.src.pos = off
+	if d.Decoder != nil {
+		// the length of free format frames need not be found again
+		nd.free, nd.freeHeader = d.free, d.freeHeader
+	}
+	d.Decoder = nd
+	return nil
+}
+
+// StreamInfo returns the Xing, Info or VBRI header found in the first frame,
+// or nil if there was none
+func (d *SeekDecoder) StreamInfo() StreamInfo {
+	return d.info
+}
+
+// Duration returns the playing time of the stream. It is exact when the
+// stream carries a header with a frame count, and estimated otherwise, from
+// the bitrate of CBR streams or the sampled bitrates of VBR streams.
+func (d *SeekDecoder) Duration() time.Duration {
+	if d.info != nil && d.info.Duration() > 0 {
+		return d.info.Duration()
+	}
+	if d.vbr {
+		if err := d.sampleRates(); err != nil {
+			return 0
+		}
+		return d.estimateTime(d.end)
+	}
+	return d.cbrTime(d.end)
+}
+
+// SeekTime positions the decoder so that the next call to Decode returns
+// the frame playing at time t. It returns the start time and byte offset of
+// the frame actually reached. The offset is always that of a frame header
+// followed by further frames of the stream.
+//
+// CBR streams are seeked directly, and VBR streams through the TOC of their
+// stream header. The frames of VBR streams with no TOC can only be timed by
+// counting them, so the stream is bisected: the frame at the middle of the
+// range left is found and timed by counting frames from the nearest
+// position already known, until the range is small enough to walk. The
+// positions found are kept, so later seeks read less of the stream.
+//
+// io.EOF is returned if t is at or past the end of the stream.
+func (d *SeekDecoder) SeekTime(t time.Duration) (time.Duration, int64, error) {
+	if t <= 0 {
+		return 0, d.audioStart, d.reset(d.audioStart)
+	}
+	if d.info != nil && d.info.Duration() > 0 && t >= d.info.Duration() {
+		return 0, 0, io.EOF
+	}
+
+	var target int64
+	var toTime func(off int64) time.Duration
+	switch {
+	case d.info != nil && d.hasTOC():
+		off, _ := d.info.SeekOffset(t)
+		target = d.start + off
+		toTime = d.tocTime
+	case !d.vbr:
+		n := int64(t / d.frameDur)
+		target = d.audioStart + int64(float64(n)*d.avgFrameSize())
+		toTime = d.cbrTime
+	default:
+		return d.seekVBR(t)
+	}
+
+	// land on the frame nearest the target, rather than the one after it
+	target -= int64(d.avgFrameSize() / 2)
+	if target < d.audioStart {
+		target = d.audioStart
+	}
+	off, err := d.resync(target)
+	if err != nil {
+		return 0, 0, err
+	}
+	return toTime(off), off, d.reset(off)
+}
+
+// hasTOC reports whether the stream header provides seek offsets
+func (d *SeekDecoder) hasTOC() bool {
+	_, ok := d.info.SeekOffset(0)
+	return ok
+}
+
+// avgFrameSize is the mean frame length of a CBR stream, accounting for
+// padding
+func (d *SeekDecoder) avgFrameSize() float64 {
+	h := d.first.Header()
+	return float64(d.first.Samples()) / 8 * float64(d.first.BitRate()) / float64(h.SampleRate())
+}
+
+// cbrTime returns the start time of the frame at off in a CBR stream
+func (d *SeekDecoder) cbrTime(off int64) time.Duration {
+	n := float64(off-d.audioStart) / d.avgFrameSize()
+	return time.Duration(int64(n+0.5)) * d.frameDur
+}
+
+// tocTime inverts the stream header TOC to find the time at off, rounded to
+// a frame boundary
+func (d *SeekDecoder) tocTime(off int64) time.Duration {
+	rel := off - d.start
+	total := d.info.Duration()
+	i := sort.Search(1024, func(i int) bool {
+		o, _ := d.info.SeekOffset(total * time.Duration(i) / 1024)
+		return o >= rel
+	})
+	lo := total * time.Duration(i-1) / 1024
+	hi := total * time.Duration(i) / 1024
+	if i == 0 {
+		lo = 0
+	}
+	for hi-lo > d.frameDur/4 {
+		mid := (lo + hi) / 2
+		if o, _ := d.info.SeekOffset(mid); o >= rel {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return (hi + d.frameDur/2) / d.frameDur * d.frameDur
+}
+
+// resync finds the first frame at or after off that is followed by
+// seekCheckFrames consistent frames, returning its offset
+func (d *SeekDecoder) resync(off int64) (int64, error) {
+	skipped := 0
+	var f Frame
+	for try := 0; try < seekMaxResync; try++ {
+		if err := d.probe(off); err != nil {
+			return 0, err
+		}
+		if err := d.Decode(&f, &skipped); err != nil {
+			if err == io.EOF || err == ErrNoSyncBits || err == ErrPrematureEOF {
+				return 0, io.EOF
+			}
+			return 0, ErrResync
+		}
+		cand := d.Pos() - int64(len(f.buf))
+		h := append(FrameHeader(nil), f.buf[:4]...)
+
+		ok := true
+		for i := 0; i < seekCheckFrames; i++ {
+			err := d.Decode(&f, &skipped)
+			if err == io.EOF || err == ErrNoSyncBits {
+				break
+			}
+			if err != nil || skipped != 0 || !sameStream(h, f.Header()) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return cand, nil
+		}
+		off = cand + 1
+	}
+	return 0, ErrResync
+}
+
+// sameStream reports whether two headers could belong to the same stream
+func sameStream(a, b FrameHeader) bool {
+	return a.Version() == b.Version() &&
+		a.Layer() == b.Layer() &&
+		a.SampleRate() == b.SampleRate() &&
+		(a.ChannelMode() == SingleChannel) == (b.ChannelMode() == SingleChannel)
+}
+
+// sampleRates samples the bitrate at evenly spaced points of an untagged VBR
+// stream, to estimate its duration
+func (d *SeekDecoder) sampleRates() error {
+	if d.profile != nil {
+		return nil
+	}
+	span := d.end - d.audioStart
+	skipped := 0
+	var f Frame
+	for i := 0; i < seekProbes; i++ {
+		off, err := d.resync(d.audioStart + span*int64(i)/seekProbes)
+		if err != nil {
+			continue
+		}
+		if err := d.probe(off); err != nil {
+			return err
+		}
+		var bytes int64
+		var dur time.Duration
+		for n := 0; n < seekProbeFrames; n++ {
+			if err := d.Decode(&f, &skipped); err != nil {
+				break
+			}
+			bytes += int64(len(f.buf))
+			dur += f.Duration()
+		}
+		if dur > 0 {
+			d.profile = append(d.profile, ratePoint{off, float64(bytes) / dur.Seconds()})
+		}
+	}
+	if len(d.profile) == 0 {
+		return ErrNoFrames
+	}
+	return nil
+}
+
+// estimateTime estimates the time at off from the sampled bitrates
+func (d *SeekDecoder) estimateTime(off int64) time.Duration {
+	var secs float64
+	pos := d.audioStart
+	for i, p := range d.profile {
+		next := d.end
+		if i+1 < len(d.profile) {
+			next = d.profile[i+1].off
+		}
+		if off < next {
+			next = off
+		}
+		if next > pos {
+			secs += float64(next-pos) / p.rate
+			pos = next
+		}
+	}
+	t := time.Duration(secs * float64(time.Second))
+	return (t + d.frameDur/2) / d.frameDur * d.frameDur
+}
+
+// seekVBR positions an untagged VBR stream at the frame playing at t
+func (d *SeekDecoder) seekVBR(t time.Duration) (time.Duration, int64, error) {
+	rate := int(d.first.Header().SampleRate())
+	s := durationSamples(t, rate)
+	if d.marks == nil {
+		d.marks = []seekMark{{d.audioStart, 0}}
+	}
+
+	// bisect until the frame is near enough to walk to
+	lo, hi := d.marks[0], d.end
+	near := seekMarkFrames * int64(d.avgFrameSize())
+	for i := 0; i < seekMaxSteps && hi-lo.off > near; i++ {
+		mid := (lo.off + hi) / 2
+		m, err := d.walk(d.markBefore(mid), func(m seekMark, _ *Frame) bool {
+			return m.off >= mid
+		})
+		switch {
+		case err != nil && err != io.EOF:
+			return 0, 0, err
+		case err == nil && m.sample <= s:
+			lo = m
+		default:
+			// no frame starting from mid on plays at t
+			hi = mid
+		}
+	}
+
+	m, err := d.walk(d.markBefore(lo.off), func(m seekMark, f *Frame) bool {
+		return m.sample+int64(f.Samples()) > s
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return samplesDuration(m.sample, rate), m.off, d.reset(m.off)
+}
+
+// markBefore returns the last known frame position at or before off
+func (d *SeekDecoder) markBefore(off int64) seekMark {
+	i := sort.Search(len(d.marks), func(i int) bool {
+		return d.marks[i].off > off
+	})
+	return d.marks[i-1]
+}
+
+// walk reads the frames of the stream from the known position m until stop
+// returns true for one, and returns its position. io.EOF is returned if the
+// stream ends first. Every seekMarkFrames frame positions are kept.
+func (d *SeekDecoder) walk(m seekMark, stop func(seekMark, *Frame) bool) (seekMark, error) {
+	if err := d.probe(m.off); err != nil {
+		return m, err
+	}
+	skipped := 0
+	var f Frame
+	for n := 0; ; n++ {
+		err := d.Decode(&f, &skipped)
+		if err == io.EOF || err == ErrNoSyncBits || err == ErrPrematureEOF {
+			return m, io.EOF
+		}
+		if err != nil && err != ErrCRCMismatch {
+			return m, err
+		}
+		m.off = d.Pos() - int64(len(f.buf))
+		if n > 0 && n%seekMarkFrames == 0 {
+			d.mark(m)
+		}
+		if stop(m, &f) {
+			return m, nil
+		}
+		m.sample += int64(f.Samples())
+	}
+}
+
+// mark keeps the frame position m, in order of offset
+func (d *SeekDecoder) mark(m seekMark) {
+	i := sort.Search(len(d.marks), func(i int) bool {
+		return d.marks[i].off >= m.off
+	})
+	if i < len(d.marks) && d.marks[i].off == m.off {
+		return
+	}
+	d.marks = append(d.marks, seekMark{})
+	copy(d.marks[i+1:], d.marks[i:])
+	d.marks[i] = m
+}
@@ -0,0 +1,83 @@
+package mp3
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// silentFrameAt returns a silent frame like SilentBytes at a different
+// MPEG-1 Layer III bitrate index
+func silentFrameAt(bitrateIdx byte) []byte {
+	h := append([]byte{}, SilentBytes[:4]...)
+	h[2] = bitrateIdx<<4 | h[2]&0x0F
+	f := Frame{buf: h}
+	b := make([]byte, f.Size())
+	copy(b, h)
+	return b
+}
+
+func TestSeekTimeCBR(t *testing.T) {
+	src := bytes.Repeat(SilentBytes, 100)
+	d, err := NewSeekDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	frameDur := SilentFrame.Duration()
+	if want := 100 * frameDur; d.Duration() != want {
+		t.Errorf("expected duration %v, got %v", want, d.Duration())
+	}
+
+	got, off, err := d.SeekTime(time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	n := int64(time.Second / frameDur)
+	if off != n*int64(len(SilentBytes)) || got != time.Duration(n)*frameDur {
+		t.Errorf("expected frame %d, got offset %d time %v", n, off, got)
+	}
+
+	f := Frame{}
+	skipped := 0
+	if err := d.Decode(&f, &skipped); err != nil || skipped != 0 {
+		t.Fatalf("expected frame after seek, got %v, skipped %d", err, skipped)
+	}
+
+	if _, _, err := d.SeekTime(3 * time.Second); err != io.EOF {
+		t.Errorf("expected io.EOF past the end, got %v", err)
+	}
+}
+
+func TestSeekTimeVBR(t *testing.T) {
+	var src []byte
+	var offsets []int64
+	for i := 0; i < 1000; i++ {
+		offsets = append(offsets, int64(len(src)))
+		if i%3 == 0 {
+			src = append(src, silentFrameAt(9)...)
+		} else {
+			src = append(src, silentFrameAt(11)...)
+		}
+	}
+	d, err := NewSeekDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+
+	// later seeks start from the positions found by earlier ones
+	for _, target := range []time.Duration{20 * time.Second, 2 * time.Second, 21 * time.Second} {
+		got, off, err := d.SeekTime(target)
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		n := durationSamples(target, 44100) / 1152
+		if off != offsets[n] || got != samplesDuration(n*1152, 44100) {
+			t.Errorf("seek to %v: expected frame %d at %d, got offset %d time %v", target, n, offsets[n], off, got)
+		}
+	}
+
+	if _, _, err := d.SeekTime(27 * time.Second); err != io.EOF {
+		t.Errorf("expected io.EOF past the end, got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package mp3
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tcolgate/mp3/internal/bits"
+)
+
+type (
+	// Layer3SideInfo is the decoded side information of a Layer III frame.
+	// MPEG-1 frames carry two granules, MPEG-2 and MPEG-2.5 frames carry one.
+	Layer3SideInfo struct {
+		// MainDataBegin is the negative offset, in bytes, from the first byte
+		// of the frame header at which the main data for this frame begins
+		MainDataBegin int
+		// PrivateBits holds the private bits, 1 to 5 depending on the layout
+		PrivateBits int
+		// Scfsi holds the scalefactor selection information for each channel
+		// and scalefactor band group. It is only present in MPEG-1.
+		Scfsi [2][4]bool
+
+		// Granules is the number of granules present, 1 or 2
+		Granules int
+		// Channels is the number of channels present, 1 or 2
+		Channels int
+
+		// Granule holds the per granule, per channel, information
+		Granule [2][2]GranuleInfo
+	}
+
+	// GranuleInfo holds the side information for one channel of one granule
+	GranuleInfo struct {
+		Part2_3Length    int
+		BigValues        int
+		GlobalGain       int
+		ScalefacCompress int
+		WindowSwitching  bool
+		BlockType        int
+		MixedBlock       bool
+		TableSelect      [3]int
+		SubblockGain     [3]int
+		// Region0Count and Region1Count are derived from the block type when
+		// window switching is set
+		Region0Count      int
+		Region1Count      int
+		Preflag           bool
+		ScalefacScale     bool
+		Count1TableSelect int
+	}
+)
+
+var (
+	// ErrNotLayer3 indicates that side info parsing was attempted on a frame
+	// that is not Layer III
+	ErrNotLayer3 = errors.New("frame is not Layer III")
+
+	// ErrShortSideInfo indicates that the frame is too short to contain the
+	// side info for its layout
+	ErrShortSideInfo = errors.New("side info truncated")
+)
+
+// ParseSideInfo decodes the Layer III side information of the frame
+func (f *Frame) ParseSideInfo() (*Layer3SideInfo, error) {
+	return f.SideInfo().Parse(f.Header())
+}
+
+// Parse decodes the side information according to the layout given by the
+// frame header h
+func (i FrameSideInfo) Parse(h FrameHeader) (*Layer3SideInfo, error) {
+	if h.Layer() != Layer3 {
+		return nil, ErrNotLayer3
+	}
+
+	mpeg1 := h.Version() == MPEG1
+	nch := 2
+	if h.ChannelMode() == SingleChannel {
+		nch = 1
+	}
+
+	sil, err := (&Frame{buf: h}).SideInfoLength()
+	if err != nil {
+		return nil, err
+	}
+	if len(i) < sil {
+		return nil, ErrShortSideInfo
+	}
+
+	si := &Layer3SideInfo{Channels: nch}
+	r := bits.NewReader(i[:sil])
+	if mpeg1 {
+		si.Granules = 2
+		si.MainDataBegin = int(r.Read(9))
+		if nch == 1 {
+			si.PrivateBits = int(r.Read(5))
+		} else {
+			si.PrivateBits = int(r.Read(3))
+		}
+		for ch := 0; ch < nch; ch++ {
+			for band := 0; band < 4; band++ {
+				si.Scfsi[ch][band] = r.Bit()
+			}
+		}
+	} else {
+		si.Granules = 1
+		si.MainDataBegin = int(r.Read(8))
+		if nch == 1 {
+			si.PrivateBits = int(r.Read(1))
+		} else {
+			si.PrivateBits = int(r.Read(2))
+		}
+	}
+
+	for gr := 0; gr < si.Granules; gr++ {
+		for ch := 0; ch < nch; ch++ {
+			g := &si.Granule[gr][ch]
+			g.Part2_3Length = int(r.Read(12))
+			g.BigValues = int(r.Read(9))
+			g.GlobalGain = int(r.Read(8))
+			if mpeg1 {
+				g.ScalefacCompress = int(r.Read(4))
+			} else {
+				g.ScalefacCompress = int(r.Read(9))
+			}
+			g.WindowSwitching = r.Bit()
+			if g.WindowSwitching {
+				g.BlockType = int(r.Read(2))
+				g.MixedBlock = r.Bit()
+				for reg := 0; reg < 2; reg++ {
+					g.TableSelect[reg] = int(r.Read(5))
+				}
+				for win := 0; win < 3; win++ {
+					g.SubblockGain[win] = int(r.Read(3))
+				}
+				if g.BlockType == 2 && !g.MixedBlock {
+					g.Region0Count = 8
+				} else {
+					g.Region0Count = 7
+				}
+				g.Region1Count = 36
+			} else {
+				for reg := 0; reg < 3; reg++ {
+					g.TableSelect[reg] = int(r.Read(5))
+				}
+				g.Region0Count = int(r.Read(4))
+				g.Region1Count = int(r.Read(3))
+			}
+			if mpeg1 {
+				g.Preflag = r.Bit()
+			}
+			g.ScalefacScale = r.Bit()
+			g.Count1TableSelect = int(r.Read(1))
+		}
+	}
+
+	return si, r.Err()
+}
+
+// GlobalGainPos returns the bit position, within the side info, of the
+// 8 bit global_gain field of granule gr and channel ch. Changing the field
+// scales the decoded granule by 2^(1/4), about 1.5dB, per step.
+func (si *Layer3SideInfo) GlobalGainPos(gr, ch int) int {
+	// the fixed fields ahead of the granules, and the length of each
+	// granule, differ between MPEG-1 and the later versions
+	pos, size := 8+si.Channels, 63
+	if si.Granules == 2 {
+		pos, size = 9+5+4*si.Channels, 59
+		if si.Channels == 2 {
+			pos -= 2
+		}
+	}
+	return pos + (gr*si.Channels+ch)*size + 12 + 9
+}
+
+// MainData returns the Layer III main data bytes carried by this frame, those
+// following the header, CRC and side info. The main data of a frame may
+// start in earlier frames, see Layer3SideInfo.MainDataBegin.
+func (f *Frame) MainData() []byte {
+	off := 4
+	if f.Header().Protection() {
+		off += 2
+	}
+	sil, err := f.SideInfoLength()
+	if err != nil || off+sil > len(f.buf) {
+		return nil
+	}
+	return f.buf[off+sil:]
+}
+
+// String renders the side info as a string for display purposes
+func (si *Layer3SideInfo) String() string {
+	str := ""
+	str += fmt.Sprintf(" MainDataBegin: %v\n", si.MainDataBegin)
+	str += fmt.Sprintf(" PrivateBits: %v\n", si.PrivateBits)
+	for ch := 0; ch < si.Channels; ch++ {
+		str += fmt.Sprintf(" Scfsi[%d]: %v\n", ch, si.Scfsi[ch])
+	}
+	for gr := 0; gr < si.Granules; gr++ {
+		for ch := 0; ch < si.Channels; ch++ {
+			str += fmt.Sprintf(" Granule[%d][%d]: %+v\n", gr, ch, si.Granule[gr][ch])
+		}
+	}
+	return str
+}
@@ -3,6 +3,7 @@ package mp3
 import (
 	"bytes"
 	"io"
+	"time"
 
 	"github.com/tcolgate/mp3/internal/data"
 )
@@ -49,3 +50,123 @@ func (s *silenceReader) Read(out []byte) (int, error) {
 func MakeSilence() io.ReadCloser {
 	return &silenceReader{0}
 }
+
+// SilenceGenerator synthesises frames of digital silence in the format of a
+// template frame header, so that silence can be spliced into any stream
+// without a change of format. Padded frames are produced as needed to hold
+// the bit rate of the header.
+type SilenceGenerator struct {
+	h    FrameHeader
+	rest int // remainder of the padding accumulator
+	buf  []byte
+}
+
+// NewSilenceGenerator returns a SilenceGenerator producing frames with the
+// version, layer, bit rate, sample rate, channel mode and flags of the
+// header h. The padding bit of h is ignored. If h is protected, each frame
+// carries a valid CRC. ErrFrameSize is returned if frames in the format of h
+// are too short to hold their side info or bit allocation.
+func NewSilenceGenerator(h FrameHeader) (*SilenceGenerator, error) {
+	if len(h) < 4 {
+		return nil, ErrBadHeader
+	}
+	t := FrameHeader{h[0], h[1], h[2] &^ 0x02, h[3]}
+	if t[0] != 0xFF || t[1]&0xE0 != 0xE0 ||
+		t.Emphasis() == EmphReserved ||
+		t.Layer() == LayerReserved ||
+		t.Version() == MPEGReserved ||
+		t.SampleRate() == -1 ||
+		t.BitRate() == -1 {
+		return nil, ErrBadHeader
+	}
+
+	f := &Frame{buf: t}
+	f.buf = append(f.buf, make([]byte, f.Size()-4)...)
+	off := 4
+	if t.Protection() {
+		off += 2
+	}
+	n, err := f.protectedBits()
+	if err != nil || off*8+n > len(f.buf)*8 {
+		return nil, ErrFrameSize
+	}
+	return &SilenceGenerator{h: t}, nil
+}
+
+// Header returns the header of unpadded frames from the generator
+func (g *SilenceGenerator) Header() FrameHeader {
+	return g.h
+}
+
+// SamplesPerFrame returns the number of samples, per channel, of each frame
+func (g *SilenceGenerator) SamplesPerFrame() int {
+	return samplesPerFrame[g.h.Version()][g.h.Layer()]
+}
+
+// Frame returns the next frame of silence. An all zero body is silent for
+// every layer, as it allocates no bits, or no Layer III main data, to any
+// subband.
+func (g *SilenceGenerator) Frame() *Frame {
+	slot := slotSize[g.h.Layer()]
+	sr := int(g.h.SampleRate())
+	g.rest += g.SamplesPerFrame() / 8 / slot * int(g.h.BitRate()) % sr
+	h := append(FrameHeader(nil), g.h...)
+	if g.rest >= sr {
+		g.rest -= sr
+		h[2] |= 0x02
+	}
+
+	f := &Frame{buf: h}
+	f.buf = append(f.buf, make([]byte, f.Size()-4)...)
+	if h.Protection() {
+		crc, _ := f.ComputeCRC()
+		f.buf[4], f.buf[5] = byte(crc>>8), byte(crc)
+	}
+	return f
+}
+
+// Samples returns the frames of silence needed to cover n samples per
+// channel. As frames hold a fixed number of samples, the last frame may run
+// past n; the number of samples of padding this adds is also returned, and
+// can be recorded in a LAME tag for gapless playback.
+func (g *SilenceGenerator) Samples(n int64) ([]*Frame, int) {
+	if n <= 0 {
+		return nil, 0
+	}
+	spf := int64(g.SamplesPerFrame())
+	count := (n + spf - 1) / spf
+	fs := make([]*Frame, count)
+	for i := range fs {
+		fs[i] = g.Frame()
+	}
+	return fs, int(count*spf - n)
+}
+
+// Duration returns the frames of silence needed to cover d, rounded to the
+// nearest sample, along with the samples of padding added by the last
+// frame, as with Samples
+func (g *SilenceGenerator) Duration(d time.Duration) ([]*Frame, int) {
+	return g.Samples(durationSamples(d, int(g.h.SampleRate())))
+}
+
+// durationSamples converts d to a number of samples at the sample rate,
+// rounding to the nearest sample
+func durationSamples(d time.Duration, rate int) int64 {
+	sr := int64(rate)
+	return int64(d/time.Second)*sr + (int64(d%time.Second)*sr+int64(time.Second)/2)/int64(time.Second)
+}
+
+// Read fills b with an endless stream of silent frames, in the manner of
+// MakeSilence
+func (g *SilenceGenerator) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		if len(g.buf) == 0 {
+			g.buf = g.Frame().buf
+		}
+		c := copy(b[n:], g.buf)
+		g.buf = g.buf[c:]
+		n += c
+	}
+	return n, nil
+}
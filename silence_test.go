@@ -0,0 +1,66 @@
+package mp3
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSilenceGenerator(t *testing.T) {
+	for _, h := range []FrameHeader{
+		{0xFF, 0xFE, 0x20, 0x00}, // MPEG-1 Layer I 64 kbit/s 44.1 kHz stereo, with CRC
+		{0xFF, 0xFC, 0x44, 0xC0}, // MPEG-1 Layer II 64 kbit/s 48 kHz mono, with CRC
+		{0xFF, 0xFB, 0x92, 0x64}, // MPEG-1 Layer III 128 kbit/s 44.1 kHz joint stereo, padding set
+		{0xFF, 0xF3, 0x80, 0xC4}, // MPEG-2 Layer III 64 kbit/s 22.05 kHz mono
+		{0xFF, 0xE3, 0x18, 0x00}, // MPEG-2.5 Layer III 8 kbit/s 8 kHz stereo
+	} {
+		g, err := NewSilenceGenerator(h)
+		if err != nil {
+			t.Fatalf("%x: unexpected error, %v", []byte(h), err)
+		}
+		fs, pad := g.Duration(time.Second)
+		sr := int(h.SampleRate())
+		if len(fs)*g.SamplesPerFrame()-pad != sr || pad < 0 || pad >= g.SamplesPerFrame() {
+			t.Fatalf("%x: %d frames with padding %d do not cover 1s", []byte(h), len(fs), pad)
+		}
+
+		var buf bytes.Buffer
+		for _, f := range fs {
+			buf.Write(f.Bytes())
+		}
+		// the bit rate is held over the second to within a frame
+		if want := int(h.BitRate()) / 8 * len(fs) * g.SamplesPerFrame() / sr; buf.Len() < want-4 || buf.Len() > want+4 {
+			t.Errorf("%x: expected about %d bytes, got %d", []byte(h), want, buf.Len())
+		}
+
+		d := NewDecoder(&buf, WithCRCPolicy(CRCReject))
+		var f Frame
+		var skipped, n int
+		for {
+			err := d.Decode(&f, &skipped)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%x: frame %d, %v", []byte(h), n, err)
+			}
+			fh := f.Header()
+			if fh[1] != h[1] || fh[2]&^0x02 != h[2]&^0x02 || fh[3] != h[3] || skipped != 0 {
+				t.Fatalf("%x: frame %d has header %x", []byte(h), n, []byte(fh))
+			}
+			n++
+		}
+		if n != len(fs) {
+			t.Errorf("%x: expected %d frames, decoded %d", []byte(h), len(fs), n)
+		}
+	}
+
+	if _, err := NewSilenceGenerator(FrameHeader{0xFF, 0xFB, 0x00, 0x00}); err != ErrBadHeader {
+		t.Errorf("expected ErrBadHeader, got %v", err)
+	}
+	// 32 kbit/s Layer I frames cannot hold a stereo bit allocation
+	if _, err := NewSilenceGenerator(FrameHeader{0xFF, 0xFF, 0x10, 0x00}); err != ErrFrameSize {
+		t.Errorf("expected ErrFrameSize, got %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+)
+
+type (
+	// ID3v1Tag is a decoded ID3v1 or ID3v1.1 tag. Track is only set for
+	// ID3v1.1 tags.
+	ID3v1Tag struct {
+		Title   string
+		Artist  string
+		Album   string
+		Year    string
+		Comment string
+		Track   int
+		Genre   byte
+	}
+
+	// APETag is a decoded APEv1 or APEv2 tag
+	APETag struct {
+		// Version is 1000 for APEv1 and 2000 for APEv2
+		Version int
+		// Flags holds the global tag flags
+		Flags uint32
+		// Items holds the tag items. It is nil if the items of a tag with no
+		// header could not be recovered.
+		Items []APEItem
+	}
+
+	// APEItem is a single key/value item of an APE tag
+	APEItem struct {
+		Key   string
+		Flags uint32
+		Value []byte
+	}
+)
+
+const (
+	id3v2HeaderLen = 10
+	id3v1Len       = 128
+	apeFooterLen   = 32
+
+	// maxJunk bounds the skipped bytes kept to recover APE items
+	maxJunk = 1 << 20
+	// maxAPESize bounds the size of the APE tags read, which is taken from
+	// the tag header
+	maxAPESize = 8 << 20
+
+	apeFlagHasHeader = 1 << 31
+	apeFlagIsHeader  = 1 << 29
+)
+
+var apePreamble = []byte("APETAGEX")
+
+// WithID3v2Handler registers a function that is called with the raw bytes of
+// each ID3v2 tag found in the stream, including the tag header and any
+// footer. The slice is not reused by the decoder. Tags are always skipped
+// whole, and do not count towards the skipped bytes reported by Decode.
+func WithID3v2Handler(fn func(tag []byte)) DecoderOption {
+	return func(d *Decoder) {
+		d.id3v2 = fn
+	}
+}
+
+// WithID3v1Handler registers a function that is called with the ID3v1 tag
+// found as the trailing 128 bytes of the stream, if any.
+func WithID3v1Handler(fn func(*ID3v1Tag)) DecoderOption {
+	return func(d *Decoder) {
+		d.id3v1 = fn
+	}
+}
+
+// WithAPEHandler registers a function that is called with each APE tag found
+// in the stream. APE tags without a header are only recognised once their
+// footer is reached, their items are recovered from the skipped bytes
+// preceding it, and are then no longer counted as skipped.
+func WithAPEHandler(fn func(*APETag)) DecoderOption {
+	return func(d *Decoder) {
+		d.ape = fn
+	}
+}
+
+// skipTag checks for any known tag at the start of buf and consumes it. On
+// success buf is returned empty and ok is true.
+func (d *Decoder) skipTag(buf []byte, skipped *int) (res []byte, ok bool, err error) {
+	switch {
+	case buf[0] == 'I' && buf[1] == 'D' && buf[2] == '3':
+		return d.skipID3v2(buf)
+	case buf[0] == 'T' && buf[1] == 'A' && buf[2] == 'G':
+		return d.skipID3v1(buf)
+	case buf[0] == 'A' && buf[1] == 'P' && buf[2] == 'E' && buf[3] == 'T':
+		return d.skipAPE(buf, skipped)
+	}
+	return buf, false, nil
+}
+
+// ID3v2Size returns the full length of the ID3v2 tag whose header is at
+// the start of b, including the header and any footer, and false if b does
+// not hold a valid tag header
+func ID3v2Size(b []byte) (int, bool) {
+	if len(b) < id3v2HeaderLen ||
+		b[0] != 'I' || b[1] != 'D' || b[2] != '3' ||
+		b[3] == 0xFF || b[4] == 0xFF {
+		return 0, false
+	}
+	size := 0
+	for _, c := range b[6:10] {
+		if c&0x80 != 0 {
+			return 0, false
+		}
+		size = size<<7 | int(c)
+	}
+	size += id3v2HeaderLen
+	if b[3] >= 4 && b[5]&0x10 != 0 {
+		// footer present, only defined from ID3v2.4
+		size += id3v2HeaderLen
+	}
+	return size, true
+}
+
+// skipID3v2 consumes an ID3v2 tag at the start of buf, passing it to the
+// tag handler
+func (d *Decoder) skipID3v2(buf []byte) (res []byte, ok bool, err error) {
+	buf, err = fillbuf(buf, d.src, id3v2HeaderLen)
+	if err != nil {
+		return buf, false, nil
+	}
+	size, ok := ID3v2Size(buf)
+	if !ok {
+		return buf, false, nil
+	}
+
+	if d.id3v2 == nil {
+		_, err = io.CopyN(ioutil.Discard, d.src, int64(size-len(buf)))
+		return buf[:0], true, premature(err)
+	}
+
+	tag := make([]byte, size)
+	n := copy(tag, buf)
+	if _, err = io.ReadFull(d.src, tag[n:]); err != nil {
+		return buf[:0], true, premature(err)
+	}
+	d.id3v2(tag)
+	return buf[:0], true, nil
+}
+
+// skipID3v1 consumes an ID3v1 tag at the start of buf, passing it to the
+// tag handler. The tag has no length or checksum to confirm it, so it is
+// only accepted as the last 128 bytes of the stream.
+func (d *Decoder) skipID3v1(buf []byte) (res []byte, ok bool, err error) {
+	buf, err = fillbuf(buf, d.src, id3v1Len+1)
+	if len(buf) != id3v1Len || (err != io.EOF && err != io.ErrUnexpectedEOF) {
+		return buf, false, nil
+	}
+	if d.id3v1 != nil {
+		d.id3v1(parseID3v1(buf[:id3v1Len]))
+	}
+	return buf[:0], true, nil
+}
+
+// parseID3v1 decodes a 128 byte ID3v1 tag
+func parseID3v1(b []byte) *ID3v1Tag {
+	str := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		b = bytes.TrimRight(b, " ")
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		return string(r)
+	}
+
+	t := &ID3v1Tag{
+		Title:  str(b[3:33]),
+		Artist: str(b[33:63]),
+		Album:  str(b[63:93]),
+		Year:   str(b[93:97]),
+		Genre:  b[127],
+	}
+	comment := b[97:127]
+	if comment[28] == 0 && comment[29] != 0 {
+		t.Track = int(comment[29])
+		comment = comment[:28]
+	}
+	t.Comment = str(comment)
+	return t
+}
+
+// Bytes serialises the tag in the 128 byte ID3v1.1 layout, or ID3v1 if
+// Track is 0. Text is truncated to fit.
+func (t *ID3v1Tag) Bytes() []byte {
+	b := make([]byte, id3v1Len)
+	put := func(dst []byte, s string) {
+		i := 0
+		for _, r := range s {
+			if i == len(dst) {
+				break
+			}
+			if r > 0xFF {
+				r = '?'
+			}
+			dst[i] = byte(r)
+			i++
+		}
+	}
+	copy(b, "TAG")
+	put(b[3:33], t.Title)
+	put(b[33:63], t.Artist)
+	put(b[63:93], t.Album)
+	put(b[93:97], t.Year)
+	if t.Track != 0 {
+		put(b[97:125], t.Comment)
+		b[126] = byte(t.Track)
+	} else {
+		put(b[97:127], t.Comment)
+	}
+	b[127] = t.Genre
+	return b
+}
+
+// skipAPE consumes an APE tag header, or footer, at the start of buf,
+// passing the tag to the tag handler
+func (d *Decoder) skipAPE(buf []byte, skipped *int) (res []byte, ok bool, err error) {
+	buf, err = fillbuf(buf, d.src, apeFooterLen)
+	if err != nil || !bytes.HasPrefix(buf, apePreamble) {
+		return buf, false, nil
+	}
+	version := binary.LittleEndian.Uint32(buf[8:12])
+	size := int(binary.LittleEndian.Uint32(buf[12:16]))
+	count := int(binary.LittleEndian.Uint32(buf[16:20]))
+	flags := binary.LittleEndian.Uint32(buf[20:24])
+	if (version != 1000 && version != 2000) || size < apeFooterLen || size > maxAPESize {
+		return buf, false, nil
+	}
+	t := &APETag{Version: int(version), Flags: flags}
+
+	if flags&apeFlagIsHeader != 0 {
+		// the items and footer follow. If they can not all be read the
+		// header is taken to be junk, and the bytes after it are left to
+		// be searched for frames.
+		body := make([]byte, size)
+		if n, err := io.ReadFull(d.src, body); err != nil {
+			d.src.unread(body[:n])
+			return buf, false, nil
+		}
+		t.Items = parseAPEItems(body[:size-apeFooterLen], count)
+	} else if items := size - apeFooterLen; items <= len(d.junk) && items <= *skipped {
+		// the items have already been skipped over
+		t.Items = parseAPEItems(d.junk[len(d.junk)-items:], count)
+		*skipped -= items
+	}
+
+	if d.ape != nil {
+		d.ape(t)
+	}
+	return buf[:0], true, nil
+}
+
+// parseAPEItems decodes count APE items from b
+func parseAPEItems(b []byte, count int) []APEItem {
+	items := []APEItem{}
+	for i := 0; i < count && len(b) >= 9; i++ {
+		size := int(binary.LittleEndian.Uint32(b[0:4]))
+		flags := binary.LittleEndian.Uint32(b[4:8])
+		b = b[8:]
+		k := bytes.IndexByte(b, 0)
+		if k < 0 || k+1+size > len(b) {
+			break
+		}
+		items = append(items, APEItem{
+			Key:   string(b[:k]),
+			Flags: flags,
+			Value: append([]byte(nil), b[k+1:k+1+size]...),
+		})
+		b = b[k+1+size:]
+	}
+	return items
+}
+
+// Item returns the value of the item with the given key, compared case
+// insensitively as required by APEv2, or nil
+func (t *APETag) Item(key string) []byte {
+	for _, it := range t.Items {
+		if bytes.EqualFold([]byte(it.Key), []byte(key)) {
+			return it.Value
+		}
+	}
+	return nil
+}
+
+// Bytes serialises the tag as an APE tag with a header and footer, the
+// layout used at the end of mp3 files
+func (t *APETag) Bytes() []byte {
+	var items []byte
+	for _, it := range t.Items {
+		var hdr [8]byte
+		binary.LittleEndian.PutUint32(hdr[0:4], uint32(len(it.Value)))
+		binary.LittleEndian.PutUint32(hdr[4:8], it.Flags)
+		items = append(items, hdr[:]...)
+		items = append(items, it.Key...)
+		items = append(items, 0)
+		items = append(items, it.Value...)
+	}
+
+	version := uint32(t.Version)
+	if version == 0 {
+		version = 2000
+	}
+	footer := func(flags uint32) []byte {
+		b := make([]byte, apeFooterLen)
+		copy(b, apePreamble)
+		binary.LittleEndian.PutUint32(b[8:12], version)
+		binary.LittleEndian.PutUint32(b[12:16], uint32(len(items)+apeFooterLen))
+		binary.LittleEndian.PutUint32(b[16:20], uint32(len(t.Items)))
+		binary.LittleEndian.PutUint32(b[20:24], flags)
+		return b
+	}
+
+	flags := t.Flags&^apeFlagIsHeader | apeFlagHasHeader
+	out := footer(flags | apeFlagIsHeader)
+	out = append(out, items...)
+	return append(out, footer(flags)...)
+}
+
+// addJunk records skipped bytes, keeping at most maxJunk of the most recent
+func (d *Decoder) addJunk(b []byte) {
+	d.junk = append(d.junk, b...)
+	if len(d.junk) > maxJunk {
+		n := copy(d.junk, d.junk[len(d.junk)-maxJunk:])
+		d.junk = d.junk[:n]
+	}
+}
@@ -0,0 +1,110 @@
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestDecodeTrailers(t *testing.T) {
+	v1 := &ID3v1Tag{Title: "Title", Artist: "Artist", Year: "2001", Comment: "hi", Track: 7, Genre: 12}
+	ape := (&APETag{Items: []APEItem{{Key: "REPLAYGAIN_TRACK_GAIN", Value: []byte("-3.10 dB")}}}).Bytes()
+	// drop the APE header, as most writers do at the end of a file
+	apeNoHeader := append([]byte{}, ape[apeFooterLen:]...)
+	flags := binary.LittleEndian.Uint32(apeNoHeader[len(apeNoHeader)-12:])
+	binary.LittleEndian.PutUint32(apeNoHeader[len(apeNoHeader)-12:], flags&^apeFlagHasHeader)
+
+	for _, trailer := range [][]byte{ape, apeNoHeader} {
+		var src []byte
+		src = append(src, SilentBytes...)
+		src = append(src, SilentBytes...)
+		src = append(src, trailer...)
+		src = append(src, v1.Bytes()...)
+
+		var gotV1 *ID3v1Tag
+		var gotAPE *APETag
+		d := NewDecoder(bytes.NewReader(src),
+			WithID3v1Handler(func(t *ID3v1Tag) { gotV1 = t }),
+			WithAPEHandler(func(t *APETag) { gotAPE = t }))
+
+		var f Frame
+		frames, skipped, total := 0, 0, 0
+		var err error
+		for {
+			if err = d.Decode(&f, &skipped); err != nil {
+				break
+			}
+			total += skipped
+			frames++
+		}
+		total += skipped
+		if err != io.EOF {
+			t.Fatalf("expected io.EOF, got %v", err)
+		}
+		if frames != 2 || total != 0 {
+			t.Errorf("expected 2 frames and no skipped bytes, got %d and %d", frames, total)
+		}
+		if gotV1 == nil || *gotV1 != *v1 {
+			t.Errorf("unexpected ID3v1 tag %+v", gotV1)
+		}
+		if gotAPE == nil || string(gotAPE.Item("replaygain_track_gain")) != "-3.10 dB" {
+			t.Errorf("unexpected APE tag %+v", gotAPE)
+		}
+	}
+}
+
+func TestDecodeEOF(t *testing.T) {
+	var f Frame
+	skipped := 0
+
+	d := NewDecoder(bytes.NewReader(append(append([]byte{}, SilentBytes...), 1, 2, 3)))
+	d.Decode(&f, &skipped)
+	if err := d.Decode(&f, &skipped); err != ErrNoSyncBits || skipped != 3 {
+		t.Errorf("expected ErrNoSyncBits with 3 skipped, got %v with %d", err, skipped)
+	}
+
+	d = NewDecoder(bytes.NewReader(SilentBytes[:100]))
+	if err := d.Decode(&f, &skipped); err != ErrPrematureEOF {
+		t.Errorf("expected ErrPrematureEOF, got %v", err)
+	}
+}
+
+func TestDecodeForgedAPEHeader(t *testing.T) {
+	for _, size := range []uint32{0xFFFFFF00, 4096} {
+		hdr := (&APETag{}).Bytes()[:apeFooterLen]
+		binary.LittleEndian.PutUint32(hdr[12:16], size)
+
+		src := append(append([]byte{}, hdr...), SilentBytes...)
+		d := NewDecoder(bytes.NewReader(src))
+		var f Frame
+		skipped := 0
+		if err := d.Decode(&f, &skipped); err != nil {
+			t.Fatalf("size %x: unexpected error, %v", size, err)
+		}
+		if skipped != apeFooterLen || !bytes.Equal(f.Bytes(), SilentBytes) {
+			t.Errorf("size %x: expected the frame after %d skipped bytes, got %d", size, apeFooterLen, skipped)
+		}
+	}
+}
+
+func TestDecodeTAGJunk(t *testing.T) {
+	// TAG within the stream is junk, not an ID3v1 tag
+	var src []byte
+	src = append(src, SilentBytes...)
+	src = append(src, "TAG"...)
+	src = append(src, SilentBytes...)
+	src = append(src, SilentBytes...)
+
+	called := false
+	d := NewDecoder(bytes.NewReader(src), WithID3v1Handler(func(*ID3v1Tag) { called = true }))
+	var f Frame
+	frames, skipped, total := 0, 0, 0
+	for d.Decode(&f, &skipped) == nil {
+		total += skipped
+		frames++
+	}
+	if frames != 3 || total != 3 || called {
+		t.Errorf("expected 3 frames after 3 skipped bytes, got %d after %d, tag %v", frames, total, called)
+	}
+}
@@ -0,0 +1,208 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type (
+	// StreamInfo is implemented by the headers, Xing, Info and VBRI, that an
+	// encoder may place in the first frame of a stream to describe it.
+	StreamInfo interface {
+		// FrameCount returns the number of audio frames in the stream, or 0
+		// if unknown
+		FrameCount() int
+		// ByteCount returns the length of the stream in bytes, or 0 if
+		// unknown
+		ByteCount() int
+		// Duration returns the playing time of the stream, or 0 if unknown
+		Duration() time.Duration
+		// SeekOffset returns the approximate byte offset, relative to the
+		// start of the header frame, of the audio at time t. It returns false
+		// if the header holds no seek information.
+		SeekOffset(t time.Duration) (int64, bool)
+	}
+
+	// VBRIHeader is the content of a Fraunhofer VBRI header
+	VBRIHeader struct {
+		Version int
+		// Delay is the encoder delay, as stored
+		Delay int
+		// Quality is the encoder quality indicator
+		Quality int
+		// Bytes is the length of the stream in bytes
+		Bytes int
+		// Frames is the number of frames in the stream
+		Frames int
+		// TOC holds the size in bytes, before scaling by TOCScale, of each
+		// successive group of FramesPerEntry frames
+		TOC            []int
+		TOCScale       int
+		EntrySize      int
+		FramesPerEntry int
+
+		// Header is the frame header of the frame carrying the tag
+		Header FrameHeader
+	}
+)
+
+var (
+	// ErrNoVBRI indicates that the frame does not hold a VBRI header
+	ErrNoVBRI = errors.New("no VBRI header")
+
+	// ErrNoStreamInfo indicates that the frame holds no stream info header
+	ErrNoStreamInfo = errors.New("no stream info header")
+)
+
+// vbriOffset is the fixed position of the VBRI header, 32 bytes after the
+// frame header
+const vbriOffset = 4 + 32
+
+// VBRI parses the VBRI header held in the frame. ErrNoVBRI is returned if
+// there is none.
+func (f *Frame) VBRI() (*VBRIHeader, error) {
+	b := f.buf
+	if f.Header().Layer() != Layer3 || len(b) < vbriOffset+26 || string(b[vbriOffset:vbriOffset+4]) != "VBRI" {
+		return nil, ErrNoVBRI
+	}
+	b = b[vbriOffset+4:]
+	v := &VBRIHeader{
+		Version:        int(binary.BigEndian.Uint16(b[0:2])),
+		Delay:          int(binary.BigEndian.Uint16(b[2:4])),
+		Quality:        int(binary.BigEndian.Uint16(b[4:6])),
+		Bytes:          int(binary.BigEndian.Uint32(b[6:10])),
+		Frames:         int(binary.BigEndian.Uint32(b[10:14])),
+		TOCScale:       int(binary.BigEndian.Uint16(b[16:18])),
+		EntrySize:      int(binary.BigEndian.Uint16(b[18:20])),
+		FramesPerEntry: int(binary.BigEndian.Uint16(b[20:22])),
+		Header:         FrameHeader(append([]byte(nil), f.buf[:4]...)),
+	}
+	entries := int(binary.BigEndian.Uint16(b[14:16]))
+	if v.EntrySize < 1 || v.EntrySize > 4 {
+		return nil, fmt.Errorf("bad VBRI TOC entry size %d", v.EntrySize)
+	}
+	b = b[22:]
+	if len(b) < entries*v.EntrySize {
+		return nil, fmt.Errorf("VBRI header truncated")
+	}
+	v.TOC = make([]int, entries)
+	for i := range v.TOC {
+		e := 0
+		for j := 0; j < v.EntrySize; j++ {
+			e = e<<8 | int(b[j])
+		}
+		v.TOC[i] = e
+		b = b[v.EntrySize:]
+	}
+	return v, nil
+}
+
+// StreamInfo parses the Xing, Info or VBRI header held in the frame.
+// ErrNoStreamInfo is returned if there is none.
+func (f *Frame) StreamInfo() (StreamInfo, error) {
+	if x, err := f.Xing(); err == nil {
+		return x, nil
+	}
+	if v, err := f.VBRI(); err == nil {
+		return v, nil
+	}
+	return nil, ErrNoStreamInfo
+}
+
+// IsStreamInfo reports whether the frame holds a Xing, Info or VBRI header
+// rather than audio
+func (f *Frame) IsStreamInfo() bool {
+	_, err := f.StreamInfo()
+	return err == nil
+}
+
+// FrameCount returns the number of frames in the stream
+func (v *VBRIHeader) FrameCount() int {
+	return v.Frames
+}
+
+// ByteCount returns the length of the stream in bytes
+func (v *VBRIHeader) ByteCount() int {
+	return v.Bytes
+}
+
+// Duration returns the duration of the stream
+func (v *VBRIHeader) Duration() time.Duration {
+	return framesDuration(v.Header, v.Frames)
+}
+
+// SeekOffset returns the approximate byte offset of time t, interpolating
+// within the TOC entry it falls in
+func (v *VBRIHeader) SeekOffset(t time.Duration) (int64, bool) {
+	if len(v.TOC) == 0 || v.FramesPerEntry == 0 {
+		return 0, false
+	}
+	frameDur := framesDuration(v.Header, 1)
+	if frameDur <= 0 {
+		return 0, false
+	}
+	if t < 0 {
+		t = 0
+	}
+	frame := float64(t) / float64(frameDur)
+	entry := int(frame) / v.FramesPerEntry
+
+	var off int64
+	for i := 0; i < entry && i < len(v.TOC); i++ {
+		off += int64(v.TOC[i]) * int64(v.TOCScale)
+	}
+	if entry < len(v.TOC) {
+		frac := (frame - float64(entry*v.FramesPerEntry)) / float64(v.FramesPerEntry)
+		off += int64(frac * float64(v.TOC[entry]*v.TOCScale))
+	}
+	return off, true
+}
+
+// FrameCount returns the number of audio frames in the stream
+func (x *XingHeader) FrameCount() int {
+	return x.Frames
+}
+
+// ByteCount returns the length of the stream in bytes
+func (x *XingHeader) ByteCount() int {
+	return x.Bytes
+}
+
+// SeekOffset returns the approximate byte offset of time t, interpolating
+// between TOC entries
+func (x *XingHeader) SeekOffset(t time.Duration) (int64, bool) {
+	d := x.Duration()
+	if x.Flags&XingTOC == 0 || x.Flags&XingBytes == 0 || d <= 0 {
+		return 0, false
+	}
+	pc := float64(t) / float64(d) * 100
+	switch {
+	case pc < 0:
+		pc = 0
+	case pc >= 100:
+		return int64(x.Bytes), true
+	}
+	i := int(pc)
+	a := float64(x.TOC[i])
+	b := 256.0
+	if i < 99 {
+		b = float64(x.TOC[i+1])
+	}
+	pos := a + (b-a)*(pc-float64(i))
+	return int64(pos / 256 * float64(x.Bytes)), true
+}
+
+// String renders the header for display purposes
+func (v *VBRIHeader) String() string {
+	str := ""
+	str += fmt.Sprintf(" Version: %v\n", v.Version)
+	str += fmt.Sprintf(" Delay: %v\n", v.Delay)
+	str += fmt.Sprintf(" Quality: %v\n", v.Quality)
+	str += fmt.Sprintf(" Frames: %v\n", v.Frames)
+	str += fmt.Sprintf(" Bytes: %v\n", v.Bytes)
+	str += fmt.Sprintf(" TOC entries: %v\n", len(v.TOC))
+	str += fmt.Sprintf(" Duration: %v\n", v.Duration())
+	return str
+}
@@ -0,0 +1,221 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+type (
+	// Writer writes frames to an io.WriteSeeker. Layer III streams are
+	// preceded by an Info or Xing header frame, which is filled in on Close
+	// with the frame count, byte count and seek table of the frames written,
+	// so that players report the correct duration of cut or joined streams.
+	Writer struct {
+		w    io.WriteSeeker
+		lame *LAMETag
+
+		start  int64   // offset of the header frame in w
+		tag    []byte  // the header frame, nil until the first audio frame
+		offs   []int64 // offset of each audio frame from the header frame
+		size   int64   // bytes written, including the header frame
+		crc    uint16  // LAME CRC of the audio frames
+		rate   FrameBitRate
+		vbr    bool
+		noTag  bool
+		closed bool
+	}
+
+	// WriterOption configures optional Writer behaviour
+	WriterOption func(*Writer)
+)
+
+var (
+	// ErrWriterClosed indicates that a frame was written after Close
+	ErrWriterClosed = errors.New("write to closed Writer")
+)
+
+// writerTagRoom is the room needed after the Xing identifier for the
+// flags, frame and byte counts, TOC and LAME tag
+const writerTagRoom = 8 + 4 + 4 + 100 + lameTagLen
+
+// WithLAMETag adds a LAME tag after the Xing or Info header, holding the
+// fields of tag. This is mostly useful to record the EncoderDelay and
+// Padding of the stream for gapless playback. MusicLength and the CRCs are
+// computed by the Writer. Many players only read the tag if Encoder starts
+// with "LAME", which is used if Encoder is empty. A LAME tag found in a
+// header frame passed to WriteFrame is used if this option is not given.
+func WithLAMETag(tag LAMETag) WriterOption {
+	return func(w *Writer) {
+		w.lame = &tag
+	}
+}
+
+// NewWriter returns a Writer that writes frames to w, starting at its
+// current position
+func NewWriter(w io.WriteSeeker, opts ...WriterOption) *Writer {
+	wr := &Writer{w: w}
+	for _, o := range opts {
+		o(wr)
+	}
+	return wr
+}
+
+// WriteFrame writes the frame to the stream. Xing, Info and VBRI header
+// frames are dropped, as the Writer writes its own.
+func (w *Writer) WriteFrame(f *Frame) error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	if f.IsStreamInfo() {
+		if w.lame == nil && w.tag == nil {
+			if l, err := f.LAME(); err == nil {
+				w.lame = l
+			}
+		}
+		return nil
+	}
+
+	if w.tag == nil && !w.noTag {
+		if err := w.reserve(f.Header()); err != nil {
+			return err
+		}
+	}
+
+	b := f.Bytes()
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+	if w.noTag {
+		return nil
+	}
+	if br := f.BitRate(); len(w.offs) == 0 {
+		w.rate = br
+	} else if br != w.rate {
+		w.vbr = true
+	}
+	w.offs = append(w.offs, w.size)
+	w.size += int64(len(b))
+	w.crc = lameCRC16(w.crc, b)
+	return nil
+}
+
+// reserve writes an empty header frame, in the format of the first audio
+// frame h, to be filled in by Close
+func (w *Writer) reserve(h FrameHeader) error {
+	if h.Layer() != Layer3 {
+		w.noTag = true
+		return nil
+	}
+	start, err := w.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	// the header frame is unprotected and unpadded, and uses the smallest
+	// bit rate, from that of the first frame, with room for the tag
+	t := FrameHeader{h[0], h[1] | 0x01, h[2] &^ 0x02, h[3] &^ 0x30}
+	f := &Frame{buf: t}
+	off, err := f.xingOffset()
+	if err != nil {
+		return err
+	}
+	if t[2]>>4 == 0 {
+		t[2] |= 1 << 4
+	}
+	for f.Size() < off+writerTagRoom && t[2]>>4 < 14 {
+		t[2] += 1 << 4
+	}
+
+	w.tag = make([]byte, f.Size())
+	copy(w.tag, t)
+	if _, err := w.w.Write(w.tag); err != nil {
+		return err
+	}
+	w.start = start
+	w.size = int64(len(w.tag))
+	return nil
+}
+
+// Close fills in the header frame. The underlying io.WriteSeeker is left
+// positioned at the end of the stream, and is not closed. If the write of
+// the first audio frame failed, the header frame reserved ahead of it is
+// removed instead: the io.WriteSeeker is positioned back at its start, and
+// truncated there if it has a Truncate method, as *os.File does.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	w.closed = true
+	if w.tag == nil {
+		return nil
+	}
+	if len(w.offs) == 0 {
+		return w.unreserve()
+	}
+
+	f := &Frame{buf: w.tag}
+	off, err := f.xingOffset()
+	if err != nil {
+		return err
+	}
+	b := w.tag[off:]
+	if w.vbr {
+		copy(b, "Xing")
+	} else {
+		copy(b, "Info")
+	}
+	binary.BigEndian.PutUint32(b[4:], XingFrames|XingBytes|XingTOC)
+	binary.BigEndian.PutUint32(b[8:], uint32(len(w.offs)))
+	binary.BigEndian.PutUint32(b[12:], uint32(w.size))
+	for i := 0; i < 100; i++ {
+		pos := w.offs[i*len(w.offs)/100] * 256 / w.size
+		if pos > 255 {
+			pos = 255
+		}
+		b[16+i] = byte(pos)
+	}
+
+	if w.lame != nil {
+		l := *w.lame
+		if l.Encoder == "" {
+			l.Encoder = "LAME"
+		}
+		if l.VBRMethod == LAMEVBRUnknown && !w.vbr {
+			l.VBRMethod = LAMECBR
+		}
+		if l.Bitrate == 0 && !w.vbr {
+			l.Bitrate = int(w.rate / 1000)
+			if l.Bitrate > 255 {
+				l.Bitrate = 255
+			}
+		}
+		l.MusicLength = int(w.size)
+		l.MusicCRC = w.crc
+		l.put(b[116:])
+		l.TagCRC = lameCRC16(0, w.tag[:off+116+34])
+		binary.BigEndian.PutUint16(b[116+34:], l.TagCRC)
+	}
+
+	if _, err := w.w.Seek(w.start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(w.tag); err != nil {
+		return err
+	}
+	_, err = w.w.Seek(w.start+w.size, io.SeekStart)
+	return err
+}
+
+// unreserve removes the header frame written by reserve
+func (w *Writer) unreserve() error {
+	if _, err := w.w.Seek(w.start, io.SeekStart); err != nil {
+		return err
+	}
+	if t, ok := w.w.(interface {
+		Truncate(size int64) error
+	}); ok {
+		return t.Truncate(w.start)
+	}
+	return nil
+}
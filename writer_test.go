@@ -0,0 +1,142 @@
+package mp3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// seekBuffer is an in memory io.WriteSeeker
+type seekBuffer struct {
+	buf []byte
+	pos int
+}
+
+func (s *seekBuffer) Write(b []byte) (int, error) {
+	if n := s.pos + len(b); n > len(s.buf) {
+		s.buf = append(s.buf, make([]byte, n-len(s.buf))...)
+	}
+	copy(s.buf[s.pos:], b)
+	s.pos += len(b)
+	return len(b), nil
+}
+
+// Truncate changes the length of the buffer, as os.File.Truncate
+func (s *seekBuffer) Truncate(size int64) error {
+	s.buf = s.buf[:size]
+	return nil
+}
+
+func (s *seekBuffer) Seek(off int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		off += int64(s.pos)
+	case io.SeekEnd:
+		off += int64(len(s.buf))
+	}
+	if off < 0 {
+		return 0, errors.New("negative position")
+	}
+	s.pos = int(off)
+	return off, nil
+}
+
+func TestWriter(t *testing.T) {
+	for _, vbr := range []bool{false, true} {
+		var sb seekBuffer
+		sb.Write([]byte("junk"))
+		w := NewWriter(&sb, WithLAMETag(LAMETag{EncoderDelay: 576, Padding: 1000}))
+
+		// a stale header frame is dropped
+		if err := w.WriteFrame(&Frame{buf: xingFrame(1, 1)}); err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		var audio []byte
+		for i := 0; i < 20; i++ {
+			b := silentFrameAt(9)
+			if vbr && i >= 10 {
+				b = silentFrameAt(14)
+			}
+			f, err := NewFrame(b)
+			if err != nil {
+				t.Fatalf("unexpected error, %v", err)
+			}
+			audio = append(audio, f.Bytes()...)
+			if err := w.WriteFrame(f); err != nil {
+				t.Fatalf("unexpected error, %v", err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		if err := w.WriteFrame(SilentFrame); err != ErrWriterClosed {
+			t.Errorf("expected ErrWriterClosed, got %v", err)
+		}
+
+		d := NewDecoder(bytes.NewReader(sb.buf[4:]))
+		var f Frame
+		var skipped int
+		if err := d.Decode(&f, &skipped); err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		x, err := f.Xing()
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		if x.Info == vbr || x.Frames != 20 || x.Bytes != len(sb.buf)-4 {
+			t.Errorf("vbr %v: unexpected header %+v", vbr, x)
+		}
+		if want := byte((f.Size() + len(audio)/2) * 256 / x.Bytes); !vbr && x.TOC[50] != want {
+			t.Errorf("expected TOC[50] %d, got %d", want, x.TOC[50])
+		}
+		if x.TOC[0] == 0 || x.TOC[99] < x.TOC[50] {
+			t.Errorf("unexpected TOC %v", x.TOC)
+		}
+
+		l, err := f.LAME()
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		if l.Encoder != "LAME" || l.EncoderDelay != 576 || l.Padding != 1000 || l.MusicLength != x.Bytes {
+			t.Errorf("vbr %v: unexpected tag %+v", vbr, l)
+		}
+		if !l.TagCRCValid || l.MusicCRC != lameCRC16(0, audio) {
+			t.Errorf("vbr %v: bad CRCs in tag %+v", vbr, l)
+		}
+		if !bytes.Equal(sb.buf[len(sb.buf)-len(audio):], audio) || sb.pos != len(sb.buf) {
+			t.Errorf("vbr %v: audio not written intact", vbr)
+		}
+	}
+}
+
+// failWriter is a seekBuffer whose writes fail after the first n
+type failWriter struct {
+	seekBuffer
+	n int
+}
+
+func (s *failWriter) Write(b []byte) (int, error) {
+	if s.n == 0 {
+		return 0, errors.New("write failed")
+	}
+	s.n--
+	return s.seekBuffer.Write(b)
+}
+
+func TestWriterFailedFirstFrame(t *testing.T) {
+	// the header frame is reserved, but the first frame is not written, so
+	// the header frame is removed
+	fw := &failWriter{n: 2}
+	fw.Write([]byte("junk"))
+	w := NewWriter(fw)
+	if err := w.WriteFrame(SilentFrame); err == nil {
+		t.Fatalf("expected write error")
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("unexpected error, %v", err)
+	}
+	if string(fw.buf) != "junk" || fw.pos != 4 {
+		t.Errorf("header frame left in %d bytes, at %d", len(fw.buf), fw.pos)
+	}
+}
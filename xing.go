@@ -0,0 +1,166 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type (
+	// XingHeader is the content of a Xing or Info VBR header. Encoders write
+	// it into the otherwise silent first frame of a stream, Info headers are
+	// used for CBR streams.
+	XingHeader struct {
+		// Info is set for "Info" rather than "Xing" headers
+		Info bool
+		// Flags indicates which of the optional fields are present
+		Flags uint32
+		// Frames is the number of audio frames in the stream, not counting
+		// the header frame itself
+		Frames int
+		// Bytes is the length of the stream in bytes, including the header
+		// frame
+		Bytes int
+		// TOC holds 100 seek points. Entry i gives the position in the stream,
+		// in 1/256ths of Bytes, at which i percent of the duration is reached.
+		TOC [100]byte
+		// Quality is the encoder quality indicator, from 0 (best) to 100
+		Quality int
+
+		// Header is the frame header of the frame carrying the tag
+		Header FrameHeader
+		// offset of the "Xing" or "Info" identifier within the frame
+		offset int
+	}
+)
+
+// Xing header flags
+const (
+	XingFrames  = 0x0001
+	XingBytes   = 0x0002
+	XingTOC     = 0x0004
+	XingQuality = 0x0008
+)
+
+// ErrNoXing indicates that the frame does not hold a Xing or Info header
+var ErrNoXing = errors.New("no Xing or Info header")
+
+// xingOffset returns the offset of the Xing identifier within the frame,
+// which is placed straight after the side info
+func (f *Frame) xingOffset() (int, error) {
+	sil, err := f.SideInfoLength()
+	if err != nil {
+		return 0, err
+	}
+	off := 4 + sil
+	if f.Header().Protection() {
+		off += 2
+	}
+	return off, nil
+}
+
+// IsXing reports whether the frame holds a Xing or Info header rather
+// than audio
+func (f *Frame) IsXing() bool {
+	_, err := f.Xing()
+	return err == nil
+}
+
+// Xing parses the Xing or Info header held in the frame. ErrNoXing is
+// returned if there is none.
+func (f *Frame) Xing() (*XingHeader, error) {
+	if f.Header().Layer() != Layer3 {
+		return nil, ErrNoXing
+	}
+	off, err := f.xingOffset()
+	if err != nil {
+		return nil, err
+	}
+	b := f.buf
+	if len(b) < off+8 {
+		return nil, ErrNoXing
+	}
+
+	x := &XingHeader{
+		Header: FrameHeader(append([]byte(nil), f.buf[:4]...)),
+		offset: off,
+	}
+	switch string(b[off : off+4]) {
+	case "Xing":
+	case "Info":
+		x.Info = true
+	default:
+		return nil, ErrNoXing
+	}
+	x.Flags = binary.BigEndian.Uint32(b[off+4:])
+
+	p := off + 8
+	field := func(n int) ([]byte, error) {
+		if p+n > len(b) {
+			return nil, fmt.Errorf("Xing header truncated")
+		}
+		v := b[p : p+n]
+		p += n
+		return v, nil
+	}
+	if x.Flags&XingFrames != 0 {
+		v, err := field(4)
+		if err != nil {
+			return nil, err
+		}
+		x.Frames = int(binary.BigEndian.Uint32(v))
+	}
+	if x.Flags&XingBytes != 0 {
+		v, err := field(4)
+		if err != nil {
+			return nil, err
+		}
+		x.Bytes = int(binary.BigEndian.Uint32(v))
+	}
+	if x.Flags&XingTOC != 0 {
+		v, err := field(100)
+		if err != nil {
+			return nil, err
+		}
+		copy(x.TOC[:], v)
+	}
+	if x.Flags&XingQuality != 0 {
+		v, err := field(4)
+		if err != nil {
+			return nil, err
+		}
+		x.Quality = int(binary.BigEndian.Uint32(v))
+	}
+	return x, nil
+}
+
+// Duration returns the duration of the stream, or 0 if the frame count is
+// not present
+func (x *XingHeader) Duration() time.Duration {
+	if x.Flags&XingFrames == 0 {
+		return 0
+	}
+	return framesDuration(x.Header, x.Frames)
+}
+
+// framesDuration gives the duration of n frames with header h
+func framesDuration(h FrameHeader, n int) time.Duration {
+	sr := int(h.SampleRate())
+	if sr <= 0 {
+		return 0
+	}
+	samples := int64(samplesPerFrame[h.Version()][h.Layer()]) * int64(n)
+	return samplesDuration(samples, sr)
+}
+
+// String renders the header for display purposes
+func (x *XingHeader) String() string {
+	str := ""
+	str += fmt.Sprintf(" Info: %v\n", x.Info)
+	str += fmt.Sprintf(" Frames: %v\n", x.Frames)
+	str += fmt.Sprintf(" Bytes: %v\n", x.Bytes)
+	str += fmt.Sprintf(" Quality: %v\n", x.Quality)
+	str += fmt.Sprintf(" Duration: %v\n", x.Duration())
+	return str
+}
@@ -0,0 +1,151 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// xingFrame builds a Xing header frame in the format of the silent frame
+func xingFrame(frames, bytes int) []byte {
+	b := make([]byte, len(SilentBytes))
+	copy(b, SilentBytes[:4])
+	copy(b[36:], "Xing")
+	binary.BigEndian.PutUint32(b[40:], XingFrames|XingBytes|XingTOC|XingQuality)
+	binary.BigEndian.PutUint32(b[44:], uint32(frames))
+	binary.BigEndian.PutUint32(b[48:], uint32(bytes))
+	for i := 0; i < 100; i++ {
+		b[52+i] = byte(i * 256 / 100)
+	}
+	binary.BigEndian.PutUint32(b[152:], 57)
+	return b
+}
+
+func TestXing(t *testing.T) {
+	if SilentFrame.IsXing() {
+		t.Errorf("silent frame reported as Xing")
+	}
+
+	f := Frame{buf: xingFrame(1000, 626*1001)}
+	x, err := f.Xing()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if x.Info || x.Frames != 1000 || x.Bytes != 626*1001 || x.Quality != 57 || x.TOC[50] != 128 {
+		t.Errorf("unexpected header %+v", x)
+	}
+	if want := 1000 * 1152 * time.Second / 44100; x.Duration() != want {
+		t.Errorf("expected duration %v, got %v", want, x.Duration())
+	}
+
+	// a corrupt frame count must not overflow the duration
+	f = Frame{buf: xingFrame(0xFFFFFFFF, 626*1001)}
+	x, err = f.Xing()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if hours := x.Duration().Hours(); hours < 31000 || hours > 31200 {
+		t.Errorf("expected about 31100 hours, got %v", x.Duration())
+	}
+}
+
+func TestLAME(t *testing.T) {
+	b := xingFrame(1000, 626*1001)
+	l := b[156:]
+	copy(l, "LAME3.99r")
+	l[9] = 0x13                               // revision 1, VBR method 3
+	l[10] = 195                               // 19.5 kHz lowpass
+	binary.BigEndian.PutUint32(l[11:], 1<<22) // peak 0.5
+	binary.BigEndian.PutUint16(l[15:], 1<<13|3<<10|1<<9|62)
+	l[21], l[22], l[23] = 0x24, 0x00, 0x4B // delay 576, padding 75
+	l[24] = 1<<6 | 3<<2                    // 44.1 kHz, joint stereo
+	l[25] = 0xFE                           // -2 MP3Gain steps
+	binary.BigEndian.PutUint32(l[28:], 626*1001)
+	crc := lameCRC16(0, b[:190])
+	binary.BigEndian.PutUint16(l[34:], crc)
+
+	f := Frame{buf: b}
+	tag, err := f.LAME()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	want := LAMETag{
+		Encoder:      "LAME3.99r",
+		Revision:     1,
+		VBRMethod:    LAMEVBR1,
+		Lowpass:      19500,
+		Peak:         0.5,
+		RadioGain:    ReplayGain{Name: 1, Originator: 3, Gain: -6.2},
+		EncoderDelay: 576,
+		Padding:      75,
+		StereoMode:   LAMEJoint,
+		SourceRate:   1,
+		MP3Gain:      -2,
+		MusicLength:  626 * 1001,
+		TagCRC:       crc,
+		TagCRCValid:  true,
+	}
+	if *tag != want {
+		t.Errorf("expected %+v, got %+v", want, *tag)
+	}
+
+	// padding within the decoder delay leaves nothing to trim at the end
+	if skip, tail := tag.Trim(); skip != 576+529 || tail != 0 {
+		t.Errorf("expected trim of 1105 and 0, got %d and %d", skip, tail)
+	}
+	tag.Padding = 1000
+	if _, tail := tag.Trim(); tail != 1000-529 {
+		t.Errorf("expected tail of 471, got %d", tail)
+	}
+
+	if _, err := SilentFrame.LAME(); err == nil {
+		t.Errorf("expected error for frame without Xing header")
+	}
+}
+
+func TestVBRI(t *testing.T) {
+	b := make([]byte, len(SilentBytes))
+	copy(b, SilentBytes[:4])
+	v := b[36:]
+	copy(v, "VBRI")
+	binary.BigEndian.PutUint16(v[4:], 1)
+	binary.BigEndian.PutUint32(v[10:], 10000)
+	binary.BigEndian.PutUint32(v[14:], 100)
+	binary.BigEndian.PutUint16(v[18:], 4)  // entries
+	binary.BigEndian.PutUint16(v[20:], 2)  // scale
+	binary.BigEndian.PutUint16(v[22:], 2)  // entry size
+	binary.BigEndian.PutUint16(v[24:], 25) // frames per entry
+	for i := 0; i < 4; i++ {
+		binary.BigEndian.PutUint16(v[26+2*i:], 1250)
+	}
+
+	f := Frame{buf: b}
+	si, err := f.StreamInfo()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if _, ok := si.(*VBRIHeader); !ok {
+		t.Fatalf("expected VBRI header, got %T", si)
+	}
+	if si.FrameCount() != 100 || si.ByteCount() != 10000 {
+		t.Errorf("unexpected counts %d %d", si.FrameCount(), si.ByteCount())
+	}
+	half := si.Duration() / 2
+	if off, ok := si.SeekOffset(half); !ok || off < 4990 || off > 5010 {
+		t.Errorf("expected offset near 5000, got %d", off)
+	}
+	if SilentFrame.IsStreamInfo() {
+		t.Errorf("silent frame reported as stream info")
+	}
+}
+
+func TestXingSeekOffset(t *testing.T) {
+	f := Frame{buf: xingFrame(1000, 100000)}
+	si, err := f.StreamInfo()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if off, ok := si.SeekOffset(si.Duration() / 4); !ok || off < 24000 || off > 26000 {
+		t.Errorf("expected offset near 25000, got %d", off)
+	}
+}